@@ -4,20 +4,48 @@ import (
 	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
 	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
 	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/render"
 )
 
 var AppVer string
 
+// configFlag is accepted by all commands.
+var configFlag = cli.StringFlag{"config", "", "path of JSON configuration file, flags given in command line override its values"}
+
 func setup(ctx *cli.Context) base.Option {
 	if ctx.GlobalBool("noterm") {
 		log.NonColor = true
 	}
 
 	log.Info("App Version: %s", AppVer)
+	// Recorded in profiles of images.
+	render.AppVer = AppVer
 
-	if err := base.ParseColorSpec(ctx.String("color-spec")); err != nil {
+	opt, err := base.ParseOption(ctx)
+	exit("parse options", err)
 
+	if err = base.ParseColorSpec(opt.ColorSpec); err != nil {
+		exit("parse color map", err)
 	}
+	base.Colors, err = base.Colors.WithOverflow(opt.Overflow)
+	exit("parse color map", err)
+	exit("validate color map", base.Colors.Validate())
+	return opt
+}
 
-	return base.ParseOption(ctx)
+// exit translates error of command into exit code, 1 when command fails
+// and 2 when some files fail but rest of them kept going.
+func exit(action string, err error) {
+	if err == nil {
+		return
+	}
+
+	if be, ok := err.(*base.BatchError); ok {
+		log.Error("Fail to %s for %d file(s):", action, len(be.Failures))
+		for _, f := range be.Failures {
+			log.Error("  %s: %v", f.Name, f.Err)
+		}
+		log.Exit(2)
+	}
+	log.Fatal("Fail to %s: %v", action, err)
 }
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+var CmdConsensus = cli.Command{
+	Name:   "consensus",
+	Usage:  "generate consensus abv file of most frequent variants",
+	Action: runConsensus,
+	Flags: []cli.Flag{
+		cli.StringFlag{"abv-path", "./", "directory of abv files"},
+		cli.StringFlag{"output", "consensus.abv", "path of consensus abv file"},
+		cli.IntFlag{"max-band", -1, "max band index(inclusive), -1 for no limit"},
+		cli.IntFlag{"max-pos", -1, "max position index(inclusive), -1 for no limit"},
+		cli.Float64Flag{"min-call-rate", 0.5, "min rate of humans that have recognized tile"},
+		cli.StringFlag{"tie", abv.TIE_LOWEST, "tie-breaking policy(lowest, highest or nocall)"},
+		cli.BoolFlag{"keep-going, k", "leave out abv files that fail to parse and summarize failures at the end"},
+		configFlag,
+	},
+}
+
+// consensusAbvs saves consensus of all abv files to output file,
+// humans that fail to parse are left out when it keeps going.
+func consensusAbvs(opt base.Option) error {
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	} else if len(names) == 0 {
+		return fmt.Errorf("no abv file found in: %s", opt.AbvPath)
+	}
+
+	humans := make([]*abv.Human, 0, len(names))
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	for i, name := range names {
+		h, err := abv.Parse(name, false, opt.Range, nil)
+		if err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		humans = append(humans, h)
+		log.Debug("[%d] %s parsed", i, name)
+	}
+	if len(humans) == 0 {
+		return batch.Err()
+	}
+
+	h, err := abv.Consensus(humans, opt.MinCallRate, opt.Tie)
+	if err != nil {
+		return err
+	}
+
+	os.MkdirAll(path.Dir(opt.Output), os.ModePerm)
+	fw, err := os.Create(opt.Output)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	w := abv.NewWriter(fw, h.Name)
+	if err = abv.WriteHuman(w, h); err != nil {
+		return err
+	} else if err = w.Close(); err != nil {
+		return fmt.Errorf("fail to save abv file(%s): %v", opt.Output, err)
+	}
+	log.Info("Consensus of %d abv files saved to %s: %d tiles called", len(humans), opt.Output, h.PosCount)
+	return batch.Err()
+}
+
+func runConsensus(ctx *cli.Context) {
+	exit("generate consensus", consensusAbvs(setup(ctx)))
+}
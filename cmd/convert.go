@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+var CmdConvert = cli.Command{
+	Name:   "convert",
+	Usage:  "convert abv file(s) between text and binary format",
+	Action: runConvert,
+	Flags: []cli.Flag{
+		cli.StringFlag{"format", "binary", "target format(binary or text)"},
+		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s)"},
+		cli.StringFlag{"output-dir", "converted", "path to store converted abv file(s)"},
+		cli.BoolFlag{"compress, c", "compress every band in binary format"},
+		cli.BoolFlag{"keep-going, k", "continue past files that fail to convert"},
+		configFlag,
+	},
+}
+
+// convertAbvs converts all abv files to target format and saves to output directory.
+func convertAbvs(opt base.Option) error {
+	if opt.Format != "binary" && opt.Format != "text" {
+		return fmt.Errorf("unknown format: %s", opt.Format)
+	}
+
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	}
+
+	if err = os.MkdirAll(opt.OutputDir, os.ModePerm); err != nil {
+		return err
+	}
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	for i, name := range names {
+		dest := path.Join(opt.OutputDir, path.Base(name))
+		if dest == path.Clean(name) {
+			return fmt.Errorf("output file is the same as input file: %s", name)
+		}
+
+		if err = abv.Convert(name, dest, opt.Format, opt.Compress); err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("[%d] %s -> %s", i, name, dest)
+	}
+	return batch.Err()
+}
+
+func runConvert(ctx *cli.Context) {
+	exit("convert abv files", convertAbvs(setup(ctx)))
+}
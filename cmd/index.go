@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+var CmdIndex = cli.Command{
+	Name:   "index",
+	Usage:  "build band index file(s) for random access of abv file(s)",
+	Action: runIndex,
+	Flags: []cli.Flag{
+		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s)"},
+		cli.BoolFlag{"force, f", "force to rebuild up-to-date index"},
+		cli.BoolFlag{"keep-going, k", "skip abv files that fail and summarize failures at the end"},
+		configFlag,
+	},
+}
+
+// indexAbvs builds and saves index of all text abv files unless it is up-to-date.
+func indexAbvs(opt base.Option) error {
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	}
+
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	for i, name := range names {
+		if !opt.Force {
+			if _, err = abv.LoadIndex(name); err == nil {
+				log.Debug("[%d] %s: index is up-to-date, to rebuild use -force", i, name)
+				continue
+			}
+		}
+
+		idx, err := abv.BuildIndex(name)
+		if err == abv.ErrBinaryIndex {
+			log.Debug("[%d] %s: skip binary abv file", i, name)
+			continue
+		} else if err == nil {
+			err = idx.Save(name)
+		}
+		if err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("[%d] %s: %d bands", i, name, len(idx.Bands))
+	}
+	return batch.Err()
+}
+
+func runIndex(ctx *cli.Context) {
+	exit("build index", indexAbvs(setup(ctx)))
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+var CmdMerge = cli.Command{
+	Name:   "merge",
+	Usage:  "merge abv files into a cohort file",
+	Action: runMerge,
+	Flags: []cli.Flag{
+		cli.StringFlag{"abv-path", "./", "directory of abv files"},
+		cli.StringFlag{"output", "cohort.abvc", "path of cohort file"},
+		configFlag,
+	},
+}
+
+// mergeAbvs merges all abv files into output cohort file.
+func mergeAbvs(opt base.Option) error {
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	} else if len(names) == 0 {
+		return fmt.Errorf("no abv file found in: %s", opt.AbvPath)
+	}
+
+	samples := make([]string, len(names))
+	for i, name := range names {
+		samples[i] = strings.TrimSuffix(path.Base(name), ".abv")
+	}
+
+	os.MkdirAll(path.Dir(opt.Output), os.ModePerm)
+	fw, err := os.Create(opt.Output)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	if err = abv.MergeCohort(fw, samples, names); err != nil {
+		return err
+	}
+	log.Info("%d abv files merged into %s", len(names), opt.Output)
+	return nil
+}
+
+func runMerge(ctx *cli.Context) {
+	exit("merge abv files", mergeAbvs(setup(ctx)))
+}
@@ -11,6 +11,7 @@ var CmdPlot = cli.Command{
 	Action: runPlot,
 	Flags: []cli.Flag{
 		cli.StringFlag{"http-port", "8000", "HTTP port"},
+		configFlag,
 	},
 }
 
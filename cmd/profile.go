@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+// ProfileFlags are global flags that profile any command.
+var ProfileFlags = []cli.Flag{
+	cli.StringFlag{"cpuprofile", "", "write CPU profile of command to file"},
+	cli.StringFlag{"memprofile", "", "write memory profile to file when command finishes"},
+	cli.StringFlag{"trace", "", "write execution trace of command to file"},
+}
+
+// stops are functions to stop started profiles in order.
+var stops []func()
+
+// startProfiles starts profiles of given global flags.
+func startProfiles(ctx *cli.Context) error {
+	if name := ctx.String("cpuprofile"); len(name) > 0 {
+		fw, err := os.Create(name)
+		if err != nil {
+			return err
+		} else if err = pprof.StartCPUProfile(fw); err != nil {
+			fw.Close()
+			return fmt.Errorf("fail to start CPU profile: %v", err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			fw.Close()
+		})
+	}
+
+	if name := ctx.String("trace"); len(name) > 0 {
+		fw, err := os.Create(name)
+		if err != nil {
+			return err
+		} else if err = trace.Start(fw); err != nil {
+			fw.Close()
+			return fmt.Errorf("fail to start trace: %v", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			fw.Close()
+		})
+	}
+
+	// Memory profile is only written at the end, but file is created
+	// beforehand to fail early.
+	if name := ctx.String("memprofile"); len(name) > 0 {
+		fw, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		stops = append(stops, func() {
+			defer fw.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(fw); err != nil {
+				log.Error("Fail to write memory profile: %v", err)
+			}
+		})
+	}
+	return nil
+}
+
+// StartProfiles starts profiles of global flags -cpuprofile, -memprofile and -trace
+// before any command, and profiles are written when command returns or exits.
+func StartProfiles(ctx *cli.Context) error {
+	log.OnExit(StopProfiles)
+	if err := startProfiles(ctx); err != nil {
+		return fmt.Errorf("fail to start profiling: %v", err)
+	}
+	return nil
+}
+
+// StopProfiles stops started profiles and writes them to files,
+// it does nothing when called again.
+func StopProfiles() {
+	for _, stop := range stops {
+		stop()
+	}
+	stops = nil
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"text/tabwriter"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+var CmdQc = cli.Command{
+	Name:   "qc",
+	Usage:  "report tile coverage and no-call quality of abv files",
+	Action: runQc,
+	Flags: []cli.Flag{
+		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s)"},
+		cli.StringFlag{"output-dir", "qc", "path to store qc.txt and qc.chart"},
+		cli.IntFlag{"max-band", -1, "max band index(inclusive) to check, -1 means all"},
+		cli.StringFlag{"band-len", "", "path of reference band length table"},
+		cli.Float64Flag{"min-call-rate", 0.9, "min call rate of a human to pass check"},
+		cli.Float64Flag{"max-overflow-rate", 1, "max '#' overflow rate of a human to pass check"},
+		cli.BoolFlag{"keep-going, k", "skip abv files that fail to read and summarize failures at the end"},
+		configFlag,
+	},
+}
+
+// qcResult represents quality check result of a human.
+type qcResult struct {
+	*abv.Quality
+	Mismatches int // Number of bands that length mismatches reference.
+	Failed     bool
+}
+
+// checkAbvs reports quality of all abv files, and returns error
+// when any human fails quality check, along with files that are skipped.
+func checkAbvs(opt base.Option) error {
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	}
+
+	var refBandLen map[int]int
+	if len(opt.BandLenPath) > 0 {
+		refBandLen, err = abv.ParseBandLength(opt.BandLenPath)
+		if err != nil {
+			return fmt.Errorf("fail to parse band length table: %v", err)
+		}
+	}
+
+	results := make([]*qcResult, 0, len(names))
+	bands := make(map[int]*abv.BandQuality)
+	maxBand := 0
+	failed := 0
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	for i, name := range names {
+		q, err := abv.CheckQuality(name, opt.Range)
+		if err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		q.Name = path.Base(name)
+		r := &qcResult{Quality: q}
+
+		if q.MaxBand > maxBand {
+			maxBand = q.MaxBand
+		}
+		for idx, bq := range q.Bands {
+			if _, ok := bands[idx]; !ok {
+				bands[idx] = new(abv.BandQuality)
+			}
+			bands[idx].Len += bq.Len
+			bands[idx].NoCall += bq.NoCall
+			bands[idx].Overflow += bq.Overflow
+
+			if l, ok := refBandLen[idx]; ok && l != bq.Len {
+				log.Warn("%s: band %s has %d tiles but reference has %d",
+					q.Name, base.Int2HexStr(idx), bq.Len, l)
+				r.Mismatches++
+			}
+		}
+		for idx, l := range refBandLen {
+			if _, ok := q.Bands[idx]; !ok && idx <= q.MaxBand {
+				log.Warn("%s: band %s is missing but reference has %d tiles",
+					q.Name, base.Int2HexStr(idx), l)
+				r.Mismatches++
+			}
+		}
+
+		r.Failed = q.CallRate() < opt.MinCallRate ||
+			q.OverflowRate() > opt.MaxOverflowRate || r.Mismatches > 0
+		if r.Failed {
+			failed++
+		}
+		results = append(results, r)
+		log.Info("[%d] %s: %d - %d", i, q.Name, q.NoCall, q.Overflow)
+	}
+
+	if err = os.MkdirAll(opt.OutputDir, os.ModePerm); err != nil {
+		return fmt.Errorf("fail to create output directory: %v", err)
+	}
+	fw, err := os.Create(path.Join(opt.OutputDir, "qc.txt"))
+	if err != nil {
+		return fmt.Errorf("fail to create qc.txt: %v", err)
+	}
+	defer fw.Close()
+	writeQcTable(io.MultiWriter(os.Stdout, fw), results, bands, maxBand)
+
+	if err = writeQcChart(path.Join(opt.OutputDir, "qc.chart"), bands, maxBand); err != nil {
+		return fmt.Errorf("fail to save qc.chart: %v", err)
+	}
+
+	err = batch.Err()
+	if failed > 0 {
+		if err != nil {
+			return fmt.Errorf("%d of %d human(s) failed quality check, %v", failed, len(results), err)
+		}
+		return fmt.Errorf("%d of %d human(s) failed quality check", failed, len(results))
+	}
+	log.Info("All %d human(s) passed quality check", len(results))
+	return err
+}
+
+func runQc(ctx *cli.Context) {
+	exit("check quality", checkAbvs(setup(ctx)))
+}
+
+// writeQcTable writes per-human and per-band quality table to given writer.
+func writeQcTable(w io.Writer, results []*qcResult, bands map[int]*abv.BandQuality, maxBand int) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HUMAN\tTILES\tNO-CALL\tCALL RATE\tOVERFLOW\tOVERFLOW RATE\tMISMATCH\tSTATUS")
+	for _, r := range results {
+		status := "PASS"
+		if r.Failed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.4f\t%d\t%.4f\t%d\t%s\n", r.Name, r.Len,
+			r.NoCall, r.CallRate(), r.Overflow, r.OverflowRate(), r.Mismatches, status)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "BAND\tTILES\tNO-CALL\tNO-CALL RATE\tOVERFLOW\tOVERFLOW RATE")
+	for i := 0; i <= maxBand; i++ {
+		bq, ok := bands[i]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.4f\t%d\t%.4f\n", base.Int2HexStr(i), bq.Len,
+			bq.NoCall, 1-bq.CallRate(), bq.Overflow, bq.OverflowRate())
+	}
+	tw.Flush()
+}
+
+// writeQcChart saves per-band no-call and overflow rates in per mille
+// as a line chart for plot server.
+func writeQcChart(name string, bands map[int]*abv.BandQuality, maxBand int) error {
+	fw, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	fw.WriteString("===\n{ \"Name\" : \"line\", \"Height\" : 500, \"Width\" : 10000 }\n---\n")
+	for i := 0; i <= maxBand; i++ {
+		bq, ok := bands[i]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(fw, "%s %d %d\n", base.Int2HexStr(i),
+			int((1-bq.CallRate())*1000), int(bq.OverflowRate()*1000))
+	}
+	return nil
+}
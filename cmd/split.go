@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+var CmdAbvSplit = cli.Command{
+	Name:   "split",
+	Usage:  "split abv file(s) into one file per band range",
+	Action: runAbvSplit,
+	Flags: []cli.Flag{
+		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s)"},
+		cli.StringFlag{"output-dir", "split", "path to store split abv files"},
+		cli.IntFlag{"bands-per-file", 1, "number of bands in each split file"},
+		cli.IntFlag{"chunks", 0, "number of split files, overrides -bands-per-file"},
+		cli.BoolFlag{"keep-going, k", "skip abv files that fail and summarize failures at the end"},
+		configFlag,
+	},
+}
+
+var CmdAbvSubset = cli.Command{
+	Name:   "subset",
+	Usage:  "extract band and position range of abv file(s)",
+	Action: runAbvSubset,
+	Flags: []cli.Flag{
+		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s)"},
+		cli.StringFlag{"output-dir", "subset", "path to store subset abv file(s)"},
+		cli.IntFlag{"min-band", 0, "min band index(inclusive)"},
+		cli.IntFlag{"max-band", -1, "max band index(inclusive), -1 for no limit"},
+		cli.IntFlag{"min-pos", 0, "min position index(inclusive)"},
+		cli.IntFlag{"max-pos", -1, "max position index(inclusive), -1 for no limit"},
+		cli.BoolFlag{"keep-going, k", "skip abv files that fail and summarize failures at the end"},
+		configFlag,
+	},
+}
+
+var CmdAbvConcat = cli.Command{
+	Name:   "concat",
+	Usage:  "concatenate band-partitioned abv files of the same human",
+	Action: runAbvConcat,
+	Flags: []cli.Flag{
+		cli.StringFlag{"abv-path", "./", "directory of abv files, or list files as arguments"},
+		cli.StringFlag{"output", "concat.abv", "path of concatenated abv file"},
+		configFlag,
+	},
+}
+
+// splitAbv splits given abv file into files of given band ranges in given directory.
+func splitAbv(name, dir string, ranges []abv.BandRange) error {
+	fr, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	rd, err := abv.NewReader(fr)
+	if err != nil {
+		return err
+	}
+
+	prefix := path.Join(dir, strings.TrimSuffix(path.Base(name), ".abv"))
+	var fw *os.File
+	var w abv.Writer
+	// closeWriter closes current split file if there is one.
+	closeWriter := func() error {
+		if w == nil {
+			return nil
+		}
+		defer fw.Close()
+		err := w.Close()
+		w = nil
+		return err
+	}
+	defer closeWriter()
+
+	rangeIdx := -1
+	for {
+		b, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if rangeIdx == -1 || b.Index > ranges[rangeIdx].End {
+			if err = closeWriter(); err != nil {
+				return err
+			}
+
+			rangeIdx++
+			dest := prefix + "." + ranges[rangeIdx].String() + ".abv"
+			if fw, err = os.Create(dest); err != nil {
+				return err
+			}
+			w = abv.NewWriterLike(fw, rd)
+			log.Debug("%s -> %s", name, dest)
+		}
+
+		if err = w.WriteBand(b); err != nil {
+			return err
+		}
+	}
+	return closeWriter()
+}
+
+// splitAbvs splits all abv files into files of band ranges in output directory.
+func splitAbvs(opt base.Option) error {
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	}
+
+	if err = os.MkdirAll(opt.OutputDir, os.ModePerm); err != nil {
+		return err
+	}
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	for i, name := range names {
+		bands, err := abv.BandList(name)
+		if err == nil {
+			ranges := abv.PartitionBands(bands, opt.BandsPerFile, opt.Chunks)
+			if err = splitAbv(name, opt.OutputDir, ranges); err == nil {
+				log.Info("[%d] %s: %d bands -> %d files", i, name, len(bands), len(ranges))
+				continue
+			}
+		}
+		if err = batch.Fail(name, err); err != nil {
+			return err
+		}
+	}
+	return batch.Err()
+}
+
+func runAbvSplit(ctx *cli.Context) {
+	exit("split abv files", splitAbvs(setup(ctx)))
+}
+
+// subsetAbv saves given range of abv file to given path.
+func subsetAbv(name, dest string, r *base.Range) error {
+	fr, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	rd, err := abv.NewReader(fr)
+	if err != nil {
+		return err
+	}
+
+	fw, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	w := abv.NewWriterLike(fw, rd)
+	if err = abv.Subset(w, rd, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// subsetAbvs saves range of all abv files to output directory.
+func subsetAbvs(opt base.Option) error {
+	if opt.StartBandIdx < 0 {
+		return errors.New("-min-band cannot be negative")
+	} else if opt.EndBandIdx >= 0 && opt.StartBandIdx > opt.EndBandIdx {
+		return errors.New("-min-band cannot be greater than -max-band")
+	} else if opt.StartPosIdx < 0 {
+		return errors.New("-min-pos cannot be negative")
+	} else if opt.EndPosIdx >= 0 && opt.StartPosIdx > opt.EndPosIdx {
+		return errors.New("-min-pos cannot be greater than -max-pos")
+	}
+
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	}
+
+	if err = os.MkdirAll(opt.OutputDir, os.ModePerm); err != nil {
+		return err
+	}
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	for i, name := range names {
+		dest := path.Join(opt.OutputDir, path.Base(name))
+		if dest == path.Clean(name) {
+			return fmt.Errorf("output file is the same as input file: %s", name)
+		}
+
+		if err = subsetAbv(name, dest, opt.Range); err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("[%d] %s -> %s", i, name, dest)
+	}
+	return batch.Err()
+}
+
+func runAbvSubset(ctx *cli.Context) {
+	exit("subset abv files", subsetAbvs(setup(ctx)))
+}
+
+// concatAbvs concatenates given band-partitioned abv files of the same human
+// into output file, all of them are required so it never keeps going.
+func concatAbvs(opt base.Option, names []string) (err error) {
+	if len(names) == 0 {
+		if names, err = base.GetFileListBySuffix(opt.AbvPath, ".abv"); err != nil {
+			return fmt.Errorf("fail to get abv list: %v", err)
+		}
+	}
+	if len(names) == 0 {
+		return errors.New("no abv file to concatenate")
+	}
+
+	rds := make([]*abv.Reader, len(names))
+	for i, name := range names {
+		if path.Clean(name) == path.Clean(opt.Output) {
+			return fmt.Errorf("output file is the same as input file: %s", name)
+		}
+
+		fr, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+
+		if rds[i], err = abv.NewReader(fr); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if err = os.MkdirAll(path.Dir(opt.Output), os.ModePerm); err != nil {
+		return err
+	}
+	fw, err := os.Create(opt.Output)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	w := abv.NewWriterLike(fw, rds[0])
+	if err = abv.Concat(w, names, rds); err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		// Do not leave partial output.
+		fw.Close()
+		os.Remove(opt.Output)
+		return fmt.Errorf("fail to save abv file(%s): %v", opt.Output, err)
+	}
+	log.Info("%d abv files concatenated into %s", len(names), opt.Output)
+	return nil
+}
+
+func runAbvConcat(ctx *cli.Context) {
+	opt := setup(ctx)
+	exit("concatenate abv files", concatAbvs(opt, []string(ctx.Args())))
+}
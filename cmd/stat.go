@@ -7,7 +7,6 @@ import (
 	"io"
 	"os"
 	"path"
-	"strings"
 
 	// "github.com/Unknwon/com"
 
@@ -23,9 +22,11 @@ var CmdStat = cli.Command{
 	Action: runStat,
 	Flags: []cli.Flag{
 		cli.IntFlag{"mode, m", 0, "generate mode(1-6), see README.md for detail"},
-		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s)"},
+		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s) or cohort file"},
 		cli.IntFlag{"max-band", 99, "max band index(inclusive) to do statistic"},
 		cli.IntFlag{"size", 5, "window size of tiles"},
+		cli.BoolFlag{"keep-going, k", "leave out abv files that fail to parse and summarize failures at the end"},
+		configFlag,
 	},
 }
 
@@ -39,38 +40,60 @@ func runStat(ctx *cli.Context) {
 		log.Info("Mode: Default variant sum")
 	case 3:
 		log.Info("Mode: Fastj statistic")
-		if err := fastjStat(ctx); err != nil {
-			log.Fatal("%v", err)
-		}
+		exit("do fastj statistic", fastjStat(ctx))
 		return
 	case 4:
 		log.Info("Mode: Fastj chromosome statistic")
-		if err := fastjChrStat(ctx); err != nil {
-			log.Fatal("%v", err)
-		}
+		exit("do fastj chromosome statistic", fastjChrStat(ctx))
 		return
 	case 5:
 		log.Info("Mode: Fastj chromosome statistic")
-		if err := fastjChrBandStat(ctx); err != nil {
-			log.Fatal("%v", err)
-		}
+		exit("do fastj chromosome statistic", fastjChrBandStat(ctx))
 		return
 	case 6:
 		log.Info("Mode: Fastj2 chromosome statistic")
-		if err := fastj2ChrBandStat(ctx); err != nil {
-			log.Fatal("%v", err)
-		}
+		exit("do fastj2 chromosome statistic", fastj2ChrBandStat(ctx))
 		return
 	default:
-		log.Fatal("Unknown mode: %v", opt.Mode)
+		exit("do statistic", fmt.Errorf("unknown mode: %v", opt.Mode))
 	}
+	exit("do statistic", statAbvs(opt))
+}
 
-	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
-	if err != nil {
-		log.Fatal("Fail to get abv list: %v", err)
+// statAbvs does statistic on abv files or cohort file and saves chart,
+// abv files that fail to parse are left out when it keeps going.
+func statAbvs(opt base.Option) error {
+	var names []string
+	var stats []*abv.Statistic
+	var err error
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	if abv.IsCohortFile(opt.AbvPath) {
+		names, stats, err = abv.StatCohort(opt.AbvPath, opt)
+		if err != nil {
+			return fmt.Errorf("fail to parse cohort file(%s): %v", opt.AbvPath, err)
+		}
+	} else {
+		all, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+		if err != nil {
+			return fmt.Errorf("fail to get abv list: %v", err)
+		}
+
+		for _, name := range all {
+			stat, err := abv.Stat(name, opt)
+			if err != nil {
+				if err = batch.Fail(name, err); err != nil {
+					return err
+				}
+				continue
+			}
+			names = append(names, name)
+			stats = append(stats, stat)
+		}
+	}
+	if len(stats) == 0 {
+		return batch.Err()
 	}
 
-	stats := make([]*abv.Statistic, len(names))
 	maxWindows := 0
 
 	os.MkdirAll("stat", os.ModePerm)
@@ -79,18 +102,11 @@ func runStat(ctx *cli.Context) {
 	fw.WriteString("===\n{ \"Name\" : \"line\", \"Height\" : 500, \"Width\" : 10000 }\n---\n")
 
 	log.Info("[Idx] Name: non-default - unrecognize")
-	for i, name := range names {
-		stat, err := abv.Stat(name, opt)
-		if err != nil {
-			log.Fatal("Fail to parse abv file(%s): %v", name, err)
-		}
-
+	for i, stat := range stats {
 		if maxWindows < len(stat.Windows[0]) {
 			maxWindows = len(stat.Windows[0])
 		}
-		stats[i] = stat
-
-		log.Info("[%d] %s: %d - %d", i, path.Base(name), stat.Variant, stat.Unrecognize)
+		log.Info("[%d] %s: %d - %d", i, path.Base(names[i]), stat.Variant, stat.Unrecognize)
 	}
 
 	for i := 1; i <= maxWindows; i++ {
@@ -106,6 +122,7 @@ func runStat(ctx *cli.Context) {
 		fw.WriteString(base.ToStr(s) + " ")
 		fw.WriteString("\n")
 	}
+	return batch.Err()
 }
 
 func fastjStat(ctx *cli.Context) error {
@@ -160,22 +177,6 @@ func fastjStat(ctx *cli.Context) error {
 	return nil
 }
 
-func getChr(name string) int {
-	name = path.Base(name)
-	chr := name[3:strings.Index(name, "_")]
-	switch chr {
-	case "X":
-		return 23
-	case "Y":
-		return 24
-	case "M":
-		return 25
-	default:
-		num, _ := base.StrTo(chr).Int()
-		return num
-	}
-}
-
 func fastjChrStat(ctx *cli.Context) error {
 	names, err := base.GetFileListBySuffix("fastj/hu661AD0.fj", ".fj")
 	if err != nil {
@@ -190,7 +191,7 @@ func fastjChrStat(ctx *cli.Context) error {
 	for i, name := range names {
 		fmt.Println(i, name)
 
-		chr := getChr(name)
+		chr := abv.FastjChr(name)
 		if _, ok := bands[chr]; !ok {
 			bands[chr] = make(map[int]int)
 			if chr > maxChr {
@@ -245,13 +246,6 @@ func fastjChrStat(ctx *cli.Context) error {
 	return nil
 }
 
-func getBand(name string) int {
-	name = path.Base(name)
-	start := strings.Index(name, "_") + 5
-	band, _ := base.StrTo(name[start : start+strings.Index(name[start:], "_")]).Int()
-	return band
-}
-
 func fastjChrBandStat(ctx *cli.Context) error {
 	names, err := base.GetFileListBySuffix("fastj/hu661AD0.fj", ".fj")
 	if err != nil {
@@ -264,12 +258,12 @@ func fastjChrBandStat(ctx *cli.Context) error {
 
 	for i, name := range names {
 		fmt.Println(i, name)
-		chr := getChr(name)
+		chr := abv.FastjChr(name)
 		if chr != 1 {
 			continue
 		}
 
-		band := getBand(name)
+		band := abv.FastjBand(name)
 		if _, ok := bands[band]; !ok {
 			bands[band] = make(map[int]int)
 			if band > maxBand {
@@ -339,12 +333,12 @@ func fastj2ChrBandStat(ctx *cli.Context) error {
 		// 	return fmt.Errorf(stderr)
 		// }
 		// continue
-		chr := getChr(name)
+		chr := abv.FastjChr(name)
 		if chr != 3 {
 			continue
 		}
 
-		band := getBand(name)
+		band := abv.FastjBand(name)
 		if _, ok := bands[band]; !ok {
 			bands[band] = make(map[int]int)
 			shows[band] = make(map[int]bool)
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv/abvtest"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+var CmdSynth = cli.Command{
+	Name:   "synth",
+	Usage:  "generate synthetic abv files for tests and benchmarks",
+	Action: runSynth,
+	Flags: []cli.Flag{
+		cli.StringFlag{"output-dir", "synth", "path to store synthetic abv files"},
+		cli.IntFlag{"humans", abvtest.DefaultConfig.Humans, "number of humans"},
+		cli.IntFlag{"bands", abvtest.DefaultConfig.Bands, "number of bands"},
+		cli.IntFlag{"band-size", abvtest.DefaultConfig.BandSize, "mean number of tiles of each band"},
+		cli.Float64Flag{"len-jitter", abvtest.DefaultConfig.LenJitter, "band lengths vary by up to this fraction of band size(0-1)"},
+		cli.IntFlag{"variants", abvtest.DefaultConfig.Variants, "number of variants(1-62)"},
+		cli.Float64Flag{"skew", abvtest.DefaultConfig.Skew, "Zipf exponent(> 1) of variants, larger for fewer high variants"},
+		cli.Float64Flag{"divergence", abvtest.DefaultConfig.Divergence, "rate of tiles drawn again instead of taken from shared reference(0-1)"},
+		cli.Float64Flag{"no-call-rate", abvtest.DefaultConfig.NoCallRate, "rate of unrecognized tiles"},
+		cli.Float64Flag{"pound-rate", abvtest.DefaultConfig.PoundRate, "rate of '#' overflow tiles"},
+		cli.IntFlag{"seed", int(abvtest.DefaultConfig.Seed), "seed of random numbers, the same seed generates the same files"},
+		cli.StringFlag{"format", "text", "format of abv files(text or binary)"},
+		cli.BoolFlag{"compress, c", "compress every band in binary format"},
+		configFlag,
+	},
+}
+
+// synthAbvs saves synthetic abv files of given options to output directory.
+func synthAbvs(opt base.Option) error {
+	g, err := abvtest.New(abvtest.Config{
+		Humans:     opt.Humans,
+		Bands:      opt.Bands,
+		BandSize:   opt.BandSize,
+		LenJitter:  opt.LenJitter,
+		Variants:   opt.Variants,
+		Skew:       opt.Skew,
+		Divergence: opt.Divergence,
+		NoCallRate: opt.NoCallRate,
+		PoundRate:  opt.PoundRate,
+		Seed:       int64(opt.Seed),
+		Prefix:     abvtest.DefaultConfig.Prefix,
+	})
+	if err != nil {
+		return err
+	}
+
+	names, err := g.WriteFiles(opt.OutputDir, opt.Format, opt.Compress)
+	if err != nil {
+		return err
+	}
+	log.Info("%d abv file(s) of %d bands saved in %s", len(names), opt.Bands, opt.OutputDir)
+	return nil
+}
+
+func runSynth(ctx *cli.Context) {
+	exit("generate synthetic abv files", synthAbvs(setup(ctx)))
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+var CmdValidate = cli.Command{
+	Name:   "validate",
+	Usage:  "validate format of abv file(s)",
+	Action: runValidate,
+	Flags: []cli.Flag{
+		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s)"},
+		cli.StringFlag{"band-len", "", "path of reference band length table"},
+		cli.IntFlag{"max-problems", 100, "max number of problems to print per file, 0 means all"},
+		cli.BoolFlag{"keep-going, k", "skip abv files that fail to read and summarize failures at the end"},
+		configFlag,
+	},
+}
+
+// validateAbv validates given abv file based on reference band length table.
+func validateAbv(name string, bandLen map[int]int) ([]*abv.Problem, error) {
+	fr, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	return abv.ValidateWithBandLength(fr, bandLen)
+}
+
+// validateAbvs validates all abv files, and returns error when any of them is invalid,
+// along with files that are skipped.
+func validateAbvs(opt base.Option) error {
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	}
+
+	var bandLen map[int]int
+	if len(opt.BandLenPath) > 0 {
+		bandLen, err = abv.ParseBandLength(opt.BandLenPath)
+		if err != nil {
+			return fmt.Errorf("fail to parse band length table: %v", err)
+		}
+	}
+
+	invalid := 0
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	for i, name := range names {
+		ps, err := validateAbv(name, bandLen)
+		if err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(ps) == 0 {
+			log.Info("[%d] %s: OK", i, name)
+			continue
+		}
+
+		invalid++
+		log.Error("[%d] %s: %d problem(s)", i, name, len(ps))
+		for j, p := range ps {
+			if opt.MaxProblems > 0 && j == opt.MaxProblems {
+				log.Error("%s: %d more problem(s) omitted", name, len(ps)-j)
+				break
+			}
+			log.Error("%s: %v", name, p)
+		}
+	}
+
+	err = batch.Err()
+	if invalid > 0 {
+		if err != nil {
+			return fmt.Errorf("%d of %d abv file(s) are invalid, %v", invalid, len(names), err)
+		}
+		return fmt.Errorf("%d of %d abv file(s) are invalid", invalid, len(names))
+	} else if err != nil {
+		return err
+	}
+	log.Info("All %d abv file(s) are valid", len(names))
+	return nil
+}
+
+func runValidate(ctx *cli.Context) {
+	exit("validate abv files", validateAbvs(setup(ctx)))
+}
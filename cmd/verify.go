@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/reverse"
+)
+
+var CmdVerify = cli.Command{
+	Name:   "verify",
+	Usage:  "verify abv file(s) survive gen and reverse without loss",
+	Action: runVerify,
+	Flags: []cli.Flag{
+		cli.IntFlag{"mode, m", 0, "generate mode(1-3) to verify, all of them when 0"},
+		cli.StringFlag{"abv-path", "./", "directory or path of abv file(s)"},
+		cli.StringFlag{"color-spec", "", "path of color specification file or name:<palette>"},
+		cli.StringFlag{"overflow", base.OVERFLOW_EXTEND, "policy of variants beyond color map(extend, alpha or error)"},
+		cli.IntFlag{"min-band", 0, "min band index(inclusive), only for mode 1"},
+		cli.IntFlag{"max-band", 9, "max band index(inclusive)"},
+		cli.IntFlag{"max-pos", 49, "max position index(inclusive)"},
+		cli.IntFlag{"max-col", 3999, "max column index(inclusive)"},
+		cli.IntFlag{"box-num", 15, "box number of width and height"},
+		cli.IntFlag{"slot-pixel", 2, "slot pixel of width and height"},
+		cli.IntFlag{"border", 2, "border pixel between rectangles"},
+		cli.BoolFlag{"annotate, a", "verify images with annotations(not for mode 3)"},
+		cli.IntFlag{"max-problems", 100, "max number of lost tiles to print per file and mode, 0 means all"},
+		cli.BoolFlag{"keep-going, k", "skip abv files that fail to read and summarize failures at the end"},
+		configFlag,
+	},
+}
+
+func runVerify(ctx *cli.Context) {
+	opt := setup(ctx)
+	exit("verify abv files", reverse.Verify(opt))
+}
@@ -44,6 +44,84 @@ type Statistic struct {
 
 var EncodeStd = []byte(".DEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/")
 
+func newStatistic(opt base.Option) *Statistic {
+	return &Statistic{
+		WindowSize: opt.WindowSize,
+		WindowStat: WindowStat{
+			Desc: "band index " + base.ToStr(opt.EndBandIdx),
+		},
+		Windows: make(map[int][]*WindowStat, opt.EndBandIdx+1),
+	}
+}
+
+// statBand does statistic on given band of raw characters by window.
+func (s *Statistic) statBand(opt base.Option, bandIdx int, line []byte) error {
+	var colIdx int     // Current column index.
+	var char uint8     // Current char.
+	var ws *WindowStat // Current window statistic.
+
+	for colIdx, char = range line {
+		if colIdx > 3999 {
+			colIdx--
+			break
+		}
+
+		if colIdx == 0 {
+			ws = &WindowStat{
+				Desc: fmt.Sprintf("%d-%d", 0, opt.WindowSize-1),
+			}
+		} else if colIdx%opt.WindowSize == 0 {
+			if ws.Variant > 0 {
+				ws.AvgVariantVal = float32(ws.VariantSum) / float32(ws.Variant)
+			}
+			s.Windows[bandIdx] = append(s.Windows[bandIdx], ws)
+			s.Unrecognize += ws.Unrecognize
+			s.Variant += ws.Variant
+			s.VariantSum += ws.VariantSum
+			ws = &WindowStat{
+				Desc: fmt.Sprintf("%d-%d", colIdx, colIdx+opt.WindowSize-1),
+			}
+		}
+
+		varIdx := -1
+		switch char {
+		case '-': // Not recognize.
+			ws.Unrecognize++
+			continue
+		case '#':
+			ws.Variant++
+			varIdx = 62
+		case '.': // Default variant.
+			if opt.Mode == 1 {
+				varIdx = 0
+			} else {
+				varIdx = 1000
+			}
+		default:
+			ws.Variant++
+			// Non-default variant.
+			varIdx = bytes.IndexByte(EncodeStd, char)
+			if varIdx < 1 {
+				return fmt.Errorf("invalid variant '%c' at band %s, column %d",
+					char, base.Int2HexStr(bandIdx), colIdx)
+			}
+		}
+		ws.VariantSum += varIdx
+	}
+
+	if colIdx%opt.WindowSize != 0 {
+		if ws.Variant > 0 {
+			ws.AvgVariantVal = float32(ws.VariantSum) / float32(ws.Variant)
+		}
+		ws.Desc = fmt.Sprintf("%d-%d", colIdx-colIdx%opt.WindowSize, colIdx)
+		s.Windows[bandIdx] = append(s.Windows[bandIdx], ws)
+		s.Unrecognize += ws.Unrecognize
+		s.Variant += ws.Variant
+		s.VariantSum += ws.VariantSum
+	}
+	return nil
+}
+
 func Stat(name string, opt base.Option) (*Statistic, error) {
 	if !base.IsFile(name) {
 		return nil, fmt.Errorf("file(%s) does not exist or is not a file", name)
@@ -55,21 +133,9 @@ func Stat(name string, opt base.Option) (*Statistic, error) {
 	}
 	defer fr.Close()
 
-	s := &Statistic{
-		WindowSize: opt.WindowSize,
-		WindowStat: WindowStat{
-			Desc: "band index " + base.ToStr(opt.EndBandIdx),
-		},
-		Windows: make(map[int][]*WindowStat, opt.EndBandIdx+1),
-	}
-	for i := range s.Windows {
-		s.Windows[i] = make([]*WindowStat, 0, 1000)
-	}
+	s := newStatistic(opt)
 
-	var bandIdx int    // Current band index.
-	var colIdx int     // Current column index.
-	var char uint8     // Current char.
-	var ws *WindowStat // Current window statistic.
+	var bandIdx int // Current band index.
 
 	var line []byte
 	buf := bufio.NewReader(fr)
@@ -100,72 +166,14 @@ func Stat(name string, opt base.Option) (*Statistic, error) {
 		if !isInBody {
 			bandIdx, err = base.HexStr2int(string(line))
 			if err != nil {
-				fmt.Println(string(line))
-				return nil, err
+				return nil, fmt.Errorf("invalid band index(%s): %v", line, err)
 			}
 
 			if bandIdx > opt.EndBandIdx {
 				break
 			}
-		} else {
-			for colIdx, char = range line {
-				if colIdx > 3999 {
-					colIdx--
-					break
-				}
-
-				if colIdx == 0 {
-					ws = &WindowStat{
-						Desc: fmt.Sprintf("%d-%d", 0, opt.WindowSize-1),
-					}
-				} else if colIdx%opt.WindowSize == 0 {
-					if ws.Variant > 0 {
-						ws.AvgVariantVal = float32(ws.VariantSum) / float32(ws.Variant)
-					}
-					s.Windows[bandIdx] = append(s.Windows[bandIdx], ws)
-					s.Unrecognize += ws.Unrecognize
-					s.Variant += ws.Variant
-					s.VariantSum += ws.VariantSum
-					ws = &WindowStat{
-						Desc: fmt.Sprintf("%d-%d", colIdx, colIdx+opt.WindowSize-1),
-					}
-				}
-
-				varIdx := -1
-				switch char {
-				case '-': // Not recognize.
-					ws.Unrecognize++
-					continue
-				case '#':
-					ws.Variant++
-					varIdx = 62
-				case '.': // Default variant.
-					if opt.Mode == 1 {
-						varIdx = 0
-					} else {
-						varIdx = 1000
-					}
-				default:
-					ws.Variant++
-					// Non-default variant.
-					varIdx = bytes.IndexByte(EncodeStd, char)
-					if varIdx < 1 {
-						return nil, fmt.Errorf("Invalid version of variant[%s]: %s", line, string(char))
-					}
-				}
-				ws.VariantSum += varIdx
-			}
-
-			if colIdx%opt.WindowSize != 0 {
-				if ws.Variant > 0 {
-					ws.AvgVariantVal = float32(ws.VariantSum) / float32(ws.Variant)
-				}
-				ws.Desc = fmt.Sprintf("%d-%d", colIdx-colIdx%opt.WindowSize, colIdx)
-				s.Windows[bandIdx] = append(s.Windows[bandIdx], ws)
-				s.Unrecognize += ws.Unrecognize
-				s.Variant += ws.Variant
-				s.VariantSum += ws.VariantSum
-			}
+		} else if err = s.statBand(opt, bandIdx, line); err != nil {
+			return nil, err
 		}
 
 		isInBody = !isInBody
@@ -175,6 +183,48 @@ func Stat(name string, opt base.Option) (*Statistic, error) {
 	return s, nil
 }
 
+// StatCohort does statistic on every sample of given cohort file in a single scan.
+func StatCohort(name string, opt base.Option) ([]string, []*Statistic, error) {
+	fr, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fr.Close()
+
+	cr, err := NewCohortReader(fr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats := make([]*Statistic, len(cr.Samples))
+	for i := range stats {
+		stats[i] = newStatistic(opt)
+	}
+
+	for {
+		cb, err := cr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if cb.Index > opt.EndBandIdx {
+			break
+		}
+		for i, tiles := range cb.Tiles {
+			if err = stats[i].statBand(opt, cb.Index, decodeToChars(tiles)); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", cr.Samples[i], err)
+			}
+		}
+	}
+
+	for _, s := range stats {
+		s.AvgVariantVal = float32(s.VariantSum) / float32(s.Variant)
+	}
+	return cr.Samples, stats, nil
+}
+
 // Parse parses a abv file based on given tile rules and returns all blocks.
 func Parse(
 	name string,
@@ -192,107 +242,95 @@ func Parse(
 	}
 	defer fr.Close()
 
+	rd, err := NewReader(fr)
+	if err != nil {
+		return nil, err
+	}
+	rd.DecodeTiles = true
+
+	// Seek to start band directly if up-to-date index has been built
+	// by command index, otherwise just skip bands from the beginning.
+	rd.minBand = r.StartBandIdx
+	if !rd.IsBinary() && r.StartBandIdx > 0 {
+		if idx, err := LoadIndex(name); err == nil {
+			if err = idx.Seek(fr, rd, r.StartBandIdx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return parseBands(rd, countOnly, r)
+}
+
+// ParseReader parses abv data of a human from given reader within given range,
+// in either text or binary format.
+func ParseReader(rd io.Reader, countOnly bool, r *base.Range) (*Human, error) {
+	ar, err := NewReader(rd)
+	if err != nil {
+		return nil, err
+	}
+	ar.DecodeTiles = true
+	ar.minBand = r.StartBandIdx
+	return parseBands(ar, countOnly, r)
+}
+
+// parseBands reads bands within given range from reader into a human.
+func parseBands(rd *Reader, countOnly bool, r *base.Range) (*Human, error) {
 	h := new(Human)
 	h.Blocks = make(map[int]map[int]*Block)
 	h.BandLength = make(map[int]int)
 
-	var bandIdx int // Current band index.
-	var colIdx int  // Current column index.
-	var char uint8  // Current char.
-
-	var line []byte
-	buf := bufio.NewReader(fr)
-
-	// To skip header e.g.: "huFE71F3"
-	_, errRead := buf.ReadBytes(' ')
-	if errRead != nil {
-		return nil, errRead
-	}
-
-	// True for next thing read will be actual body not band index.
-	isInBody := false
+	for {
+		b, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
 
-	for errRead != io.EOF {
-		line, errRead = buf.ReadBytes(' ')
-		line = bytes.TrimSpace(line)
+		if b.Index < r.StartBandIdx {
+			continue
+		} else if r.EndBandIdx >= 0 && b.Index > r.EndBandIdx {
+			break
+		} else if b.Index > h.MaxBand {
+			h.MaxBand = b.Index
+		}
 
-		if errRead != nil {
-			if errRead != io.EOF {
-				return nil, errRead
-			}
+		bandLen := len(b.Data)
+		if r.EndPosIdx >= 0 && bandLen > r.EndPosIdx+1 {
+			bandLen = r.EndPosIdx + 1
 		}
-		if len(line) == 0 {
-			isInBody = !isInBody
+		if bandLen-1 > h.MaxPos {
+			h.MaxPos = bandLen - 1
+		}
+		h.BandLength[b.Index] = bandLen
+
+		if countOnly {
 			continue
 		}
 
-		if !isInBody {
-			bandIdx, err = base.HexStr2int(string(line))
-			if err != nil {
-				fmt.Println(string(line))
-				return nil, err
+		for colIdx, tile := range b.Data[:bandLen] {
+			switch {
+			case tile == TILE_UNRECOGNIZE:
+				continue
+			case tileToChar[tile] == 0:
+				return nil, fmt.Errorf("invalid tile %d at band %s, column %d",
+					tile, base.Int2HexStr(b.Index), colIdx)
 			}
+			h.PosCount++
 
-			if r.EndBandIdx >= 0 && bandIdx > r.EndBandIdx {
-				break
-			} else if bandIdx > h.MaxBand {
-				h.MaxBand = bandIdx
+			if _, ok := h.Blocks[b.Index]; !ok {
+				h.Blocks[b.Index] = make(map[int]*Block)
 			}
-		} else {
-			for colIdx, char = range line {
-				if r.EndPosIdx >= 0 && colIdx > r.EndPosIdx {
-					colIdx--
-					break
-				}
-
-				if countOnly {
-					continue
-				}
-
-				varIdx := -1
-				switch char {
-				case '-': // Not recognize.
-					continue
-				case '#':
-					varIdx = 99
-				case '.': // Default variant.
-					varIdx = 0
-				default:
-					// Non-default variant.
-					varIdx = bytes.IndexByte(EncodeStd, char)
-					if varIdx < 1 {
-						return nil, fmt.Errorf("Invalid version of variant[%s]: %s", line, string(char))
-					}
-				}
-				h.PosCount++
-
-				b := &Block{
-					// Band: bandIdx,
-					// Pos:     i,
-					Variant: uint8(varIdx),
-				}
-				if _, ok := h.Blocks[bandIdx]; !ok {
-					h.Blocks[bandIdx] = make(map[int]*Block)
-				}
-				h.Blocks[bandIdx][colIdx] = b
-				// if _, ok := h.Blocks[b.Band]; !ok {
-				// 	h.Blocks[b.Band] = make(map[int]*Block)
-				// }
-				// h.Blocks[b.Band][b.Pos] = b
-
-				// r, ok := rules[b.Band][b.Pos][varIdx]
-				// if !ok {
-				// 	return nil, fmt.Errorf("Rule not found: %d.%d.%d", b.Band, b.Pos, varIdx)
-				// }
-				// b.Factor = r.Factor
+			h.Blocks[b.Index][colIdx] = &Block{
+				Variant: tile,
 			}
 
-			if colIdx > h.MaxPos {
-				h.MaxPos = colIdx
-			}
-			h.BandLength[bandIdx] = colIdx + 1
+			// r, ok := rules[b.Band][b.Pos][varIdx]
+			// if !ok {
+			// 	return nil, fmt.Errorf("Rule not found: %d.%d.%d", b.Band, b.Pos, varIdx)
+			// }
+			// b.Factor = r.Factor
 		}
-		isInBody = !isInBody
 	}
 
 	return h, nil
@@ -0,0 +1,24 @@
+package abv
+
+import (
+	"os"
+	"testing"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func BenchmarkStat(b *testing.B) {
+	dir, names := prepareBenchFiles(b)
+	defer os.RemoveAll(dir)
+
+	opt := base.Option{
+		Range:      &base.Range{EndBandIdx: 99, EndPosIdx: -1},
+		WindowSize: 100,
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := Stat(names[0], opt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package abvtest generates synthetic abv data for tests and benchmarks.
+package abvtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// Config represents shape and distribution of synthetic abv data.
+// Humans share band lengths and a reference of tiles, like humans
+// called against the same tile library.
+type Config struct {
+	Humans    int     // Number of humans.
+	Bands     int     // Number of bands.
+	BandSize  int     // Mean number of tiles of each band.
+	LenJitter float64 // Band lengths vary by up to this fraction of BandSize(0-1).
+	Variants  int     // Number of variants, up to len(abv.EncodeStd).
+	// Skew is Zipf exponent(> 1) of variant indexes, larger for fewer high variants.
+	Skew       float64
+	Divergence float64 // Rate of tiles that are drawn again instead of taken from reference(0-1).
+	NoCallRate float64 // Rate of unrecognized tiles('-').
+	PoundRate  float64 // Rate of '#' overflow tiles.
+	Seed       int64
+	Prefix     string // Prefix of names of humans.
+}
+
+// DefaultConfig is small enough to generate in tests.
+var DefaultConfig = Config{
+	Humans:     10,
+	Bands:      10,
+	BandSize:   50,
+	LenJitter:  0.2,
+	Variants:   16,
+	Skew:       1.5,
+	Divergence: 0.3,
+	NoCallRate: 0.02,
+	PoundRate:  0.01,
+	Seed:       1,
+	Prefix:     "hu",
+}
+
+// Generator generates the same abv data of humans for the same configuration.
+type Generator struct {
+	Config
+	bandLen []int
+	ref     [][]byte // Reference tiles of each band.
+}
+
+// New validates given configuration and returns a new generator.
+func New(cfg Config) (*Generator, error) {
+	switch {
+	case cfg.Humans < 1 || cfg.Bands < 1:
+		return nil, errors.New("number of humans and bands cannot be smaller than 1")
+	case cfg.BandSize < 0:
+		return nil, errors.New("band size cannot be negative")
+	case cfg.LenJitter < 0 || cfg.LenJitter > 1:
+		return nil, fmt.Errorf("length jitter has to be in 0-1: %v", cfg.LenJitter)
+	case cfg.Variants < 1 || cfg.Variants > len(abv.EncodeStd):
+		return nil, fmt.Errorf("number of variants has to be in 1-%d: %d", len(abv.EncodeStd), cfg.Variants)
+	case cfg.Skew <= 1:
+		return nil, fmt.Errorf("skew has to be greater than 1: %v", cfg.Skew)
+	case cfg.Divergence < 0 || cfg.Divergence > 1:
+		return nil, fmt.Errorf("divergence has to be in 0-1: %v", cfg.Divergence)
+	case cfg.NoCallRate < 0 || cfg.PoundRate < 0 || cfg.NoCallRate+cfg.PoundRate > 1:
+		return nil, fmt.Errorf("invalid no-call and '#' rates: %v, %v", cfg.NoCallRate, cfg.PoundRate)
+	}
+
+	g := &Generator{
+		Config:  cfg,
+		bandLen: make([]int, cfg.Bands),
+		ref:     make([][]byte, cfg.Bands),
+	}
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	vars := g.variants(rnd)
+	jitter := int(float64(cfg.BandSize) * cfg.LenJitter)
+	for i := range g.ref {
+		g.bandLen[i] = cfg.BandSize
+		if jitter > 0 {
+			g.bandLen[i] += rnd.Intn(2*jitter+1) - jitter
+		}
+		g.ref[i] = make([]byte, g.bandLen[i])
+		for j := range g.ref[i] {
+			g.ref[i][j] = abv.EncodeStd[vars.Uint64()]
+		}
+	}
+	return g, nil
+}
+
+// variants returns distribution of variant indexes, the default variant is the most common.
+func (g *Generator) variants(rnd *rand.Rand) *rand.Zipf {
+	return rand.NewZipf(rnd, g.Skew, 1, uint64(g.Variants-1))
+}
+
+// Name returns name of i-th human.
+func (g *Generator) Name(i int) string {
+	return fmt.Sprintf("%s%04d", g.Prefix, i)
+}
+
+// BandLength returns number of tiles of given band of every human.
+func (g *Generator) BandLength(band int) int {
+	return g.bandLen[band]
+}
+
+// BandsOf returns bands of i-th human, which do not depend on other humans.
+func (g *Generator) BandsOf(i int) []*abv.Band {
+	rnd := rand.New(rand.NewSource(g.Seed*1000003 + int64(i) + 1))
+	vars := g.variants(rnd)
+	bands := make([]*abv.Band, g.Bands)
+	for b, ref := range g.ref {
+		data := make([]byte, len(ref))
+		for j := range data {
+			switch u := rnd.Float64(); {
+			case u < g.NoCallRate:
+				data[j] = '-'
+			case u < g.NoCallRate+g.PoundRate:
+				data[j] = '#'
+			case rnd.Float64() < g.Divergence:
+				data[j] = abv.EncodeStd[vars.Uint64()]
+			default:
+				data[j] = ref[j]
+			}
+		}
+		bands[b] = &abv.Band{Index: b, Data: data}
+	}
+	return bands
+}
+
+// Write writes i-th human to given abv writer and closes it.
+func (g *Generator) Write(w abv.Writer, i int) error {
+	for _, b := range g.BandsOf(i) {
+		if err := w.WriteBand(b); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// Data returns i-th human in text abv format.
+func (g *Generator) Data(i int) []byte {
+	buf := new(bytes.Buffer)
+	g.Write(abv.NewWriter(buf, "\""+g.Name(i)+"\""), i)
+	return buf.Bytes()
+}
+
+// Reader returns reader of i-th human in text abv format.
+func (g *Generator) Reader(i int) io.Reader {
+	return bytes.NewReader(g.Data(i))
+}
+
+// Human returns i-th human parsed in full range, named as its abv file.
+func (g *Generator) Human(i int) (*abv.Human, error) {
+	h, err := abv.ParseReader(g.Reader(i), false, &base.Range{EndBandIdx: -1, EndPosIdx: -1})
+	if err != nil {
+		return nil, err
+	}
+	h.Name = g.Name(i) + ".abv"
+	return h, nil
+}
+
+// WriteFiles saves every human as an abv file of given format(text or binary)
+// in given directory, and returns their paths.
+func (g *Generator) WriteFiles(dir, format string, compress bool) ([]string, error) {
+	if format != "text" && format != "binary" {
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, g.Humans)
+	for i := range names {
+		names[i] = path.Join(dir, g.Name(i)+".abv")
+		if err := g.writeFile(names[i], format, compress, i); err != nil {
+			return nil, fmt.Errorf("%s: %v", names[i], err)
+		}
+	}
+	return names, nil
+}
+
+func (g *Generator) writeFile(name, format string, compress bool, i int) error {
+	fw, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	var w abv.Writer
+	header := "\"" + g.Name(i) + "\""
+	if format == "binary" {
+		w = abv.NewBinaryWriter(fw, header, compress)
+	} else {
+		w = abv.NewWriter(fw, header)
+	}
+	if err = g.Write(w, i); err != nil {
+		return err
+	}
+	return fw.Close()
+}
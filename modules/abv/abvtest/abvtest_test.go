@@ -0,0 +1,115 @@
+package abvtest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func Test_Generator(t *testing.T) {
+	Convey("Generate the same humans for the same seed", t, func() {
+		g1, err := New(DefaultConfig)
+		So(err, ShouldBeNil)
+		cfg := DefaultConfig
+		cfg.Humans = 5
+		g2, err := New(cfg)
+		So(err, ShouldBeNil)
+		So(g1.Data(3), ShouldResemble, g2.Data(3))
+		So(g1.Data(3), ShouldNotResemble, g1.Data(4))
+
+		cfg.Seed = 2
+		g3, err := New(cfg)
+		So(err, ShouldBeNil)
+		So(g1.Data(3), ShouldNotResemble, g3.Data(3))
+	})
+
+	Convey("Generate tiles of configured distribution", t, func() {
+		cfg := DefaultConfig
+		cfg.Bands, cfg.BandSize = 5, 2000
+		cfg.NoCallRate, cfg.PoundRate = 0.05, 0.02
+		g, err := New(cfg)
+		So(err, ShouldBeNil)
+
+		h, err := g.Human(0)
+		So(err, ShouldBeNil)
+		So(h.Name, ShouldEqual, "hu0000.abv")
+		So(h.MaxBand, ShouldEqual, 4)
+
+		total := 0
+		counts := make(map[int]int)
+		for i := 0; i <= h.MaxBand; i++ {
+			So(h.BandLength[i], ShouldEqual, g.BandLength(i))
+			So(g.BandLength(i), ShouldBeBetweenOrEqual, 1600, 2400)
+			total += h.BandLength[i]
+			for j := 0; j < h.BandLength[i]; j++ {
+				b, ok := h.Blocks[i][j]
+				switch {
+				case !ok:
+					counts[base.VAR_UNRECOGNIZE]++
+				case b.Variant == abv.TILE_POUND:
+					counts[base.VAR_POUND]++
+				default:
+					So(b.Variant, ShouldBeLessThan, cfg.Variants)
+					counts[int(b.Variant)]++
+				}
+			}
+		}
+		So(float64(counts[base.VAR_UNRECOGNIZE])/float64(total), ShouldAlmostEqual, 0.05, 0.01)
+		So(float64(counts[base.VAR_POUND])/float64(total), ShouldAlmostEqual, 0.02, 0.01)
+		for i := 1; i < cfg.Variants; i++ {
+			So(counts[0], ShouldBeGreaterThan, counts[i])
+		}
+	})
+
+	Convey("Save humans in text and binary format", t, func() {
+		dir, err := ioutil.TempDir("", "tr")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		cfg := DefaultConfig
+		cfg.Humans = 2
+		g, err := New(cfg)
+		So(err, ShouldBeNil)
+		for _, format := range []string{"text", "binary"} {
+			names, err := g.WriteFiles(dir+"/"+format, format, true)
+			So(err, ShouldBeNil)
+			So(len(names), ShouldEqual, 2)
+
+			want, err := g.Human(1)
+			So(err, ShouldBeNil)
+			h, err := abv.Parse(names[1], false, &base.Range{EndBandIdx: -1, EndPosIdx: -1}, nil)
+			So(err, ShouldBeNil)
+			So(h.BandLength, ShouldResemble, want.BandLength)
+			So(h.Blocks, ShouldResemble, want.Blocks)
+		}
+
+		_, err = g.WriteFiles(dir, "json", false)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Refuse invalid configuration", t, func() {
+		for _, change := range []func(*Config){
+			func(c *Config) { c.Bands = 0 },
+			func(c *Config) { c.Variants = len(abv.EncodeStd) + 1 },
+			func(c *Config) { c.Skew = 1 },
+			func(c *Config) { c.NoCallRate, c.PoundRate = 0.6, 0.6 },
+		} {
+			cfg := DefaultConfig
+			change(&cfg)
+			_, err := New(cfg)
+			So(err, ShouldNotBeNil)
+		}
+
+		cfg := DefaultConfig
+		cfg.Variants, cfg.Divergence = 1, 1
+		g, err := New(cfg)
+		So(err, ShouldBeNil)
+		So(bytes.Trim(g.BandsOf(0)[0].Data, ".-#"), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,257 @@
+package abv
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// Binary abv format:
+//
+//	magic       "ABVB"
+//	version     1 byte
+//	flags       1 byte, FLAG_COMPRESS means every band is compressed by flate
+//	header      uvarint length + bytes, e.g.: "huFE71F3"
+//	band count  uvarint
+//	band table  for each band: uvarint index, uvarint tile count, uvarint stored size
+//	bands       stored bytes of each band in order of band table,
+//	            one byte per tile before compression
+//
+// Each tile byte is the variant index in EncodeStd, TILE_POUND for '#'
+// or TILE_UNRECOGNIZE for '-'.
+
+const BINARY_MAGIC = "ABVB"
+
+const BINARY_VERSION = 1
+
+const (
+	FLAG_COMPRESS = 1 << iota
+)
+
+// Header and band table are read into memory before any band,
+// so corrupted lengths are bounded instead of exhausting it.
+const (
+	maxHeaderLen = 1 << 16
+	maxBandNum   = 1 << 20
+	maxBandLen   = 1 << 28
+)
+
+const (
+	TILE_POUND       = 99
+	TILE_UNRECOGNIZE = 255
+)
+
+var (
+	charToTile [256]int // -1 for invalid character.
+	tileToChar [256]byte
+)
+
+func init() {
+	for i := range charToTile {
+		charToTile[i] = -1
+	}
+	for i, char := range EncodeStd {
+		charToTile[char] = i
+		tileToChar[i] = char
+	}
+	charToTile['#'] = TILE_POUND
+	tileToChar[TILE_POUND] = '#'
+	charToTile['-'] = TILE_UNRECOGNIZE
+	tileToChar[TILE_UNRECOGNIZE] = '-'
+}
+
+// IsBinary returns true if given leading bytes are magic of binary abv format.
+func IsBinary(magic []byte) bool {
+	return bytes.Equal(magic, []byte(BINARY_MAGIC))
+}
+
+// binaryBand represents an entry of band table in binary abv format.
+type binaryBand struct {
+	Index int
+	Len   int // Number of tiles.
+	Size  int // Number of stored bytes.
+}
+
+// readBinaryHeader reads header and band table of binary abv format.
+func (r *Reader) readBinaryHeader() error {
+	head := make([]byte, len(BINARY_MAGIC)+2)
+	if _, err := io.ReadFull(r.buf, head); err != nil {
+		return err
+	} else if head[len(BINARY_MAGIC)] != BINARY_VERSION {
+		return fmt.Errorf("unsupported binary version: %d", head[len(BINARY_MAGIC)])
+	}
+	r.compressed = head[len(BINARY_MAGIC)+1]&FLAG_COMPRESS > 0
+
+	size, err := binary.ReadUvarint(r.buf)
+	if err != nil {
+		return err
+	} else if size > maxHeaderLen {
+		return fmt.Errorf("header is too large: %d", size)
+	}
+	header := make([]byte, size)
+	if _, err = io.ReadFull(r.buf, header); err != nil {
+		return err
+	}
+	r.Header = string(header)
+
+	num, err := binary.ReadUvarint(r.buf)
+	if err != nil {
+		return err
+	} else if num > maxBandNum {
+		return fmt.Errorf("too many bands: %d", num)
+	}
+	r.table = make([]binaryBand, num)
+	for i := range r.table {
+		var vals [3]uint64
+		for j := range vals {
+			if vals[j], err = binary.ReadUvarint(r.buf); err != nil {
+				return fmt.Errorf("fail to read band table: %v", err)
+			} else if vals[j] > maxBandLen {
+				return fmt.Errorf("entry %d of band table is too large: %d", i, vals[j])
+			}
+		}
+		bb := binaryBand{int(vals[0]), int(vals[1]), int(vals[2])}
+		if !r.compressed && bb.Len != bb.Size {
+			return fmt.Errorf("band %s has %d tiles but %d bytes stored",
+				base.Int2HexStr(bb.Index), bb.Len, bb.Size)
+		}
+		r.table[i] = bb
+	}
+	return nil
+}
+
+// nextBinary returns next band of binary abv format.
+func (r *Reader) nextBinary() (*Band, error) {
+	for ; r.tableIdx < len(r.table); r.tableIdx++ {
+		bb := r.table[r.tableIdx]
+		if bb.Index >= r.minBand {
+			break
+		}
+		if _, err := r.buf.Discard(bb.Size); err != nil {
+			return nil, err
+		}
+	}
+	if r.tableIdx == len(r.table) {
+		return nil, io.EOF
+	}
+	bb := r.table[r.tableIdx]
+	r.tableIdx++
+
+	var src io.Reader = io.LimitReader(r.buf, int64(bb.Size))
+	if r.compressed {
+		// Reuse decompressor to save allocation for every band.
+		if r.inflater == nil {
+			r.inflater = flate.NewReader(src)
+		} else if err := r.inflater.(flate.Resetter).Reset(src, nil); err != nil {
+			return nil, err
+		}
+		src = r.inflater
+	}
+
+	data := make([]byte, bb.Len)
+	if _, err := io.ReadFull(src, data); err != nil {
+		return nil, fmt.Errorf("band %s: fail to read tiles: %v", base.Int2HexStr(bb.Index), err)
+	}
+	if r.compressed {
+		// Drain rest of compressed stream.
+		io.Copy(ioutil.Discard, src)
+	}
+
+	if !r.DecodeTiles {
+		for i, tile := range data {
+			if data[i] = tileToChar[tile]; data[i] == 0 {
+				return nil, fmt.Errorf("invalid tile %d at band %s, column %d",
+					tile, base.Int2HexStr(bb.Index), i)
+			}
+		}
+	}
+	return &Band{Index: bb.Index, Data: data, Offset: -1}, nil
+}
+
+// BinaryWriter writes abv data in binary format.
+// Because band table is in front of all bands, data is kept
+// in memory and only written to underlying writer on Close.
+type BinaryWriter struct {
+	w        io.Writer
+	header   string
+	compress bool
+	table    []binaryBand
+	bands    bytes.Buffer
+}
+
+// NewBinaryWriter returns a new writer of binary abv format.
+func NewBinaryWriter(w io.Writer, header string, compress bool) *BinaryWriter {
+	return &BinaryWriter{
+		w:        w,
+		header:   header,
+		compress: compress,
+		table:    make([]binaryBand, 0, 1000),
+	}
+}
+
+func (bw *BinaryWriter) WriteBand(b *Band) error {
+	tiles := make([]byte, len(b.Data))
+	for i, char := range b.Data {
+		tile := charToTile[char]
+		if tile < 0 {
+			return fmt.Errorf("invalid character '%c' at band %s, column %d",
+				char, base.Int2HexStr(b.Index), i)
+		}
+		tiles[i] = byte(tile)
+	}
+
+	start := bw.bands.Len()
+	if bw.compress {
+		fw, err := flate.NewWriter(&bw.bands, flate.BestSpeed)
+		if err != nil {
+			return err
+		}
+		fw.Write(tiles)
+		if err = fw.Close(); err != nil {
+			return err
+		}
+	} else {
+		bw.bands.Write(tiles)
+	}
+
+	bw.table = append(bw.table, binaryBand{b.Index, len(tiles), bw.bands.Len() - start})
+	return nil
+}
+
+// Close writes header, band table and all bands to underlying writer.
+func (bw *BinaryWriter) Close() error {
+	w := bufio.NewWriter(bw.w)
+
+	var flags byte
+	if bw.compress {
+		flags |= FLAG_COMPRESS
+	}
+	w.WriteString(BINARY_MAGIC)
+	w.WriteByte(BINARY_VERSION)
+	w.WriteByte(flags)
+
+	varint := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v int) {
+		w.Write(varint[:binary.PutUvarint(varint, uint64(v))])
+	}
+	writeUvarint(len(bw.header))
+	w.WriteString(bw.header)
+
+	writeUvarint(len(bw.table))
+	for _, bb := range bw.table {
+		writeUvarint(bb.Index)
+		writeUvarint(bb.Len)
+		writeUvarint(bb.Size)
+	}
+
+	if _, err := bw.bands.WriteTo(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
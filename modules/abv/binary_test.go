@@ -0,0 +1,213 @@
+package abv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// randomBands returns bands with random tiles for testing.
+func randomBands(bandNum, bandLen int) []*Band {
+	r := rand.New(rand.NewSource(1))
+	chars := append([]byte("-#"), EncodeStd...)
+	bands := make([]*Band, bandNum)
+	for i := range bands {
+		bands[i] = &Band{Index: i, Data: make([]byte, bandLen)}
+		for j := range bands[i].Data {
+			// Most tiles are default variant.
+			if r.Intn(4) == 0 {
+				bands[i].Data[j] = chars[r.Intn(len(chars))]
+			} else {
+				bands[i].Data[j] = '.'
+			}
+		}
+	}
+	return bands
+}
+
+func writeBands(w Writer, bands []*Band) error {
+	for _, b := range bands {
+		if err := w.WriteBand(b); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func readBands(rd io.Reader) (string, []*Band, error) {
+	r, err := NewReader(rd)
+	if err != nil {
+		return "", nil, err
+	}
+
+	bands := make([]*Band, 0, 10)
+	for {
+		b, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", nil, err
+		}
+		bands = append(bands, b)
+	}
+	return r.Header, bands, nil
+}
+
+func Test_BinaryFormat(t *testing.T) {
+	bands := randomBands(10, 500)
+
+	Convey("Convert between text and binary format", t, func() {
+		for _, compress := range []bool{false, true} {
+			buf := new(bytes.Buffer)
+			So(writeBands(NewBinaryWriter(buf, `"huFE71F3"`, compress), bands), ShouldBeNil)
+			So(IsBinary(buf.Bytes()[:len(BINARY_MAGIC)]), ShouldBeTrue)
+
+			header, binBands, err := readBands(buf)
+			So(err, ShouldBeNil)
+			So(header, ShouldEqual, `"huFE71F3"`)
+			So(len(binBands), ShouldEqual, len(bands))
+
+			buf.Reset()
+			So(writeBands(NewWriter(buf, header), binBands), ShouldBeNil)
+			_, textBands, err := readBands(buf)
+			So(err, ShouldBeNil)
+			for i := range bands {
+				So(textBands[i].Index, ShouldEqual, bands[i].Index)
+				So(string(textBands[i].Data), ShouldEqual, string(bands[i].Data))
+			}
+		}
+	})
+}
+
+func Test_CorruptedBinary(t *testing.T) {
+	Convey("Refuse corrupted binary header and band table", t, func() {
+		// Builds binary abv data of given flags followed by given uvarints.
+		data := func(flags byte, vals ...uint64) []byte {
+			buf := append([]byte(BINARY_MAGIC), BINARY_VERSION, flags)
+			for _, v := range vals {
+				var tmp [binary.MaxVarintLen64]byte
+				buf = append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+			}
+			return buf
+		}
+
+		for _, buf := range [][]byte{
+			data(0, 1<<64-1),
+			data(0, maxHeaderLen+1),
+			data(0, 5, 'h', 'u'),
+			data(0, 0, 1<<64-1),
+			data(0, 0, maxBandNum+1),
+			data(0, 0, 2, 0, 1, 1),
+			data(0, 0, 1, 0, 1<<64-1, 1<<64-1),
+			data(0, 0, 1, 0, maxBandLen+1, maxBandLen+1),
+			data(0, 0, 1, 0, 10, 1),
+			data(FLAG_COMPRESS, 0, 1, 1<<64-1, 1, 1),
+		} {
+			_, _, err := readBands(bytes.NewReader(buf))
+			So(err, ShouldNotBeNil)
+		}
+
+		header, bands, err := readBands(bytes.NewReader(append(data(0, 2, 'h', 'u', 1, 0, 2, 2), 1, 2)))
+		So(err, ShouldBeNil)
+		So(header, ShouldEqual, "hu")
+		So(string(bands[0].Data), ShouldEqual, "DE")
+	})
+}
+
+// prepareBenchFiles saves same random bands in text, binary and compressed binary format.
+func prepareBenchFiles(b *testing.B) (string, []string) {
+	dir, err := ioutil.TempDir("", "abv")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	bands := randomBands(100, 4000)
+	names := []string{path.Join(dir, "text.abv"), path.Join(dir, "binary.abv"), path.Join(dir, "compressed.abv")}
+	for i, name := range names {
+		fw, err := os.Create(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		var w Writer
+		switch i {
+		case 0:
+			w = NewWriter(fw, "huFE71F3")
+		default:
+			w = NewBinaryWriter(fw, "huFE71F3", i == 2)
+		}
+		if err = writeBands(w, bands); err != nil {
+			b.Fatal(err)
+		}
+		fw.Close()
+	}
+	return dir, names
+}
+
+func benchmarkParse(b *testing.B, i int) {
+	dir, names := prepareBenchFiles(b)
+	defer os.RemoveAll(dir)
+
+	r := &base.Range{EndBandIdx: -1, EndPosIdx: -1}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := Parse(names[i], false, r, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseText(b *testing.B)             { benchmarkParse(b, 0) }
+func BenchmarkParseBinary(b *testing.B)           { benchmarkParse(b, 1) }
+func BenchmarkParseBinaryCompressed(b *testing.B) { benchmarkParse(b, 2) }
+
+// readTiles reads all bands as decoded tiles.
+func readTiles(rd io.Reader) (int, error) {
+	r, err := NewReader(rd)
+	if err != nil {
+		return 0, err
+	}
+	r.DecodeTiles = true
+
+	tiles := 0
+	for {
+		b, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		tiles += len(b.Data)
+	}
+	return tiles, nil
+}
+
+func benchmarkRead(b *testing.B, i int) {
+	dir, names := prepareBenchFiles(b)
+	defer os.RemoveAll(dir)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		fr, err := os.Open(names[i])
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = readTiles(fr); err != nil {
+			b.Fatal(err)
+		}
+		fr.Close()
+	}
+}
+
+func BenchmarkReadText(b *testing.B)             { benchmarkRead(b, 0) }
+func BenchmarkReadBinary(b *testing.B)           { benchmarkRead(b, 1) }
+func BenchmarkReadBinaryCompressed(b *testing.B) { benchmarkRead(b, 2) }
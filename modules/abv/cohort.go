@@ -0,0 +1,508 @@
+package abv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// Cohort format stores many humans band-major, so that cohort operations
+// only need a single sequential scan:
+//
+//	magic       "ABVC"
+//	version     1 byte
+//	samples     uvarint count, for each sample: uvarint length + name
+//	band table  uvarint count, for each band: uvarint index,
+//	            and uvarint tile count plus one of each sample,
+//	            0 when sample does not have the band
+//	bands       for each band in order of band table, tiles of
+//	            each sample in order of sample list
+//
+// Tiles are encoded in the same way as binary abv format.
+
+const COHORT_MAGIC = "ABVC"
+
+const COHORT_VERSION = 1
+
+// IsCohort returns true if given leading bytes are magic of cohort format.
+func IsCohort(magic []byte) bool {
+	return bytes.Equal(magic, []byte(COHORT_MAGIC))
+}
+
+// IsCohortFile returns true if given path is a file in cohort format.
+func IsCohortFile(name string) bool {
+	return hasMagic(name, COHORT_MAGIC)
+}
+
+// CohortBandInfo represents an entry of band table in cohort format.
+type CohortBandInfo struct {
+	Index int
+	Lens  []int // Number of tiles of each sample, -1 when sample does not have the band.
+}
+
+// CohortBand represents tiles of all samples in a band.
+type CohortBand struct {
+	Index int
+	Tiles [][]byte // Decoded tiles of each sample, nil when sample does not have the band.
+}
+
+// CohortReader reads cohort data band by band.
+type CohortReader struct {
+	buf     *bufio.Reader
+	Samples []string
+	Bands   []CohortBandInfo
+	bandIdx int
+}
+
+// NewCohortReader reads sample list and band table from given reader
+// and returns a new cohort reader.
+func NewCohortReader(rd io.Reader) (*CohortReader, error) {
+	cr := &CohortReader{buf: bufio.NewReader(rd)}
+
+	head := make([]byte, len(COHORT_MAGIC)+1)
+	if _, err := io.ReadFull(cr.buf, head); err != nil {
+		return nil, err
+	} else if !IsCohort(head[:len(COHORT_MAGIC)]) {
+		return nil, fmt.Errorf("not a cohort file")
+	}
+	version := head[len(COHORT_MAGIC)]
+	if version != COHORT_VERSION {
+		return nil, fmt.Errorf("unsupported cohort version: %d", version)
+	}
+
+	num, err := binary.ReadUvarint(cr.buf)
+	if err != nil {
+		return nil, err
+	} else if num > maxBandNum {
+		return nil, fmt.Errorf("too many samples: %d", num)
+	}
+	cr.Samples = make([]string, num)
+	for i := range cr.Samples {
+		size, err := binary.ReadUvarint(cr.buf)
+		if err != nil {
+			return nil, err
+		} else if size > maxHeaderLen {
+			return nil, fmt.Errorf("name of sample %d is too large: %d", i, size)
+		}
+		name := make([]byte, size)
+		if _, err = io.ReadFull(cr.buf, name); err != nil {
+			return nil, err
+		}
+		cr.Samples[i] = string(name)
+	}
+
+	if num, err = binary.ReadUvarint(cr.buf); err != nil {
+		return nil, err
+	} else if num > maxBandNum {
+		return nil, fmt.Errorf("too many bands: %d", num)
+	}
+	cr.Bands = make([]CohortBandInfo, num)
+	for i := range cr.Bands {
+		idx, err := binary.ReadUvarint(cr.buf)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read band table: %v", err)
+		} else if idx > maxBandLen {
+			return nil, fmt.Errorf("index of band table entry %d is too large: %d", i, idx)
+		}
+		cr.Bands[i].Index = int(idx)
+		cr.Bands[i].Lens = make([]int, len(cr.Samples))
+		for j := range cr.Samples {
+			l, err := binary.ReadUvarint(cr.buf)
+			if err != nil {
+				return nil, fmt.Errorf("fail to read band table: %v", err)
+			} else if l > maxBandLen+1 {
+				return nil, fmt.Errorf("band %s of sample %d is too large: %d",
+					base.Int2HexStr(int(idx)), j, l)
+			}
+			cr.Bands[i].Lens[j] = int(l) - 1
+		}
+	}
+	return cr, nil
+}
+
+// Next returns next band in the stream, it returns io.EOF when no more bands.
+func (cr *CohortReader) Next() (*CohortBand, error) {
+	if cr.bandIdx == len(cr.Bands) {
+		return nil, io.EOF
+	}
+	info := cr.Bands[cr.bandIdx]
+	cr.bandIdx++
+
+	cb := &CohortBand{
+		Index: info.Index,
+		Tiles: make([][]byte, len(cr.Samples)),
+	}
+	for i, l := range info.Lens {
+		if l < 0 {
+			continue
+		}
+		cb.Tiles[i] = make([]byte, l)
+		if _, err := io.ReadFull(cr.buf, cb.Tiles[i]); err != nil {
+			return nil, fmt.Errorf("band %s: fail to read tiles of %s: %v",
+				base.Int2HexStr(info.Index), cr.Samples[i], err)
+		}
+	}
+	return cb, nil
+}
+
+// SampleIndex returns index of given sample name, or -1 if it does not exist.
+func (cr *CohortReader) SampleIndex(name string) int {
+	for i := range cr.Samples {
+		if cr.Samples[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// CohortWriter writes cohort data band by band.
+type CohortWriter struct {
+	w     *bufio.Writer
+	bands []CohortBandInfo
+	next  int
+}
+
+// NewCohortWriter writes sample list and band table to given writer
+// and returns a new cohort writer. Bands must be written in the same
+// order and with the same lengths as given band table.
+func NewCohortWriter(w io.Writer, samples []string, bands []CohortBandInfo) *CohortWriter {
+	cw := &CohortWriter{
+		w:     bufio.NewWriter(w),
+		bands: bands,
+	}
+
+	cw.w.WriteString(COHORT_MAGIC)
+	cw.w.WriteByte(COHORT_VERSION)
+
+	varint := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v int) {
+		cw.w.Write(varint[:binary.PutUvarint(varint, uint64(v))])
+	}
+	writeUvarint(len(samples))
+	for _, name := range samples {
+		writeUvarint(len(name))
+		cw.w.WriteString(name)
+	}
+	writeUvarint(len(bands))
+	for _, info := range bands {
+		writeUvarint(info.Index)
+		for _, l := range info.Lens {
+			writeUvarint(l + 1)
+		}
+	}
+	return cw
+}
+
+func (cw *CohortWriter) WriteBand(cb *CohortBand) error {
+	if cw.next == len(cw.bands) {
+		return fmt.Errorf("band %s: not in band table", base.Int2HexStr(cb.Index))
+	}
+	info := cw.bands[cw.next]
+	cw.next++
+
+	if cb.Index != info.Index {
+		return fmt.Errorf("band %s: expect band %s by band table",
+			base.Int2HexStr(cb.Index), base.Int2HexStr(info.Index))
+	}
+	for i, tiles := range cb.Tiles {
+		if l := info.Lens[i]; l < 0 && tiles != nil {
+			return fmt.Errorf("band %s: expect no band of sample %d but got %d tiles",
+				base.Int2HexStr(cb.Index), i, len(tiles))
+		} else if l >= 0 && len(tiles) != l {
+			return fmt.Errorf("band %s: expect %d tiles of sample %d but got %d",
+				base.Int2HexStr(cb.Index), l, i, len(tiles))
+		}
+		cw.w.Write(tiles)
+	}
+	return nil
+}
+
+// Close flushes all data but does not close underlying writer.
+func (cw *CohortWriter) Close() error {
+	if cw.next != len(cw.bands) {
+		return fmt.Errorf("only %d of %d bands are written", cw.next, len(cw.bands))
+	}
+	return cw.w.Flush()
+}
+
+// hasMagic returns true if given file starts with given magic bytes.
+func hasMagic(name, magic string) bool {
+	fr, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer fr.Close()
+
+	head := make([]byte, len(magic))
+	if _, err = io.ReadFull(fr, head); err != nil {
+		return false
+	}
+	return string(head) == magic
+}
+
+// decodeToChars converts decoded tiles back to raw characters.
+func decodeToChars(tiles []byte) []byte {
+	chars := make([]byte, len(tiles))
+	for i, tile := range tiles {
+		chars[i] = tileToChar[tile]
+	}
+	return chars
+}
+
+// mergeBatch is max number of files MergeCohort reads at the same time,
+// it has to be at least 2.
+var mergeBatch = 64
+
+// MergeCohort reads given abv files and writes them in cohort format
+// with given sample names. Files are merged in batches into temporary
+// cohort files when there are more than mergeBatch of them.
+func MergeCohort(w io.Writer, samples, names []string) error {
+	if len(samples) != len(names) {
+		return fmt.Errorf("%d sample names for %d abv files", len(samples), len(names))
+	}
+	if len(names) <= mergeBatch {
+		return mergeAbvFiles(w, samples, names)
+	}
+
+	dir, err := ioutil.TempDir("", "abvc")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	parts := make([]string, 0, len(names)/mergeBatch+1)
+	for i := 0; i < len(names); i += mergeBatch {
+		j := i + mergeBatch
+		if j > len(names) {
+			j = len(names)
+		}
+		part := path.Join(dir, fmt.Sprintf("%d.abvc", len(parts)))
+		if err = createCohortFile(part, func(w io.Writer) error {
+			return mergeAbvFiles(w, samples[i:j], names[i:j])
+		}); err != nil {
+			return err
+		}
+		parts = append(parts, part)
+	}
+
+	// Merge temporary cohort files in the same way until there are
+	// few enough to read at the same time.
+	for round := 0; len(parts) > mergeBatch; round++ {
+		next := make([]string, 0, len(parts)/mergeBatch+1)
+		for i := 0; i < len(parts); i += mergeBatch {
+			j := i + mergeBatch
+			if j > len(parts) {
+				j = len(parts)
+			}
+			part := path.Join(dir, fmt.Sprintf("%d-%d.abvc", round, len(next)))
+			if err = createCohortFile(part, func(w io.Writer) error {
+				return mergeCohortFiles(w, parts[i:j])
+			}); err != nil {
+				return err
+			}
+			next = append(next, part)
+		}
+		for _, part := range parts {
+			os.Remove(part)
+		}
+		parts = next
+	}
+	return mergeCohortFiles(w, parts)
+}
+
+// createCohortFile creates file of given name and writes it by given function.
+func createCohortFile(name string, write func(io.Writer) error) error {
+	fw, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	if err = write(fw); err != nil {
+		return err
+	}
+	return fw.Close()
+}
+
+// cohortBands returns band table of given band lengths in order of band index.
+func cohortBands(bandLens map[int][]int) []CohortBandInfo {
+	idxs := make([]int, 0, len(bandLens))
+	for idx := range bandLens {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+	bands := make([]CohortBandInfo, len(idxs))
+	for i, idx := range idxs {
+		bands[i] = CohortBandInfo{idx, bandLens[idx]}
+	}
+	return bands
+}
+
+// missingLens returns band lengths of given number of samples that do not have the band.
+func missingLens(num int) []int {
+	lens := make([]int, num)
+	for i := range lens {
+		lens[i] = -1
+	}
+	return lens
+}
+
+// mergeAbvFiles reads all given abv files at the same time and writes them in cohort format.
+func mergeAbvFiles(w io.Writer, samples, names []string) error {
+	// First pass, collect band lengths of every sample.
+	bandLens := make(map[int][]int)
+	for i, name := range names {
+		if err := scanBandLength(name, func(idx, l int) {
+			if _, ok := bandLens[idx]; !ok {
+				bandLens[idx] = missingLens(len(names))
+			}
+			bandLens[idx][i] = l
+		}); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	bands := cohortBands(bandLens)
+
+	// Second pass, read all abv files band by band at the same time.
+	readers := make([]*Reader, len(names))
+	nexts := make([]*Band, len(names))
+	for i, name := range names {
+		fr, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+
+		if readers[i], err = NewReader(fr); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		readers[i].DecodeTiles = true
+	}
+
+	cw := NewCohortWriter(w, samples, bands)
+	for _, info := range bands {
+		cb := &CohortBand{
+			Index: info.Index,
+			Tiles: make([][]byte, len(names)),
+		}
+		for i, rd := range readers {
+			if nexts[i] == nil {
+				b, err := rd.Next()
+				if err != nil && err != io.EOF {
+					return fmt.Errorf("%s: %v", names[i], err)
+				}
+				nexts[i] = b
+			}
+
+			// Sample does not have this band.
+			if nexts[i] == nil || nexts[i].Index != info.Index {
+				continue
+			}
+			cb.Tiles[i] = nexts[i].Data
+			if cb.Tiles[i] == nil {
+				cb.Tiles[i] = []byte{}
+			}
+			nexts[i] = nil
+		}
+
+		if err := cw.WriteBand(cb); err != nil {
+			return err
+		}
+	}
+	return cw.Close()
+}
+
+// mergeCohortFiles reads all given cohort files at the same time and writes
+// their samples in one cohort file.
+func mergeCohortFiles(w io.Writer, names []string) error {
+	readers := make([]*CohortReader, len(names))
+	var samples []string
+	for i, name := range names {
+		fr, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+
+		if readers[i], err = NewCohortReader(fr); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		samples = append(samples, readers[i].Samples...)
+	}
+
+	bandLens := make(map[int][]int)
+	offset := 0
+	for _, cr := range readers {
+		for _, info := range cr.Bands {
+			if _, ok := bandLens[info.Index]; !ok {
+				bandLens[info.Index] = missingLens(len(samples))
+			}
+			copy(bandLens[info.Index][offset:], info.Lens)
+		}
+		offset += len(cr.Samples)
+	}
+	bands := cohortBands(bandLens)
+
+	cw := NewCohortWriter(w, samples, bands)
+	for _, info := range bands {
+		cb := &CohortBand{
+			Index: info.Index,
+			Tiles: make([][]byte, 0, len(samples)),
+		}
+		for i, cr := range readers {
+			// Cohort does not have this band.
+			if cr.bandIdx == len(cr.Bands) || cr.Bands[cr.bandIdx].Index != info.Index {
+				cb.Tiles = append(cb.Tiles, make([][]byte, len(cr.Samples))...)
+				continue
+			}
+
+			next, err := cr.Next()
+			if err != nil {
+				return fmt.Errorf("%s: %v", names[i], err)
+			}
+			cb.Tiles = append(cb.Tiles, next.Tiles...)
+		}
+
+		if err := cw.WriteBand(cb); err != nil {
+			return err
+		}
+	}
+	return cw.Close()
+}
+
+// scanBandLength calls given function with index and length of every band in abv file,
+// bands must be in ascending order.
+func scanBandLength(name string, fn func(idx, l int)) error {
+	fr, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	rd, err := NewReader(fr)
+	if err != nil {
+		return err
+	}
+	last := -1
+	for {
+		b, err := rd.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		} else if b.Index <= last {
+			return fmt.Errorf("band %s: out of order after band %s",
+				base.Int2HexStr(b.Index), base.Int2HexStr(last))
+		}
+		last = b.Index
+		fn(b.Index, len(b.Data))
+	}
+}
@@ -0,0 +1,138 @@
+package abv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_MergeCohort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "abv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Second sample lacks the first band.
+	bands := randomBands(5, 100)
+	samples := []string{"hu1", "hu2"}
+	names := []string{path.Join(dir, "hu1.abv"), path.Join(dir, "hu2.abv")}
+	for i, name := range names {
+		fw, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = writeBands(NewWriter(fw, samples[i]), bands[i:]); err != nil {
+			t.Fatal(err)
+		}
+		fw.Close()
+	}
+
+	Convey("Merge abv files into cohort format", t, func() {
+		buf := new(bytes.Buffer)
+		So(MergeCohort(buf, samples, names), ShouldBeNil)
+
+		cr, err := NewCohortReader(buf)
+		So(err, ShouldBeNil)
+		So(cr.Samples, ShouldResemble, samples)
+		So(cr.SampleIndex("hu2"), ShouldEqual, 1)
+		So(len(cr.Bands), ShouldEqual, len(bands))
+
+		for i := range bands {
+			cb, err := cr.Next()
+			So(err, ShouldBeNil)
+			So(cb.Index, ShouldEqual, bands[i].Index)
+			So(string(decodeToChars(cb.Tiles[0])), ShouldEqual, string(bands[i].Data))
+			if i == 0 {
+				So(cr.Bands[i].Lens[1], ShouldEqual, -1)
+				So(cb.Tiles[1], ShouldBeNil)
+			} else {
+				So(string(decodeToChars(cb.Tiles[1])), ShouldEqual, string(bands[i].Data))
+			}
+		}
+		_, err = cr.Next()
+		So(err, ShouldEqual, io.EOF)
+	})
+
+	Convey("Tell empty bands from missing bands", t, func() {
+		name := path.Join(dir, "empty.abv")
+		fw, err := os.Create(name)
+		So(err, ShouldBeNil)
+		So(writeBands(NewWriter(fw, "empty"), []*Band{{Index: 1, Data: []byte{}}}), ShouldBeNil)
+		fw.Close()
+
+		buf := new(bytes.Buffer)
+		So(MergeCohort(buf, []string{"hu1", "empty"}, []string{names[0], name}), ShouldBeNil)
+		cr, err := NewCohortReader(buf)
+		So(err, ShouldBeNil)
+		So(cr.Bands[0].Lens[1], ShouldEqual, -1)
+		So(cr.Bands[1].Lens[1], ShouldEqual, 0)
+
+		cb, err := cr.Next()
+		So(err, ShouldBeNil)
+		So(cb.Tiles[1], ShouldBeNil)
+		cb, err = cr.Next()
+		So(err, ShouldBeNil)
+		So(cb.Tiles[1], ShouldNotBeNil)
+		So(len(cb.Tiles[1]), ShouldEqual, 0)
+	})
+
+	Convey("Merge abv files in batches", t, func() {
+		var bigSamples, bigNames []string
+		for i := 0; i < 7; i++ {
+			bigSamples = append(bigSamples, samples[i%2])
+			bigNames = append(bigNames, names[i%2])
+		}
+		want := new(bytes.Buffer)
+		So(MergeCohort(want, bigSamples, bigNames), ShouldBeNil)
+
+		defer func(n int) { mergeBatch = n }(mergeBatch)
+		for _, mergeBatch = range []int{2, 3, 6} {
+			buf := new(bytes.Buffer)
+			So(MergeCohort(buf, bigSamples, bigNames), ShouldBeNil)
+			So(buf.Bytes(), ShouldResemble, want.Bytes())
+		}
+	})
+
+	Convey("Refuse corrupted cohort header and band table", t, func() {
+		// Builds cohort data of given version followed by given uvarints.
+		data := func(version byte, vals ...uint64) []byte {
+			buf := append([]byte(COHORT_MAGIC), version)
+			for _, v := range vals {
+				var tmp [binary.MaxVarintLen64]byte
+				buf = append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+			}
+			return buf
+		}
+
+		for _, buf := range [][]byte{
+			data(0, 0, 0),
+			data(COHORT_VERSION+1, 0, 0),
+			data(COHORT_VERSION, 1<<64-1),
+			data(COHORT_VERSION, maxBandNum+1),
+			data(COHORT_VERSION, 1, 1<<64-1),
+			data(COHORT_VERSION, 1, maxHeaderLen+1),
+			data(COHORT_VERSION, 0, 1<<64-1),
+			data(COHORT_VERSION, 1, 0, 1, 1<<64-1, 1),
+			data(COHORT_VERSION, 1, 0, 1, 0, 1<<64-1),
+			data(COHORT_VERSION, 1, 0, 1, 0, maxBandLen+2),
+		} {
+			_, err := NewCohortReader(bytes.NewReader(buf))
+			So(err, ShouldNotBeNil)
+		}
+
+		cr, err := NewCohortReader(bytes.NewReader(append(data(COHORT_VERSION, 1, 2, 'h', 'u', 1, 0, 3), 0, 1)))
+		So(err, ShouldBeNil)
+		So(cr.Samples, ShouldResemble, []string{"hu"})
+		So(cr.Bands[0].Lens, ShouldResemble, []int{2})
+		cb, err := cr.Next()
+		So(err, ShouldBeNil)
+		So(cb.Tiles[0], ShouldResemble, []byte{0, 1})
+	})
+}
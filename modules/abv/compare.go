@@ -0,0 +1,97 @@
+package abv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// CompareFiles compares two abv files byte by byte, it returns description
+// of the first difference, or empty string when they are the same.
+func CompareFiles(name1, name2 string) (string, error) {
+	fr1, err := os.Open(name1)
+	if err != nil {
+		return "", err
+	}
+	defer fr1.Close()
+	fr2, err := os.Open(name2)
+	if err != nil {
+		return "", err
+	}
+	defer fr2.Close()
+
+	buf1 := bufio.NewReader(fr1)
+	buf2 := bufio.NewReader(fr2)
+
+	idx := 0
+	for {
+		c1, err1 := buf1.ReadByte()
+		c2, err2 := buf2.ReadByte()
+
+		if err1 != nil && err1 != io.EOF {
+			return "", fmt.Errorf("%s: %v", name1, err1)
+		} else if err2 != nil && err2 != io.EOF {
+			return "", fmt.Errorf("%s: %v", name2, err2)
+		}
+
+		if err1 == nil && err2 == io.EOF {
+			return fmt.Sprintf("%s has more characters", name1), nil
+		} else if err1 == io.EOF && err2 == nil {
+			return fmt.Sprintf("%s has more characters", name2), nil
+		} else if err1 == io.EOF && err2 == io.EOF {
+			return "", nil
+		}
+
+		idx++
+		if c1 != c2 {
+			return fmt.Sprintf("In index %d, c1='%s' but c2='%s'", idx-1, string(c1), string(c2)), nil
+		}
+	}
+}
+
+// CompareSamples compares tiles of 2 samples in a cohort file, it returns
+// description of the first difference, or empty string when they are the same.
+func CompareSamples(name, sample1, sample2 string) (string, error) {
+	fr, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fr.Close()
+
+	cr, err := NewCohortReader(fr)
+	if err != nil {
+		return "", err
+	}
+	idx1 := cr.SampleIndex(sample1)
+	if idx1 == -1 {
+		return "", fmt.Errorf("sample not found in cohort file: %s", sample1)
+	}
+	idx2 := cr.SampleIndex(sample2)
+	if idx2 == -1 {
+		return "", fmt.Errorf("sample not found in cohort file: %s", sample2)
+	}
+
+	for {
+		cb, err := cr.Next()
+		if err == io.EOF {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+
+		tiles1, tiles2 := cb.Tiles[idx1], cb.Tiles[idx2]
+		for i := 0; i < len(tiles1) && i < len(tiles2); i++ {
+			if tiles1[i] != tiles2[i] {
+				return fmt.Sprintf("In band %s, column %d, %s has variant %d but %s has %d",
+					base.Int2HexStr(cb.Index), i, sample1, tiles1[i], sample2, tiles2[i]), nil
+			}
+		}
+		if len(tiles1) != len(tiles2) {
+			return fmt.Sprintf("In band %s, %s has %d tiles but %s has %d",
+				base.Int2HexStr(cb.Index), sample1, len(tiles1), sample2, len(tiles2)), nil
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package abv
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Tie-breaking policies of consensus when several variants are the most frequent.
+const (
+	TIE_LOWEST  = "lowest"  // Lowest variant index wins, which favors default variant.
+	TIE_HIGHEST = "highest" // Highest variant index wins.
+	TIE_NOCALL  = "nocall"  // Emit unrecognized tile.
+)
+
+// Consensus returns a synthetic human whose every tile is the most frequent
+// recognized variant among given humans. Tiles with call rate below
+// minCallRate are left unrecognized. '#' tiles have no known variant,
+// so they are not calls, same as unrecognized tiles.
+func Consensus(humans []*Human, minCallRate float64, tie string) (*Human, error) {
+	switch tie {
+	case TIE_LOWEST, TIE_HIGHEST, TIE_NOCALL:
+	default:
+		return nil, fmt.Errorf("unknown tie-breaking policy: %s", tie)
+	}
+
+	h := &Human{
+		Name:       "consensus",
+		Blocks:     make(map[int]map[int]*Block),
+		BandLength: make(map[int]int),
+	}
+	for _, hu := range humans {
+		for bandIdx, l := range hu.BandLength {
+			if l > h.BandLength[bandIdx] {
+				h.BandLength[bandIdx] = l
+			}
+		}
+	}
+
+	var counts [256]int
+	for bandIdx, l := range h.BandLength {
+		if bandIdx > h.MaxBand {
+			h.MaxBand = bandIdx
+		}
+		if l-1 > h.MaxPos {
+			h.MaxPos = l - 1
+		}
+
+		for posIdx := 0; posIdx < l; posIdx++ {
+			calls := 0
+			for _, hu := range humans {
+				if b, ok := hu.Blocks[bandIdx][posIdx]; ok && b.Variant != TILE_POUND {
+					counts[b.Variant]++
+					calls++
+				}
+			}
+			if calls == 0 {
+				continue
+			}
+
+			// Pick the most frequent one with counts reset for next tile.
+			best, bestCount, tied := 0, 0, false
+			for v := range counts {
+				switch {
+				case counts[v] == 0:
+					continue
+				case counts[v] > bestCount:
+					best, bestCount, tied = v, counts[v], false
+				case counts[v] == bestCount:
+					tied = true
+					if tie == TIE_HIGHEST {
+						best = v
+					}
+				}
+				counts[v] = 0
+			}
+
+			if float64(calls)/float64(len(humans)) < minCallRate ||
+				(tied && tie == TIE_NOCALL) {
+				continue
+			}
+			if _, ok := h.Blocks[bandIdx]; !ok {
+				h.Blocks[bandIdx] = make(map[int]*Block)
+			}
+			h.Blocks[bandIdx][posIdx] = &Block{Variant: uint8(best)}
+			h.PosCount++
+		}
+	}
+	return h, nil
+}
+
+// WriteHuman writes all bands of given human to writer in order of band index,
+// tiles without block are written as unrecognized. It does not close the writer.
+func WriteHuman(w Writer, h *Human) error {
+	bandIdxs := make([]int, 0, len(h.BandLength))
+	for bandIdx := range h.BandLength {
+		bandIdxs = append(bandIdxs, bandIdx)
+	}
+	sort.Ints(bandIdxs)
+
+	for _, bandIdx := range bandIdxs {
+		data := make([]byte, h.BandLength[bandIdx])
+		for posIdx := range data {
+			if b, ok := h.Blocks[bandIdx][posIdx]; ok {
+				data[posIdx] = tileToChar[b.Variant]
+			} else {
+				data[posIdx] = '-'
+			}
+		}
+		if err := w.WriteBand(&Band{Index: bandIdx, Data: data}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
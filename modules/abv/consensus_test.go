@@ -0,0 +1,65 @@
+package abv
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newHuman returns a human with given raw characters of each band.
+func newHuman(bands ...string) *Human {
+	h := &Human{
+		Blocks:     make(map[int]map[int]*Block),
+		BandLength: make(map[int]int),
+	}
+	for bandIdx, data := range bands {
+		h.BandLength[bandIdx] = len(data)
+		h.Blocks[bandIdx] = make(map[int]*Block)
+		for posIdx := range data {
+			if tile := charToTile[data[posIdx]]; tile != TILE_UNRECOGNIZE {
+				h.Blocks[bandIdx][posIdx] = &Block{Variant: uint8(tile)}
+				h.PosCount++
+			}
+		}
+	}
+	return h
+}
+
+func Test_Consensus(t *testing.T) {
+	humans := []*Human{
+		newHuman("..D-E#", "...."),
+		newHuman("......", "---."),
+		newHuman("..D.E.", ".D.."),
+	}
+
+	consensus := func(minCallRate float64, tie string) string {
+		h, err := Consensus(humans, minCallRate, tie)
+		So(err, ShouldBeNil)
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf, h.Name)
+		So(WriteHuman(w, h), ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+		return buf.String()
+	}
+
+	Convey("Generate consensus of humans", t, func() {
+		So(consensus(0.5, TIE_LOWEST), ShouldEqual, "consensus 0 ..D.E. 1 ....\n")
+		So(consensus(0.5, TIE_HIGHEST), ShouldEqual, "consensus 0 ..D.E. 1 .D..\n")
+		So(consensus(0.5, TIE_NOCALL), ShouldEqual, "consensus 0 ..D.E. 1 .-..\n")
+		So(consensus(1, TIE_LOWEST), ShouldEqual, "consensus 0 ..D-E- 1 ---.\n")
+
+		_, err := Consensus(humans, 0.5, "first")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Do not count '#' tiles as calls", t, func() {
+		humans = []*Human{
+			newHuman("##.#"),
+			newHuman("#D.#"),
+			newHuman("DD.#"),
+		}
+		So(consensus(0.5, TIE_LOWEST), ShouldEqual, "consensus 0 -D.-\n")
+		So(consensus(0.3, TIE_LOWEST), ShouldEqual, "consensus 0 DD.-\n")
+	})
+}
@@ -0,0 +1,52 @@
+package abv
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Convert converts given abv file to target format(binary or text)
+// and saves to given path.
+func Convert(name, dest, format string, compress bool) error {
+	fr, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	rd, err := NewReader(fr)
+	if err != nil {
+		return err
+	}
+
+	fw, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	var w Writer
+	switch format {
+	case "binary":
+		w = NewBinaryWriter(fw, rd.Header, compress)
+	case "text":
+		w = NewWriter(fw, rd.Header)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	for {
+		b, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if err = w.WriteBand(b); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
@@ -0,0 +1,240 @@
+package abv
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+// FastjChr returns chromosome number of given fastj file name.
+func FastjChr(name string) int {
+	name = path.Base(name)
+	chr := name[3:strings.Index(name, "_")]
+	switch chr {
+	case "X":
+		return 23
+	case "Y":
+		return 24
+	case "M":
+		return 25
+	default:
+		num, _ := base.StrTo(chr).Int()
+		return num
+	}
+}
+
+// FastjBand returns band index of given fastj file name.
+func FastjBand(name string) int {
+	name = path.Base(name)
+	start := strings.Index(name, "_") + 5
+	band, _ := base.StrTo(name[start : start+strings.Index(name[start:], "_")]).Int()
+	return band
+}
+
+// FastjNames sorts fastj file names by chromosome and band.
+type FastjNames []string
+
+func (fn FastjNames) Len() int {
+	return len(fn)
+}
+
+func (fn FastjNames) Swap(i, j int) {
+	fn[i], fn[j] = fn[j], fn[i]
+}
+
+func (fn FastjNames) Less(i, j int) bool {
+	chr1, chr2 := FastjChr(fn[i]), FastjChr(fn[j])
+	if chr1 < chr2 {
+		return true
+	} else if chr1 > chr2 {
+		return false
+	}
+	return FastjBand(fn[i]) < FastjBand(fn[j])
+}
+
+// refLib reads reference library of one phase incrementally,
+// it caches the first line that belongs to next position.
+type refLib struct {
+	rd        *bufio.Reader
+	cacheInfo [][]byte
+	cacheBand int
+	cachePos  int
+}
+
+// load returns ranks of tile variants by md5 up to given band and position.
+func (l *refLib) load(band, pos int) (map[string]int, error) {
+	rank := 0
+	m := make(map[string]int)
+	if len(l.cacheInfo) > 0 {
+		m[string(l.cacheInfo[2])] = rank
+		l.cacheInfo = nil
+		rank++
+	}
+
+	var errRead error
+	var line []byte
+	for errRead != io.EOF {
+		line, errRead = l.rd.ReadBytes('\n')
+		if errRead != nil && errRead != io.EOF {
+			return nil, errRead
+		}
+		line = bytes.TrimSpace(line)
+
+		infos := bytes.Split(line, []byte(","))
+		if len(infos) < 3 {
+			continue
+		}
+		curBand, err := base.HexStr2int(string(infos[1][:3]))
+		if err != nil {
+			return nil, fmt.Errorf("fail to get band index(%s): %v", string(line), err)
+		}
+		curPos, err := base.HexStr2int(string(infos[1][7:11]))
+		if err != nil {
+			return nil, fmt.Errorf("fail to get pos index(%s): %v", string(line), err)
+		}
+		if curBand > band || curPos > pos {
+			l.cacheBand = curBand
+			l.cachePos = curPos
+			l.cacheInfo = infos
+			break
+		}
+
+		m[string(infos[2])] = rank
+		rank++
+	}
+	return m, nil
+}
+
+// FromFastj generates abv files of both phases of a human
+// from fastj files and reference library.
+func FromFastj(fastjPath, refLibPath string) error {
+	phases := []string{"A", "B"}
+	outputs := [2]*bufio.Writer{}
+	libs := [2]*refLib{}
+
+	// Open reference library and file writer.
+	for _, phase := range []int{0, 1} {
+		lr, err := os.Open(refLibPath)
+		if err != nil {
+			return err
+		}
+		defer lr.Close()
+		glr, err := gzip.NewReader(lr)
+		if err != nil {
+			return fmt.Errorf("fail to create gzip.Reader(%s): %v", refLibPath, err)
+		}
+		defer glr.Close()
+		libs[phase] = &refLib{bufio.NewReader(glr), nil, -1, -1}
+
+		humanName := "hu011C57"
+		name := "abvs/" + humanName + "_" + phases[phase] + ".abv"
+		os.MkdirAll(path.Dir(name), os.ModePerm)
+		fw, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer fw.Close()
+		outputs[phase] = bufio.NewWriter(fw)
+		outputs[phase].WriteString(humanName)
+	}
+
+	// Load and sort fastj files in order.
+	names, err := base.GetFileListBySuffix(fastjPath, ".fj.lz4")
+	if err != nil {
+		return fmt.Errorf("fail to get list of fastj files: %v", err)
+	}
+	sort.Sort(FastjNames(names))
+
+	for i, name := range names {
+		log.Info("[%d] %s", i, name)
+		fjName := strings.TrimSuffix(name, ".lz4")
+		if !base.IsExist(fjName) {
+			_, stderr, err := base.ExecCmd("lz4", "-d", name, fjName)
+			if err != nil {
+				return fmt.Errorf("fail to lz4 file(%s): %s", name, stderr)
+			}
+		}
+		if err = fastjToAbv(fjName, libs, outputs); err != nil {
+			return fmt.Errorf("%s: %v", fjName, err)
+		}
+	}
+
+	for _, w := range outputs {
+		if err = w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastjToAbv appends tiles in given fastj file to abv files of both phases.
+func fastjToAbv(name string, libs [2]*refLib, outputs [2]*bufio.Writer) error {
+	fr, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	buf := bufio.NewReader(fr)
+	var errRead error
+	var line []byte
+	var m map[string]int
+	var phase int
+
+	for errRead != io.EOF {
+		line, errRead = buf.ReadBytes('\n')
+		if errRead != nil && errRead != io.EOF {
+			return errRead
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] != '>' {
+			continue
+		}
+		phase = 0
+		if bytes.HasSuffix(line, []byte("B\"]}")) {
+			phase = 1
+		}
+		band, err := base.HexStr2int(string(line[16:19]))
+		if err != nil {
+			return fmt.Errorf("fail to get band index(%s): %v", string(line), err)
+		}
+		pos, err := base.HexStr2int(string(line[23:27]))
+		if err != nil {
+			return fmt.Errorf("fail to get pos index(%s): %v", string(line), err)
+		}
+		lib := libs[phase]
+		if band != lib.cacheBand || pos != lib.cachePos || len(lib.cacheInfo) > 0 {
+			if pos == 0 {
+				outputs[phase].WriteString(" ")
+				outputs[phase].WriteString(base.Int2HexStr(band))
+				outputs[phase].WriteString(" ")
+			}
+			if m, err = lib.load(band, pos); err != nil {
+				return err
+			}
+		}
+
+		var ch uint8
+		md5 := string(line[44:76])
+		if rank, ok := m[md5]; ok {
+			if rank >= len(EncodeStd) {
+				ch = '#'
+			} else {
+				ch = EncodeStd[rank]
+			}
+		} else {
+			ch = '-'
+		}
+		outputs[phase].WriteByte(ch)
+	}
+	return nil
+}
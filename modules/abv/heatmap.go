@@ -0,0 +1,120 @@
+package abv
+
+import (
+	"fmt"
+)
+
+// Metrics of tiles across cohort.
+const (
+	METRIC_VARIANT  = "variant"  // Frequency of non-default variants among recognized tiles.
+	METRIC_DISTINCT = "distinct" // Number of distinct recognized variants.
+	METRIC_NOCALL   = "nocall"   // Rate of unrecognized tiles.
+)
+
+// TileStat represents statistic of a tile across cohort.
+type TileStat struct {
+	Calls    int // Number of recognized tiles.
+	Variants int // Number of non-default variants, including '#'.
+	kinds    [4]uint64
+}
+
+func (ts *TileStat) add(tile byte) {
+	if tile == TILE_UNRECOGNIZE {
+		return
+	}
+	ts.Calls++
+	if tile != 0 {
+		ts.Variants++
+	}
+	ts.kinds[tile/64] |= 1 << (tile % 64)
+}
+
+// Distinct returns number of distinct recognized variants.
+func (ts *TileStat) Distinct() int {
+	n := 0
+	for _, k := range ts.kinds {
+		for ; k > 0; k &= k - 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// Heatmap accumulates tiles of humans to compute metrics of every tile
+// across cohort.
+type Heatmap struct {
+	Humans          int
+	Bands           map[int][]TileStat // map[bandIdx][]TileStat
+	MaxBand, MaxPos int                // 0-based.
+}
+
+func NewHeatmap() *Heatmap {
+	return &Heatmap{Bands: make(map[int][]TileStat)}
+}
+
+// AddTiles adds tiles of a band of a human, Humans has to be counted by caller.
+func (hm *Heatmap) AddTiles(bandIdx int, tiles []byte) {
+	stats := hm.Bands[bandIdx]
+	if len(tiles) > len(stats) {
+		stats = append(stats, make([]TileStat, len(tiles)-len(stats))...)
+		hm.Bands[bandIdx] = stats
+	}
+	for i, tile := range tiles {
+		stats[i].add(tile)
+	}
+
+	if bandIdx > hm.MaxBand {
+		hm.MaxBand = bandIdx
+	}
+	if len(tiles)-1 > hm.MaxPos {
+		hm.MaxPos = len(tiles) - 1
+	}
+}
+
+// AddHuman adds all tiles of given human.
+func (hm *Heatmap) AddHuman(h *Human) {
+	hm.Humans++
+	for bandIdx, l := range h.BandLength {
+		tiles := make([]byte, l)
+		for i := range tiles {
+			if b, ok := h.Blocks[bandIdx][i]; ok {
+				tiles[i] = b.Variant
+			} else {
+				tiles[i] = TILE_UNRECOGNIZE
+			}
+		}
+		hm.AddTiles(bandIdx, tiles)
+	}
+}
+
+// Value returns value of metric of given tile, it returns false
+// when the tile has no value, e.g. no human has the tile recognized.
+func (hm *Heatmap) Value(metric string, bandIdx, posIdx int) (float64, bool) {
+	stats := hm.Bands[bandIdx]
+	if posIdx >= len(stats) || hm.Humans == 0 {
+		return 0, false
+	}
+
+	ts := &stats[posIdx]
+	switch metric {
+	case METRIC_VARIANT:
+		if ts.Calls == 0 {
+			return 0, false
+		}
+		return float64(ts.Variants) / float64(ts.Calls), true
+	case METRIC_DISTINCT:
+		return float64(ts.Distinct()), true
+	case METRIC_NOCALL:
+		return float64(hm.Humans-ts.Calls) / float64(hm.Humans), true
+	}
+	return 0, false
+}
+
+// ValidateMetric returns error if given metric is unknown.
+func ValidateMetric(metric string) error {
+	switch metric {
+	case METRIC_VARIANT, METRIC_DISTINCT, METRIC_NOCALL:
+		return nil
+	}
+	return fmt.Errorf("unknown metric: %s", metric)
+}
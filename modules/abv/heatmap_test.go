@@ -0,0 +1,56 @@
+package abv
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Heatmap(t *testing.T) {
+	hm := NewHeatmap()
+	hm.AddHuman(newHuman("..D-E#", "...."))
+	hm.AddHuman(newHuman("......", "---"))
+	hm.AddHuman(newHuman("..D.F."))
+	hm.AddHuman(newHuman("-.--E."))
+
+	Convey("Accumulate tiles of all humans", t, func() {
+		So(hm.Humans, ShouldEqual, 4)
+		So(hm.MaxBand, ShouldEqual, 1)
+		So(hm.MaxPos, ShouldEqual, 5)
+		So(len(hm.Bands[1]), ShouldEqual, 4)
+	})
+
+	Convey("Compute metrics of tiles", t, func() {
+		vals := []struct {
+			metric          string
+			bandIdx, posIdx int
+			value           float64
+			ok              bool
+		}{
+			{METRIC_VARIANT, 0, 0, 0, true},
+			{METRIC_VARIANT, 0, 2, 2.0 / 3, true},
+			{METRIC_VARIANT, 0, 4, 0.75, true},
+			{METRIC_VARIANT, 0, 5, 0.25, true},
+			{METRIC_VARIANT, 1, 0, 0, true},
+			{METRIC_DISTINCT, 0, 2, 2, true},
+			{METRIC_DISTINCT, 0, 4, 3, true},
+			{METRIC_DISTINCT, 0, 5, 2, true},
+			{METRIC_NOCALL, 0, 3, 0.5, true},
+			{METRIC_NOCALL, 1, 3, 0.75, true},
+			// No human has the tile recognized or the tile at all.
+			{METRIC_VARIANT, 1, 1, 0, true},
+			{METRIC_VARIANT, 1, 4, 0, false},
+			{METRIC_NOCALL, 2, 0, 0, false},
+		}
+		for _, v := range vals {
+			value, ok := hm.Value(v.metric, v.bandIdx, v.posIdx)
+			So(ok, ShouldEqual, v.ok)
+			So(value, ShouldAlmostEqual, v.value)
+		}
+	})
+
+	Convey("Validate metric", t, func() {
+		So(ValidateMetric(METRIC_DISTINCT), ShouldBeNil)
+		So(ValidateMetric("mean"), ShouldNotBeNil)
+	})
+}
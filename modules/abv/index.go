@@ -0,0 +1,138 @@
+package abv
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// IndexSuffix is the suffix of sidecar index file of abv file.
+const IndexSuffix = ".idx"
+
+var (
+	ErrStaleIndex  = errors.New("index is stale")
+	ErrBinaryIndex = errors.New("binary abv has built-in band table and needs no index")
+)
+
+// BandOffset represents location of a band in abv file.
+type BandOffset struct {
+	Band   int   `json:"band"`
+	Offset int64 `json:"offset"` // Byte offset of band label.
+	Length int64 `json:"length"` // Byte length from band label to end of body.
+}
+
+// Index represents band index of an abv file,
+// which maps band index to its byte offset and length.
+type Index struct {
+	Size    int64        `json:"size"`
+	ModTime int64        `json:"mod_time"` // Unix nanoseconds.
+	Bands   []BandOffset `json:"bands"`
+
+	bandIdx map[int]int // Band index to position in Bands, built on first lookup.
+}
+
+// BuildIndex scans given abv file and builds its band index.
+func BuildIndex(name string) (*Index, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fr, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	rd, err := NewReader(fr)
+	if err != nil {
+		return nil, err
+	} else if rd.IsBinary() {
+		return nil, ErrBinaryIndex
+	}
+
+	idx := &Index{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime().UnixNano(),
+		Bands:   make([]BandOffset, 0, 1000),
+	}
+	for {
+		b, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		idx.Bands = append(idx.Bands, BandOffset{
+			Band:   b.Index,
+			Offset: b.Offset,
+			Length: rd.tokenOffset + int64(len(b.Data)) - b.Offset,
+		})
+	}
+	return idx, nil
+}
+
+// LoadIndex loads sidecar index of given abv file,
+// it returns ErrStaleIndex when abv file has changed since index was built.
+func LoadIndex(name string) (*Index, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(name + IndexSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := new(Index)
+	if err = json.Unmarshal(data, idx); err != nil {
+		return nil, err
+	} else if idx.Size != fi.Size() || idx.ModTime != fi.ModTime().UnixNano() {
+		return nil, ErrStaleIndex
+	}
+	return idx, nil
+}
+
+// Save saves index as sidecar index of given abv file.
+func (idx *Index) Save(name string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name+IndexSuffix, data, 0644)
+}
+
+// Band returns location of given band index.
+func (idx *Index) Band(band int) (BandOffset, bool) {
+	if idx.bandIdx == nil {
+		idx.bandIdx = make(map[int]int, len(idx.Bands))
+		for i, bo := range idx.Bands {
+			idx.bandIdx[bo.Band] = i
+		}
+	}
+
+	i, ok := idx.bandIdx[band]
+	if !ok {
+		return BandOffset{}, false
+	}
+	return idx.Bands[i], true
+}
+
+// Seek moves given reader to the beginning of given band,
+// it does nothing if band does not exist in index.
+func (idx *Index) Seek(rs io.ReadSeeker, rd *Reader, band int) error {
+	bo, ok := idx.Band(band)
+	if !ok {
+		return nil
+	}
+
+	if _, err := rs.Seek(bo.Offset, os.SEEK_SET); err != nil {
+		return err
+	}
+	rd.Reset(rs, bo.Offset)
+	return nil
+}
@@ -0,0 +1,138 @@
+package abv
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func Test_Index(t *testing.T) {
+	dir, err := ioutil.TempDir("", "abv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bands := randomBands(5, 100)
+	name := path.Join(dir, "hu1.abv")
+	fw, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeBands(NewWriter(fw, "hu1"), bands); err != nil {
+		t.Fatal(err)
+	}
+	fw.Close()
+
+	Convey("Build index of text abv file", t, func() {
+		idx, err := BuildIndex(name)
+		So(err, ShouldBeNil)
+		So(len(idx.Bands), ShouldEqual, len(bands))
+
+		fi, err := os.Stat(name)
+		So(err, ShouldBeNil)
+		So(idx.Size, ShouldEqual, fi.Size())
+		So(idx.ModTime, ShouldEqual, fi.ModTime().UnixNano())
+
+		data, err := ioutil.ReadFile(name)
+		So(err, ShouldBeNil)
+		for i, bo := range idx.Bands {
+			So(bo.Band, ShouldEqual, bands[i].Index)
+			So(string(data[bo.Offset:bo.Offset+bo.Length]), ShouldEndWith, string(bands[i].Data))
+
+			found, ok := idx.Band(bands[i].Index)
+			So(ok, ShouldBeTrue)
+			So(found, ShouldResemble, bo)
+		}
+
+		_, ok := idx.Band(len(bands))
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Refuse to build index of binary abv file", t, func() {
+		bin := path.Join(dir, "bin.abv")
+		fw, err := os.Create(bin)
+		So(err, ShouldBeNil)
+		So(writeBands(NewBinaryWriter(fw, "hu1", false), bands), ShouldBeNil)
+		fw.Close()
+
+		_, err = BuildIndex(bin)
+		So(err, ShouldEqual, ErrBinaryIndex)
+	})
+
+	Convey("Seek to band by index", t, func() {
+		idx, err := BuildIndex(name)
+		So(err, ShouldBeNil)
+
+		fr, err := os.Open(name)
+		So(err, ShouldBeNil)
+		defer fr.Close()
+		rd, err := NewReader(fr)
+		So(err, ShouldBeNil)
+
+		So(idx.Seek(fr, rd, 3), ShouldBeNil)
+		b, err := rd.Next()
+		So(err, ShouldBeNil)
+		So(b.Index, ShouldEqual, 3)
+		So(string(b.Data), ShouldEqual, string(bands[3].Data))
+		b, err = rd.Next()
+		So(err, ShouldBeNil)
+		So(b.Index, ShouldEqual, 4)
+		_, err = rd.Next()
+		So(err, ShouldEqual, io.EOF)
+	})
+
+	Convey("Save and load index, and detect stale index", t, func() {
+		_, err := LoadIndex(name)
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		idx, err := BuildIndex(name)
+		So(err, ShouldBeNil)
+		So(idx.Save(name), ShouldBeNil)
+		loaded, err := LoadIndex(name)
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, idx)
+
+		// Modification time changes with the same size.
+		mtime := time.Unix(0, idx.ModTime).Add(time.Hour)
+		So(os.Chtimes(name, mtime, mtime), ShouldBeNil)
+		_, err = LoadIndex(name)
+		So(err, ShouldEqual, ErrStaleIndex)
+
+		// Size changes with the same modification time.
+		idx, err = BuildIndex(name)
+		So(err, ShouldBeNil)
+		So(idx.Save(name), ShouldBeNil)
+		fw, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+		So(err, ShouldBeNil)
+		fw.WriteString("\n")
+		fw.Close()
+		So(os.Chtimes(name, mtime, mtime), ShouldBeNil)
+		_, err = LoadIndex(name)
+		So(err, ShouldEqual, ErrStaleIndex)
+	})
+
+	Convey("Parse range by index without building one", t, func() {
+		os.Remove(name + IndexSuffix)
+		r := &base.Range{StartBandIdx: 2, EndBandIdx: -1, EndPosIdx: -1}
+		want, err := Parse(name, false, r, nil)
+		So(err, ShouldBeNil)
+		So(want.BandLength, ShouldHaveLength, 3)
+		So(base.IsExist(name+IndexSuffix), ShouldBeFalse)
+
+		idx, err := BuildIndex(name)
+		So(err, ShouldBeNil)
+		So(idx.Save(name), ShouldBeNil)
+		h, err := Parse(name, false, r, nil)
+		So(err, ShouldBeNil)
+		So(h.Blocks, ShouldResemble, want.Blocks)
+		So(h.BandLength, ShouldResemble, want.BandLength)
+	})
+}
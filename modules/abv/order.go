@@ -0,0 +1,138 @@
+package abv
+
+import (
+	"io"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// CallRate returns rate of recognized tiles of human.
+func (h *Human) CallRate() float64 {
+	total := 0
+	for _, l := range h.BandLength {
+		total += l
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(h.PosCount) / float64(total)
+}
+
+// Concordance returns rate of tiles that have the same variant
+// among tiles recognized by both humans.
+func Concordance(a, b *Human) float64 {
+	both, same := 0, 0
+	for bandIdx, blocks := range a.Blocks {
+		for posIdx, block := range blocks {
+			if other, ok := b.Blocks[bandIdx][posIdx]; ok {
+				both++
+				if block.Variant == other.Variant {
+					same++
+				}
+			}
+		}
+	}
+	if both == 0 {
+		return 0
+	}
+	return float64(same) / float64(both)
+}
+
+// ClusterOrder returns order of given humans by average-linkage hierarchical
+// clustering on concordance, so that similar humans are next to each other.
+func ClusterOrder(humans []*Human) []int {
+	sims := make([][]float64, len(humans))
+	for i := range humans {
+		sims[i] = make([]float64, len(humans))
+		for j := 0; j < i; j++ {
+			sims[i][j] = Concordance(humans[i], humans[j])
+			sims[j][i] = sims[i][j]
+		}
+	}
+
+	clusters := make([][]int, len(humans))
+	for i := range clusters {
+		clusters[i] = []int{i}
+	}
+
+	// Merge the most similar pair of clusters until only one left.
+	for len(clusters) > 1 {
+		bestI, bestJ, best := 0, 1, -1.0
+		for i := range clusters {
+			for j := i + 1; j < len(clusters); j++ {
+				sum := 0.0
+				for _, a := range clusters[i] {
+					for _, b := range clusters[j] {
+						sum += sims[a][b]
+					}
+				}
+				if avg := sum / float64(len(clusters[i])*len(clusters[j])); avg > best {
+					bestI, bestJ, best = i, j, avg
+				}
+			}
+		}
+		clusters[bestI] = append(clusters[bestI], clusters[bestJ]...)
+		clusters = append(clusters[:bestJ], clusters[bestJ+1:]...)
+	}
+
+	if len(clusters) == 0 {
+		return []int{}
+	}
+	return clusters[0]
+}
+
+// Humans reads rest of bands within given range and returns them as humans
+// in order of sample list, negative end index means no limit.
+func (cr *CohortReader) Humans(r *base.Range) ([]*Human, error) {
+	humans := make([]*Human, len(cr.Samples))
+	for i := range humans {
+		humans[i] = &Human{
+			Name:       cr.Samples[i],
+			Blocks:     make(map[int]map[int]*Block),
+			BandLength: make(map[int]int),
+		}
+	}
+
+	for {
+		cb, err := cr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if cb.Index < r.StartBandIdx {
+			continue
+		} else if r.EndBandIdx >= 0 && cb.Index > r.EndBandIdx {
+			break
+		}
+
+		for i, tiles := range cb.Tiles {
+			// Sample does not have this band, empty bands are kept as abv files do.
+			if tiles == nil {
+				continue
+			}
+			h := humans[i]
+			if r.EndPosIdx >= 0 && len(tiles) > r.EndPosIdx+1 {
+				tiles = tiles[:r.EndPosIdx+1]
+			}
+
+			h.BandLength[cb.Index] = len(tiles)
+			if cb.Index > h.MaxBand {
+				h.MaxBand = cb.Index
+			}
+			if len(tiles)-1 > h.MaxPos {
+				h.MaxPos = len(tiles) - 1
+			}
+
+			h.Blocks[cb.Index] = make(map[int]*Block)
+			for posIdx, tile := range tiles {
+				if tile != TILE_UNRECOGNIZE {
+					h.Blocks[cb.Index][posIdx] = &Block{Variant: tile}
+					h.PosCount++
+				}
+			}
+		}
+	}
+	return humans, nil
+}
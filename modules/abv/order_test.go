@@ -0,0 +1,25 @@
+package abv
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_ClusterOrder(t *testing.T) {
+	Convey("Order humans by similarity", t, func() {
+		humans := []*Human{
+			newHuman("..D..."),
+			newHuman("EEEEEE"),
+			newHuman("..D..-"),
+			newHuman("EEEEE."),
+		}
+		So(Concordance(humans[0], humans[2]), ShouldEqual, 1)
+		So(Concordance(humans[0], humans[1]), ShouldEqual, 0)
+		So(humans[0].CallRate(), ShouldEqual, 1)
+		So(humans[2].CallRate(), ShouldAlmostEqual, 5.0/6)
+
+		So(ClusterOrder(humans), ShouldResemble, []int{0, 2, 1, 3})
+		So(ClusterOrder(nil), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,126 @@
+package abv
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// BandQuality represents call quality of tiles in a band.
+type BandQuality struct {
+	Len      int // Number of tiles.
+	NoCall   int // Number of '-'.
+	Overflow int // Number of '#'.
+}
+
+// CallRate returns ratio of recognized tiles.
+func (bq *BandQuality) CallRate() float64 {
+	if bq.Len == 0 {
+		return 0
+	}
+	return 1 - float64(bq.NoCall)/float64(bq.Len)
+}
+
+// OverflowRate returns ratio of tiles with variant index over encode range.
+func (bq *BandQuality) OverflowRate() float64 {
+	if bq.Len == 0 {
+		return 0
+	}
+	return float64(bq.Overflow) / float64(bq.Len)
+}
+
+// Quality represents call quality of a human.
+type Quality struct {
+	Name string
+	BandQuality
+	Bands   map[int]*BandQuality
+	MaxBand int
+}
+
+// CheckQuality counts no-call and overflow tiles of given abv file.
+func CheckQuality(name string, r *base.Range) (*Quality, error) {
+	if !base.IsFile(name) {
+		return nil, fmt.Errorf("file(%s) does not exist or is not a file", name)
+	}
+
+	fr, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	rd, err := NewReader(fr)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Quality{
+		Name:  name,
+		Bands: make(map[int]*BandQuality),
+	}
+	for {
+		b, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if r.EndBandIdx >= 0 && b.Index > r.EndBandIdx {
+			break
+		} else if b.Index > q.MaxBand {
+			q.MaxBand = b.Index
+		}
+
+		bq := &BandQuality{Len: len(b.Data)}
+		for _, char := range b.Data {
+			switch char {
+			case '-':
+				bq.NoCall++
+			case '#':
+				bq.Overflow++
+			}
+		}
+		q.Bands[b.Index] = bq
+		q.Len += bq.Len
+		q.NoCall += bq.NoCall
+		q.Overflow += bq.Overflow
+	}
+	return q, nil
+}
+
+// ParseBandLength parses reference band length table,
+// each line contains a hex band index and its length, e.g.: "2f 5821".
+// Empty lines and lines start with ';' are ignored.
+func ParseBandLength(name string) (map[int]int, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	bandLen := make(map[int]int)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == ';' {
+			continue
+		}
+
+		infos := strings.Fields(line)
+		if len(infos) != 2 {
+			return nil, fmt.Errorf("line %d: expect band index and length: %s", i+1, line)
+		}
+		band, err := base.HexStr2int(infos[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid band index: %v", i+1, err)
+		}
+		bandLen[band], err = base.StrTo(infos[1]).Int()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid band length: %v", i+1, err)
+		}
+	}
+	return bandLen, nil
+}
@@ -0,0 +1,106 @@
+package abv
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func Test_CheckQuality(t *testing.T) {
+	dir, err := ioutil.TempDir("", "abv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bands := []*Band{
+		{Index: 0, Data: []byte("..--#.")},
+		{Index: 1, Data: []byte("----")},
+		{Index: 3, Data: []byte("D#E#")},
+	}
+
+	Convey("Count no-call and overflow tiles", t, func() {
+		for _, binary := range []bool{false, true} {
+			name := path.Join(dir, "hu1.abv")
+			fw, err := os.Create(name)
+			So(err, ShouldBeNil)
+			var w Writer = NewWriter(fw, "hu1")
+			if binary {
+				w = NewBinaryWriter(fw, "hu1", true)
+			}
+			So(writeBands(w, bands), ShouldBeNil)
+			fw.Close()
+
+			q, err := CheckQuality(name, &base.Range{EndBandIdx: -1, EndPosIdx: -1})
+			So(err, ShouldBeNil)
+			So(q.MaxBand, ShouldEqual, 3)
+			So(q.Len, ShouldEqual, 14)
+			So(q.NoCall, ShouldEqual, 6)
+			So(q.Overflow, ShouldEqual, 3)
+			So(q.CallRate(), ShouldAlmostEqual, 8.0/14)
+			So(q.OverflowRate(), ShouldAlmostEqual, 3.0/14)
+			So(q.Bands, ShouldHaveLength, 3)
+			So(*q.Bands[0], ShouldResemble, BandQuality{6, 2, 1})
+			So(q.Bands[1].CallRate(), ShouldEqual, 0)
+			_, ok := q.Bands[2]
+			So(ok, ShouldBeFalse)
+
+			q, err = CheckQuality(name, &base.Range{EndBandIdx: 1, EndPosIdx: -1})
+			So(err, ShouldBeNil)
+			So(q.MaxBand, ShouldEqual, 1)
+			So(q.Len, ShouldEqual, 10)
+		}
+
+		So(new(BandQuality).CallRate(), ShouldEqual, 0)
+		So(new(BandQuality).OverflowRate(), ShouldEqual, 0)
+		_, err := CheckQuality(dir, &base.Range{EndBandIdx: -1, EndPosIdx: -1})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func Test_ParseBandLength(t *testing.T) {
+	dir, err := ioutil.TempDir("", "abv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := path.Join(dir, "band_len.txt")
+	parse := func(data string) (map[int]int, error) {
+		So(ioutil.WriteFile(name, []byte(data), 0644), ShouldBeNil)
+		return ParseBandLength(name)
+	}
+
+	Convey("Parse band length table", t, func() {
+		bandLen, err := parse("; band length\n0 5213\n\n  1\t4920  \n2f 5821\n")
+		So(err, ShouldBeNil)
+		So(bandLen, ShouldResemble, map[int]int{0: 5213, 1: 4920, 0x2f: 5821})
+
+		bandLen, err = parse("")
+		So(err, ShouldBeNil)
+		So(bandLen, ShouldBeEmpty)
+	})
+
+	Convey("Refuse invalid band length table", t, func() {
+		for _, data := range []string{
+			"0 5213\n1\n",
+			"0 5213 1\n",
+			"zz 5213\n",
+			"0 abc\n",
+		} {
+			_, err := parse(data)
+			So(err, ShouldNotBeNil)
+		}
+
+		_, err := parse("0 1\n1 x\n")
+		So(err.Error(), ShouldStartWith, "line 2:")
+
+		_, err = ParseBandLength(path.Join(dir, "none.txt"))
+		So(err, ShouldNotBeNil)
+	})
+}
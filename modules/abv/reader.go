@@ -0,0 +1,135 @@
+package abv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// Band represents raw tiles of a band in abv file.
+type Band struct {
+	Index  int
+	Data   []byte
+	Offset int64 // Byte offset of band label in stream.
+}
+
+// Reader reads abv data band by band, so that callers do not
+// have to load whole file into memory.
+// It accepts both text and binary format, detected by magic bytes.
+type Reader struct {
+	buf    *bufio.Reader
+	Header string // e.g.: "huFE71F3"
+	eof    bool
+
+	// DecodeTiles indicates whether Band.Data holds decoded tiles instead of
+	// characters, which are variant index in EncodeStd, TILE_POUND for '#'
+	// and TILE_UNRECOGNIZE for '-'.
+	DecodeTiles bool
+
+	offset      int64 // Byte offset of next read in stream.
+	tokenOffset int64 // Byte offset of last read token.
+
+	// Binary format.
+	binary     bool
+	compressed bool
+	table      []binaryBand
+	tableIdx   int
+	minBand    int // Bands before it are discarded without decoding.
+	inflater   io.ReadCloser
+}
+
+// readToken returns next space-separated token with surrounding spaces trimmed.
+func (r *Reader) readToken() ([]byte, error) {
+	if r.eof {
+		return nil, io.EOF
+	}
+
+	line, err := r.buf.ReadBytes(' ')
+	if err != nil {
+		if err != io.EOF {
+			return nil, err
+		}
+		r.eof = true
+	}
+
+	token := bytes.TrimLeftFunc(line, unicode.IsSpace)
+	r.tokenOffset = r.offset + int64(len(line)-len(token))
+	r.offset += int64(len(line))
+	return bytes.TrimRightFunc(token, unicode.IsSpace), nil
+}
+
+// Reset discards buffered data and continues reading from given reader,
+// which is positioned at given byte offset of the same stream.
+func (r *Reader) Reset(rd io.Reader, offset int64) {
+	r.buf.Reset(rd)
+	r.eof = false
+	r.offset = offset
+}
+
+// NewReader reads header from given reader and returns a new abv reader.
+func NewReader(rd io.Reader) (*Reader, error) {
+	r := &Reader{buf: bufio.NewReader(rd)}
+	if magic, _ := r.buf.Peek(len(BINARY_MAGIC)); IsBinary(magic) {
+		r.binary = true
+		if err := r.readBinaryHeader(); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	header, err := r.readToken()
+	if err != nil {
+		return nil, err
+	}
+	r.Header = string(header)
+	return r, nil
+}
+
+// IsBinary returns true if underlying stream is in binary format.
+func (r *Reader) IsBinary() bool {
+	return r.binary
+}
+
+// Next returns next band in the stream, it returns io.EOF when no more bands.
+func (r *Reader) Next() (*Band, error) {
+	if r.binary {
+		return r.nextBinary()
+	}
+
+	// Skip extra spaces or line breaks between bands.
+	var label []byte
+	var err error
+	for len(label) == 0 {
+		if label, err = r.readToken(); err != nil {
+			return nil, err
+		}
+	}
+	offset := r.tokenOffset
+
+	idx, err := base.HexStr2int(string(label))
+	if err != nil {
+		return nil, fmt.Errorf("invalid band index(%s): %v", label, err)
+	}
+
+	data, err := r.readToken()
+	if err == io.EOF {
+		return nil, fmt.Errorf("band %s: unexpected end of file", label)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if r.DecodeTiles {
+		for i, char := range data {
+			tile := charToTile[char]
+			if tile < 0 {
+				return nil, fmt.Errorf("invalid character '%c' at band %s, column %d", char, label, i)
+			}
+			data[i] = byte(tile)
+		}
+	}
+	return &Band{idx, data, offset}, nil
+}
@@ -0,0 +1,186 @@
+package abv
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// BandRange represents an inclusive range of band indexes.
+type BandRange struct {
+	Start, End int
+}
+
+func (br BandRange) String() string {
+	if br.Start == br.End {
+		return base.Int2HexStr(br.Start)
+	}
+	return base.Int2HexStr(br.Start) + "-" + base.Int2HexStr(br.End)
+}
+
+// BandList returns indexes of all bands in given abv file,
+// bands must be in ascending order.
+func BandList(name string) ([]int, error) {
+	bands := make([]int, 0, 100)
+	if err := scanBandLength(name, func(idx, _ int) {
+		bands = append(bands, idx)
+	}); err != nil {
+		return nil, err
+	}
+	return bands, nil
+}
+
+// PartitionBands divides given ascending band indexes into ranges of given
+// number of bands, or into given number of chunks with about the same number
+// of bands when chunks > 0.
+func PartitionBands(bands []int, size, chunks int) []BandRange {
+	if len(bands) == 0 {
+		return nil
+	}
+	if chunks > 0 {
+		if chunks > len(bands) {
+			chunks = len(bands)
+		}
+		// The first len(bands)%chunks chunks take one more band.
+		ranges := make([]BandRange, chunks)
+		start := 0
+		for i := range ranges {
+			n := len(bands) / chunks
+			if i < len(bands)%chunks {
+				n++
+			}
+			ranges[i] = BandRange{bands[start], bands[start+n-1]}
+			start += n
+		}
+		return ranges
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	ranges := make([]BandRange, 0, len(bands)/size+1)
+	for i := 0; i < len(bands); i += size {
+		end := i + size - 1
+		if end >= len(bands) {
+			end = len(bands) - 1
+		}
+		ranges = append(ranges, BandRange{bands[i], bands[end]})
+	}
+	return ranges
+}
+
+// NewWriterLike returns a new writer of the same format as given reader.
+func NewWriterLike(w io.Writer, rd *Reader) Writer {
+	if rd.IsBinary() {
+		return NewBinaryWriter(w, rd.Header, rd.compressed)
+	}
+	return NewWriter(w, rd.Header)
+}
+
+// Subset copies bands within given range from reader to writer,
+// negative end index means no limit. Tiles before start position are dropped,
+// so positions of subset start from 0. It does not close the writer.
+func Subset(w Writer, rd *Reader, r *base.Range) error {
+	if rd.IsBinary() {
+		rd.minBand = r.StartBandIdx
+	}
+
+	for {
+		b, err := rd.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if b.Index < r.StartBandIdx {
+			continue
+		} else if r.EndBandIdx >= 0 && b.Index > r.EndBandIdx {
+			return nil
+		}
+
+		if r.EndPosIdx >= 0 && len(b.Data) > r.EndPosIdx+1 {
+			b.Data = b.Data[:r.EndPosIdx+1]
+		}
+		if r.StartPosIdx > len(b.Data) {
+			b.Data = b.Data[:0]
+		} else {
+			b.Data = b.Data[r.StartPosIdx:]
+		}
+		if err = w.WriteBand(b); err != nil {
+			return err
+		}
+	}
+}
+
+type concatPart struct {
+	name  string
+	bands []*Band
+}
+
+type concatParts []*concatPart
+
+func (cp concatParts) Len() int {
+	return len(cp)
+}
+
+func (cp concatParts) Swap(i, j int) {
+	cp[i], cp[j] = cp[j], cp[i]
+}
+
+func (cp concatParts) Less(i, j int) bool {
+	return cp[i].bands[0].Index < cp[j].bands[0].Index
+}
+
+// Concat copies bands of all given readers to writer in order of their first bands.
+// All readers must have the same header, and their band ranges must not overlap.
+// All bands are read and checked before any is written, so nothing is written
+// when check fails. It does not close the writer.
+func Concat(w Writer, names []string, rds []*Reader) error {
+	parts := make(concatParts, 0, len(rds))
+	for i, rd := range rds {
+		if rd.Header != rds[0].Header {
+			return fmt.Errorf("%s: header %s differs from %s", names[i], rd.Header, rds[0].Header)
+		}
+
+		p := &concatPart{name: names[i]}
+		for {
+			b, err := rd.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("%s: %v", names[i], err)
+			}
+			p.bands = append(p.bands, b)
+		}
+		// Nothing to copy for empty parts.
+		if len(p.bands) > 0 {
+			parts = append(parts, p)
+		}
+	}
+	sort.Stable(parts)
+
+	last, lastName := -1, ""
+	for _, p := range parts {
+		for _, b := range p.bands {
+			if b.Index <= last {
+				if lastName == p.name {
+					return fmt.Errorf("%s: band %s is out of order", p.name, base.Int2HexStr(b.Index))
+				}
+				return fmt.Errorf("%s: band %s overlaps with %s", p.name, base.Int2HexStr(b.Index), lastName)
+			}
+			last, lastName = b.Index, p.name
+		}
+	}
+
+	for _, p := range parts {
+		for _, b := range p.bands {
+			if err := w.WriteBand(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
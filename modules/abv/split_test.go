@@ -0,0 +1,113 @@
+package abv
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func Test_PartitionBands(t *testing.T) {
+	Convey("Partition bands by size and chunks", t, func() {
+		bands := []int{0, 1, 2, 4, 5}
+		So(PartitionBands(bands, 1, 0), ShouldResemble,
+			[]BandRange{{0, 0}, {1, 1}, {2, 2}, {4, 4}, {5, 5}})
+		So(PartitionBands(bands, 2, 0), ShouldResemble,
+			[]BandRange{{0, 1}, {2, 4}, {5, 5}})
+		So(PartitionBands(bands, 1, 2), ShouldResemble,
+			[]BandRange{{0, 2}, {4, 5}})
+		So(PartitionBands(bands, 1, 10), ShouldHaveLength, 5)
+
+		// Remainder is spread across chunks.
+		twelve := make([]int, 12)
+		for i := range twelve {
+			twelve[i] = i
+		}
+		So(PartitionBands(twelve, 1, 5), ShouldResemble,
+			[]BandRange{{0, 2}, {3, 5}, {6, 7}, {8, 9}, {10, 11}})
+		for chunks := 1; chunks <= 15; chunks++ {
+			want := chunks
+			if want > len(twelve) {
+				want = len(twelve)
+			}
+			So(PartitionBands(twelve, 1, chunks), ShouldHaveLength, want)
+		}
+		So(PartitionBands(nil, 1, 0), ShouldBeNil)
+	})
+}
+
+func newRange(start, end, pos int) *base.Range {
+	return &base.Range{StartBandIdx: start, EndBandIdx: end, EndPosIdx: pos}
+}
+
+func Test_SubsetAndConcat(t *testing.T) {
+	bands := randomBands(6, 50)
+	buf := new(bytes.Buffer)
+	if err := writeBands(NewWriter(buf, "hu1"), bands); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+
+	// subset returns given range of source in text format.
+	subset := func(r *base.Range) string {
+		rd, err := NewReader(bytes.NewBufferString(src))
+		So(err, ShouldBeNil)
+		out := new(bytes.Buffer)
+		w := NewWriterLike(out, rd)
+		So(Subset(w, rd, r), ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+		return out.String()
+	}
+
+	Convey("Subset and concatenate abv data", t, func() {
+		_, sub, err := readBands(bytes.NewBufferString(subset(newRange(2, 3, 9))))
+		So(err, ShouldBeNil)
+		So(sub, ShouldHaveLength, 2)
+		So(sub[0].Index, ShouldEqual, 2)
+		So(string(sub[1].Data), ShouldEqual, string(bands[3].Data[:10]))
+
+		_, sub, err = readBands(bytes.NewBufferString(subset(&base.Range{
+			StartBandIdx: 2, EndBandIdx: 3, StartPosIdx: 5, EndPosIdx: 9})))
+		So(err, ShouldBeNil)
+		So(sub, ShouldHaveLength, 2)
+		So(string(sub[0].Data), ShouldEqual, string(bands[2].Data[5:10]))
+		So(string(sub[1].Data), ShouldEqual, string(bands[3].Data[5:10]))
+
+		_, sub, err = readBands(bytes.NewBufferString(subset(&base.Range{
+			StartBandIdx: 2, EndBandIdx: 2, StartPosIdx: 60, EndPosIdx: -1})))
+		So(err, ShouldBeNil)
+		So(sub, ShouldHaveLength, 1)
+		So(sub[0].Data, ShouldBeEmpty)
+
+		parts := []string{
+			subset(newRange(3, -1, -1)),
+			subset(newRange(0, 2, -1)),
+		}
+		rds := make([]*Reader, len(parts))
+		for i := range parts {
+			rds[i], err = NewReader(bytes.NewBufferString(parts[i]))
+			So(err, ShouldBeNil)
+		}
+		out := new(bytes.Buffer)
+		w := NewWriter(out, "hu1")
+		So(Concat(w, []string{"p1", "p2"}, rds), ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+		So(out.String(), ShouldEqual, src)
+
+		Convey("Overlapped parts", func() {
+			parts[1] = subset(newRange(0, 3, -1))
+			for i := range parts {
+				rds[i], err = NewReader(bytes.NewBufferString(parts[i]))
+				So(err, ShouldBeNil)
+			}
+			// Parts are checked before any band is written.
+			out.Reset()
+			err = Concat(NewWriter(out, "hu1"), []string{"p1", "p2"}, rds)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "overlaps")
+			So(out.Len(), ShouldEqual, 0)
+		})
+	})
+}
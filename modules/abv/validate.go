@@ -0,0 +1,185 @@
+package abv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// Problem represents a problem found in abv data.
+type Problem struct {
+	Band int // -1 when it's in header.
+	Col  int // -1 when it's not related to a tile.
+	Desc string
+}
+
+func (p *Problem) Error() string {
+	switch {
+	case p.Band < 0:
+		return "header: " + p.Desc
+	case p.Col < 0:
+		return fmt.Sprintf("band %s: %s", base.Int2HexStr(p.Band), p.Desc)
+	}
+	return fmt.Sprintf("band %s, column %d: %s", base.Int2HexStr(p.Band), p.Col, p.Desc)
+}
+
+// isValidTile returns true if given character is allowed in band body.
+func isValidTile(char byte) bool {
+	return char == '-' || char == '#' || bytes.IndexByte(EncodeStd, char) > -1
+}
+
+// validator collects problems of abv data.
+type validator struct {
+	ps      []*Problem
+	bandLen map[int]int // Reference band length table.
+	lastIdx int         // Max band index seen so far.
+}
+
+func (v *validator) add(band, col int, format string, args ...interface{}) {
+	v.ps = append(v.ps, &Problem{band, col, fmt.Sprintf(format, args...)})
+}
+
+// checkOrder checks if given band index comes right after previous one.
+func (v *validator) checkOrder(bandIdx int) {
+	switch {
+	case bandIdx <= v.lastIdx:
+		v.add(bandIdx, -1, "out of order, already seen band %s", base.Int2HexStr(v.lastIdx))
+	case bandIdx > v.lastIdx+1:
+		v.add(bandIdx, -1, "discontinuous, missing band(s) %s to %s",
+			base.Int2HexStr(v.lastIdx+1), base.Int2HexStr(bandIdx-1))
+	}
+	if bandIdx > v.lastIdx {
+		v.lastIdx = bandIdx
+	}
+}
+
+// checkBody checks characters and length of band body.
+func (v *validator) checkBody(bandIdx int, data []byte) {
+	if len(data) == 0 {
+		v.add(bandIdx, -1, "empty band body")
+	}
+	for i, char := range data {
+		if !isValidTile(char) {
+			v.add(bandIdx, i, "invalid character '%c'", char)
+		}
+	}
+	if l, ok := v.bandLen[bandIdx]; ok && l != len(data) {
+		v.add(bandIdx, -1, "band length is %d but reference is %d", len(data), l)
+	}
+}
+
+// finish checks missing bands and returns all problems.
+func (v *validator) finish() []*Problem {
+	missing := 0
+	for idx := range v.bandLen {
+		if idx > v.lastIdx {
+			missing++
+		}
+	}
+	if missing > 0 {
+		v.add(v.lastIdx, -1, "%d band(s) in reference are missing after it", missing)
+	}
+
+	if v.lastIdx == -1 {
+		v.add(-1, -1, "no band found")
+	}
+	return v.ps
+}
+
+// Validate checks header, band order and continuity, hex labels and
+// allowed characters of abv data, and returns all problems it found.
+func Validate(r io.Reader) ([]*Problem, error) {
+	return ValidateWithBandLength(r, nil)
+}
+
+// ValidateWithBandLength works like Validate and also checks
+// band lengths against given reference band length table.
+func ValidateWithBandLength(r io.Reader, bandLen map[int]int) ([]*Problem, error) {
+	rd := &Reader{buf: bufio.NewReader(r)}
+	v := &validator{
+		ps:      make([]*Problem, 0, 10),
+		bandLen: bandLen,
+		lastIdx: -1,
+	}
+
+	if magic, _ := rd.buf.Peek(len(BINARY_MAGIC)); IsBinary(magic) {
+		return validateBinary(rd, v)
+	}
+
+	header, err := rd.readToken()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(header) == 0:
+		v.add(-1, -1, "missing human name")
+	case header[0] == '"' && (len(header) < 3 || header[len(header)-1] != '"'):
+		v.add(-1, -1, "unbalanced quotes: %s", header)
+	}
+
+	for {
+		// Skip extra spaces or line breaks between bands.
+		var label []byte
+		for len(label) == 0 {
+			if label, err = rd.readToken(); err != nil {
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		bandIdx, err := base.HexStr2int(string(label))
+		if err != nil {
+			// Assume it's the next band, so that following bands
+			// can still be checked for continuity.
+			bandIdx = v.lastIdx + 1
+			v.lastIdx = bandIdx
+			v.add(bandIdx, -1, "invalid hex band label(%s): %v", label, err)
+		} else {
+			v.checkOrder(bandIdx)
+		}
+
+		data, err := rd.readToken()
+		if err == io.EOF {
+			v.add(bandIdx, -1, "unexpected end of file, missing band body")
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		v.checkBody(bandIdx, data)
+	}
+	return v.finish(), nil
+}
+
+// validateBinary checks abv data in binary format,
+// labels and characters are guaranteed by format itself.
+func validateBinary(rd *Reader, v *validator) ([]*Problem, error) {
+	rd.binary = true
+	if err := rd.readBinaryHeader(); err != nil {
+		v.add(-1, -1, "invalid binary header: %v", err)
+		return v.ps, nil
+	} else if len(rd.Header) == 0 {
+		v.add(-1, -1, "missing human name")
+	}
+
+	for {
+		b, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// Corrupted stream cannot be continued.
+			v.add(v.lastIdx+1, -1, "%v", err)
+			return v.ps, nil
+		}
+
+		v.checkOrder(b.Index)
+		v.checkBody(b.Index, b.Data)
+	}
+	return v.finish(), nil
+}
@@ -0,0 +1,88 @@
+package abv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Validate(t *testing.T) {
+	type Val struct {
+		desc    string
+		data    string
+		bandLen map[int]int
+		// Problems are matched by prefix, descriptions of parse errors vary.
+		problems []string
+	}
+	vals := []Val{
+		{"valid bands", `"hu1" 0 ..D 1 -#. 2 Ec.`, nil, nil},
+		{"extra spaces between bands", "\"hu1\" 0 ..D   1 -#.\n", nil, nil},
+		{"discontinuous bands", `"hu1" 0 .. 3 ..`, nil,
+			[]string{"band 3: discontinuous, missing band(s) 1 to 2"}},
+		{"bands out of order", `"hu1" 0 .. 2 .. 1 ..`, nil, []string{
+			"band 2: discontinuous, missing band(s) 1 to 1",
+			"band 1: out of order, already seen band 2",
+		}},
+		{"hex labels", `"hu1" 8 .. 9 .. a .. b ..`, nil,
+			[]string{"band 8: discontinuous, missing band(s) 0 to 7"}},
+		{"invalid hex label", `"hu1" 0 .. zz .. 2 ..`, nil,
+			[]string{"band 1: invalid hex band label(zz)"}},
+		{"invalid characters", `"hu1" 0 .!. 1 ..A`, nil, []string{
+			"band 0, column 1: invalid character '!'",
+			"band 1, column 2: invalid character 'A'",
+		}},
+		{"unbalanced quotes", `"hu1 0 ..`, nil, []string{`header: unbalanced quotes: "hu1`}},
+		{"no band", `"hu1"`, nil, []string{"header: no band found"}},
+		{"missing band body", `"hu1" 0 .. 1`, nil,
+			[]string{"band 1: unexpected end of file, missing band body"}},
+		{"band lengths match reference", `"hu1" 0 ... 1 ..`, map[int]int{0: 3, 1: 2}, nil},
+		{"band length mismatches reference", `"hu1" 0 ... 1 ..`, map[int]int{0: 2, 1: 2},
+			[]string{"band 0: band length is 3 but reference is 2"}},
+		{"bands in reference are missing", `"hu1" 0 .`, map[int]int{0: 1, 1: 1, 2: 1},
+			[]string{"band 0: 2 band(s) in reference are missing after it"}},
+	}
+
+	Convey("Validate abv data in text format", t, func() {
+		for _, v := range vals {
+			ps, err := ValidateWithBandLength(strings.NewReader(v.data), v.bandLen)
+			So(err, ShouldBeNil)
+			So(len(ps), ShouldEqual, len(v.problems))
+			for i := range ps {
+				So(ps[i].Error(), ShouldStartWith, v.problems[i])
+			}
+
+			if v.bandLen == nil {
+				ps2, err := Validate(strings.NewReader(v.data))
+				So(err, ShouldBeNil)
+				So(ps2, ShouldResemble, ps)
+			}
+		}
+	})
+
+	Convey("Validate abv data in binary format", t, func() {
+		buf := new(bytes.Buffer)
+		So(writeBands(NewBinaryWriter(buf, "hu1", true), []*Band{
+			{Index: 0, Data: []byte("..D")},
+			{Index: 2, Data: []byte("-#.")},
+		}), ShouldBeNil)
+		data := buf.Bytes()
+
+		ps, err := Validate(bytes.NewReader(data))
+		So(err, ShouldBeNil)
+		So(len(ps), ShouldEqual, 1)
+		So(ps[0].Error(), ShouldEqual, "band 2: discontinuous, missing band(s) 1 to 1")
+
+		ps, err = ValidateWithBandLength(bytes.NewReader(data), map[int]int{0: 2, 2: 3, 3: 1})
+		So(err, ShouldBeNil)
+		So(len(ps), ShouldEqual, 3)
+		So(ps[0].Error(), ShouldEqual, "band 0: band length is 3 but reference is 2")
+		So(ps[1].Error(), ShouldEqual, "band 2: discontinuous, missing band(s) 1 to 1")
+		So(ps[2].Error(), ShouldEqual, "band 2: 1 band(s) in reference are missing after it")
+
+		ps, err = Validate(bytes.NewReader(data[:len(data)-2]))
+		So(err, ShouldBeNil)
+		So(len(ps), ShouldBeGreaterThan, 0)
+	})
+}
@@ -0,0 +1,40 @@
+package abv
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// Writer is the interface that writes abv data band by band.
+type Writer interface {
+	WriteBand(*Band) error
+	// Close flushes all data but does not close underlying writer.
+	Close() error
+}
+
+// TextWriter writes abv data in text format.
+type TextWriter struct {
+	w *bufio.Writer
+}
+
+// NewWriter writes header to given writer and returns a new writer of text abv format.
+func NewWriter(w io.Writer, header string) *TextWriter {
+	tw := &TextWriter{bufio.NewWriter(w)}
+	tw.w.WriteString(header)
+	return tw
+}
+
+func (tw *TextWriter) WriteBand(b *Band) error {
+	tw.w.WriteByte(' ')
+	tw.w.WriteString(base.Int2HexStr(b.Index))
+	tw.w.WriteByte(' ')
+	_, err := tw.w.Write(b.Data)
+	return err
+}
+
+func (tw *TextWriter) Close() error {
+	tw.w.WriteByte('\n')
+	return tw.w.Flush()
+}
@@ -0,0 +1,195 @@
+// Package annotate draws legend, axis labels and slot key around generated images,
+// so that data area of image is kept untouched for reversing.
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// SCALE is the number of pixels of every font pixel.
+const SCALE = 2
+
+const (
+	padding = 4
+	tickLen = 4
+	// Legend is never squeezed into columns shorter than this.
+	minLegendRows = 16
+)
+
+var (
+	Background = image.NewUniform(color.White)
+	Foreground = image.NewUniform(color.Black)
+)
+
+// Tick represents a label at given pixel offset along an axis of data area.
+type Tick struct {
+	Offset int
+	Label  string
+}
+
+// thinTicks returns ticks that can be labelled without overlapping, given the
+// size of each label along the axis and the length of axis. Ticks are kept
+// at a regular step of 1, 2 or 5 times power of 10 whenever possible.
+func thinTicks(ticks []Tick, size func(Tick) int, length int) []Tick {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	maxSize := 0
+	for _, t := range ticks {
+		if s := size(t); s > maxSize {
+			maxSize = s
+		}
+	}
+
+	step := 1
+	if len(ticks) > 1 {
+		avg := float64(ticks[len(ticks)-1].Offset-ticks[0].Offset) / float64(len(ticks)-1)
+		for i := 1; avg > 0 && float64(step)*avg < float64(maxSize); i++ {
+			step = []int{1, 2, 5}[i%3]
+			for j := 0; j < i/3; j++ {
+				step *= 10
+			}
+		}
+	}
+
+	kept := make([]Tick, 0, len(ticks)/step+1)
+	end := -1
+	for i, t := range ticks {
+		if i%step != 0 || t.Offset < end || t.Offset >= length {
+			continue
+		}
+		kept = append(kept, t)
+		end = t.Offset + size(t)
+	}
+	return kept
+}
+
+// maxLabelWidth returns the width of the widest label.
+func maxLabelWidth(labels []string) int {
+	width := 0
+	for _, label := range labels {
+		if w := TextWidth(label, SCALE); w > width {
+			width = w
+		}
+	}
+	return width
+}
+
+// LegendEntry represents a color and its label in legend.
+type LegendEntry struct {
+	Label string
+	Color color.Color
+}
+
+// VariantLegend returns entries of all variant colors, pound and unrecognized tile
+// of given color map.
+func VariantLegend(cm *base.ColorMap) []LegendEntry {
+	entries := make([]LegendEntry, 0, len(cm.Vars)+2)
+	for i, c := range cm.Vars {
+		entries = append(entries, LegendEntry{base.ToStr(i), c})
+	}
+	entries = append(entries,
+		LegendEntry{"#", cm.Pound},
+		LegendEntry{"-", cm.Unrecognized})
+	return entries
+}
+
+// drawBox draws a filled rectangle with outline in foreground color.
+func drawBox(m draw.Image, r image.Rectangle, fill image.Image) {
+	draw.Draw(m, r, Foreground, image.ZP, draw.Src)
+	draw.Draw(m, r.Inset(1), fill, image.ZP, draw.Src)
+}
+
+// Annotate returns a new image with given data image surrounded by band labels
+// on the left, position ticks on the top and given color legend on the right,
+// along with the area of data image in the new image.
+// Offsets of ticks are relative to top-left corner of data image.
+func Annotate(data image.Image, bands, positions []Tick, legend []LegendEntry) (*image.RGBA, image.Rectangle) {
+	dataW, dataH := data.Bounds().Dx(), data.Bounds().Dy()
+	textH := TextHeight(SCALE)
+
+	bands = thinTicks(bands, func(Tick) int { return textH + padding }, dataH)
+	positions = thinTicks(positions, func(t Tick) int {
+		return TextWidth(t.Label, SCALE) + padding
+	}, dataW)
+
+	bandLabels := make([]string, len(bands))
+	for i := range bands {
+		bandLabels[i] = bands[i].Label
+	}
+	left := padding + maxLabelWidth(bandLabels) + padding + tickLen
+	top := padding + textH + padding + tickLen
+
+	entryLabels := make([]string, len(legend))
+	for i := range legend {
+		entryLabels[i] = legend[i].Label
+	}
+	rowH := textH + padding
+	entryW := textH + padding + maxLabelWidth(entryLabels) + padding*2
+	rows := dataH / rowH
+	if rows < minLegendRows {
+		rows = minLegendRows
+	}
+	cols := (len(legend) + rows - 1) / rows
+
+	width := left + dataW + padding*2 + cols*entryW
+	height := top + dataH + textH
+	if h := top + rows*rowH; h > height {
+		height = h
+	}
+	height += padding
+
+	m := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(m, m.Bounds(), Background, image.ZP, draw.Src)
+	area := image.Rect(left, top, left+dataW, top+dataH)
+	draw.Draw(m, area, data, data.Bounds().Min, draw.Src)
+
+	// Band labels along the left margin.
+	for _, t := range bands {
+		y := top + t.Offset
+		DrawText(m, t.Label, left-tickLen-padding-TextWidth(t.Label, SCALE), y, SCALE, color.Black)
+		draw.Draw(m, image.Rect(left-tickLen, y, left, y+SCALE), Foreground, image.ZP, draw.Src)
+	}
+
+	// Position ticks on the top.
+	for _, t := range positions {
+		x := left + t.Offset
+		DrawText(m, t.Label, x, padding, SCALE, color.Black)
+		draw.Draw(m, image.Rect(x, top-tickLen, x+SCALE, top), Foreground, image.ZP, draw.Src)
+	}
+
+	// Color legend on the right.
+	x0 := left + dataW + padding*2
+	for i, e := range legend {
+		x := x0 + (i/rows)*entryW
+		y := top + (i%rows)*rowH
+		drawBox(m, image.Rect(x, y, x+textH, y+textH), image.NewUniform(e.Color))
+		DrawText(m, e.Label, x+textH+padding, y, SCALE, color.Black)
+	}
+	return m, area
+}
+
+// SlotKey returns an image showing which human sits in which slot of a box,
+// slots are filled row by row in a box of boxNum * boxNum.
+func SlotKey(names []string, boxNum int) *image.RGBA {
+	cellW := maxLabelWidth(names) + padding*2
+	cellH := TextHeight(SCALE) + padding*2
+	rows := (len(names) + boxNum - 1) / boxNum
+
+	m := image.NewRGBA(image.Rect(0, 0, boxNum*cellW+1, rows*cellH+1))
+	draw.Draw(m, m.Bounds(), Background, image.ZP, draw.Src)
+	for slot := 0; slot < rows*boxNum; slot++ {
+		x := (slot % boxNum) * cellW
+		y := (slot / boxNum) * cellH
+		drawBox(m, image.Rect(x, y, x+cellW+1, y+cellH+1), Background)
+		if slot < len(names) {
+			DrawText(m, names[slot], x+padding, y+padding, SCALE, color.Black)
+		}
+	}
+	return m
+}
@@ -0,0 +1,53 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func Test_thinTicks(t *testing.T) {
+	Convey("Thin ticks to avoid overlapping labels", t, func() {
+		ticks := make([]Tick, 100)
+		for i := range ticks {
+			ticks[i] = Tick{Offset: i * 2, Label: base.ToStr(i)}
+		}
+		size := func(Tick) int { return 15 }
+
+		kept := thinTicks(ticks, size, 200)
+		So(kept[0].Label, ShouldEqual, "0")
+		So(kept[1].Label, ShouldEqual, "10")
+		So(kept, ShouldHaveLength, 10)
+
+		So(thinTicks(ticks, size, 50), ShouldHaveLength, 3)
+		So(thinTicks(nil, size, 50), ShouldBeEmpty)
+		// Ticks at the same offset must not loop forever.
+		So(thinTicks([]Tick{{0, "a"}, {0, "b"}}, size, 50), ShouldHaveLength, 1)
+	})
+}
+
+func Test_Annotate(t *testing.T) {
+	base.ParseColorSpec("")
+
+	Convey("Keep data image untouched in data area", t, func() {
+		data := image.NewRGBA(image.Rect(0, 0, 40, 30))
+		draw.Draw(data, data.Bounds(), image.NewUniform(base.Colors.Background), image.ZP, draw.Src)
+		data.Set(3, 5, color.RGBA{1, 2, 3, 255})
+
+		m, area := Annotate(data, []Tick{{0, "0"}, {10, "1"}}, []Tick{{0, "0"}, {20, "1"}}, VariantLegend(base.Colors))
+		So(area.Dx(), ShouldEqual, 40)
+		So(area.Dy(), ShouldEqual, 30)
+		So(area.In(m.Bounds()), ShouldBeTrue)
+		So(area.Min, ShouldNotResemble, image.ZP)
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 40; x++ {
+				So(m.At(area.Min.X+x, area.Min.Y+y), ShouldResemble, data.At(x, y))
+			}
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// Size of glyph in font pixels.
+const (
+	GLYPH_WIDTH  = 3
+	GLYPH_HEIGHT = 5
+)
+
+// glyphs is a tiny bitmap font, every glyph is GLYPH_HEIGHT rows of GLYPH_WIDTH pixels.
+// Lowercase letters are drawn as uppercase ones.
+var glyphs = map[rune]string{
+	'0': "###" + "#.#" + "#.#" + "#.#" + "###",
+	'1': ".#." + "##." + ".#." + ".#." + "###",
+	'2': "###" + "..#" + "###" + "#.." + "###",
+	'3': "###" + "..#" + "###" + "..#" + "###",
+	'4': "#.#" + "#.#" + "###" + "..#" + "..#",
+	'5': "###" + "#.." + "###" + "..#" + "###",
+	'6': "###" + "#.." + "###" + "#.#" + "###",
+	'7': "###" + "..#" + "..#" + "..#" + "..#",
+	'8': "###" + "#.#" + "###" + "#.#" + "###",
+	'9': "###" + "#.#" + "###" + "..#" + "###",
+	'A': ".#." + "#.#" + "###" + "#.#" + "#.#",
+	'B': "##." + "#.#" + "##." + "#.#" + "##.",
+	'C': ".##" + "#.." + "#.." + "#.." + ".##",
+	'D': "##." + "#.#" + "#.#" + "#.#" + "##.",
+	'E': "###" + "#.." + "##." + "#.." + "###",
+	'F': "###" + "#.." + "##." + "#.." + "#..",
+	'G': ".##" + "#.." + "#.#" + "#.#" + ".##",
+	'H': "#.#" + "#.#" + "###" + "#.#" + "#.#",
+	'I': "###" + ".#." + ".#." + ".#." + "###",
+	'J': "..#" + "..#" + "..#" + "#.#" + ".#.",
+	'K': "#.#" + "#.#" + "##." + "#.#" + "#.#",
+	'L': "#.." + "#.." + "#.." + "#.." + "###",
+	'M': "#.#" + "###" + "###" + "#.#" + "#.#",
+	'N': "##." + "#.#" + "#.#" + "#.#" + "#.#",
+	'O': ".#." + "#.#" + "#.#" + "#.#" + ".#.",
+	'P': "##." + "#.#" + "##." + "#.." + "#..",
+	'Q': ".#." + "#.#" + "#.#" + "##." + ".##",
+	'R': "##." + "#.#" + "##." + "#.#" + "#.#",
+	'S': ".##" + "#.." + ".#." + "..#" + "##.",
+	'T': "###" + ".#." + ".#." + ".#." + ".#.",
+	'U': "#.#" + "#.#" + "#.#" + "#.#" + "###",
+	'V': "#.#" + "#.#" + "#.#" + "#.#" + ".#.",
+	'W': "#.#" + "#.#" + "###" + "###" + "#.#",
+	'X': "#.#" + "#.#" + ".#." + "#.#" + "#.#",
+	'Y': "#.#" + "#.#" + ".#." + ".#." + ".#.",
+	'Z': "###" + "..#" + ".#." + "#.." + "###",
+	'#': "#.#" + "###" + "#.#" + "###" + "#.#",
+	'-': "..." + "..." + "###" + "..." + "...",
+	'_': "..." + "..." + "..." + "..." + "###",
+	'.': "..." + "..." + "..." + "..." + ".#.",
+	':': "..." + ".#." + "..." + ".#." + "...",
+	'/': "..#" + "..#" + ".#." + "#.." + "#..",
+	' ': "..." + "..." + "..." + "..." + "...",
+	'?': "###" + "..#" + ".#." + "..." + ".#.",
+}
+
+// TextWidth returns width in pixels of given text drawn in given scale.
+func TextWidth(text string, scale int) int {
+	if len(text) == 0 {
+		return 0
+	}
+	return (len(text)*(GLYPH_WIDTH+1) - 1) * scale
+}
+
+// TextHeight returns height in pixels of text drawn in given scale.
+func TextHeight(scale int) int {
+	return GLYPH_HEIGHT * scale
+}
+
+// DrawText draws given text with top-left corner at given point,
+// characters without glyph are drawn as '?'.
+func DrawText(m draw.Image, text string, x, y, scale int, c color.Color) {
+	src := image.NewUniform(c)
+	for _, char := range strings.ToUpper(text) {
+		glyph, ok := glyphs[char]
+		if !ok {
+			glyph = glyphs['?']
+		}
+
+		for i := 0; i < len(glyph); i++ {
+			if glyph[i] != '#' {
+				continue
+			}
+			px := x + (i%GLYPH_WIDTH)*scale
+			py := y + (i/GLYPH_WIDTH)*scale
+			draw.Draw(m, image.Rect(px, py, px+scale, py+scale), src, image.ZP, draw.Src)
+		}
+		x += (GLYPH_WIDTH + 1) * scale
+	}
+}
@@ -1,14 +1,12 @@
 package base
 
 import (
+	"errors"
 	"fmt"
-	"image"
-	"image/color"
 	"io/ioutil"
 	"strings"
 
 	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
-	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
 )
 
 type Mode int
@@ -17,11 +15,15 @@ const (
 	SINGLE Mode = iota + 1
 	FULL_SIZE
 	TRANSPARENT
+	DIFF
+	HEATMAP
 )
 
 type Range struct {
-	EndBandIdx int
-	EndPosIdx  int
+	StartBandIdx int
+	EndBandIdx   int
+	StartPosIdx  int
+	EndPosIdx    int
 }
 
 type Option struct {
@@ -29,58 +31,128 @@ type Option struct {
 	Mode      Mode
 	AbvPath   string
 	ColorSpec string
+	Overflow  string
 	*Range
-	MaxColIdx   int
-	BoxNum      int
-	SlotPixel   int
-	Border      int
-	Force       bool
-	CountOnly   bool
-	ReversePath string
-	WindowSize  int
-	HttpPort    string
-	FastjPath   string
-	RefLibPath  string
+	MaxColIdx       int
+	BoxNum          int
+	SlotPixel       int
+	Border          int
+	Force           bool
+	DryRun          bool
+	KeepGoing       bool
+	CountOnly       bool
+	ReversePath     string
+	AbvDir          string
+	Jobs            int
+	WindowSize      int
+	HttpPort        string
+	FastjPath       string
+	RefLibPath      string
+	BandLenPath     string
+	MinCallRate     float64
+	MaxOverflowRate float64
+	MaxProblems     int
+	Format          string
+	OutputDir       string
+	Compress        bool
+	Output          string
+	BandsPerFile    int
+	Chunks          int
+	Tie             string
+	Order           string
+	Annotate        bool
+	DiffPath        string
+	Metric          string
+	Humans          int
+	Bands           int
+	BandSize        int
+	LenJitter       float64
+	Variants        int
+	Skew            float64
+	Divergence      float64
+	NoCallRate      float64
+	PoundRate       float64
+	Seed            int
 }
 
-// ParseOption parses command arguments into Option sutrct.
-func ParseOption(ctx *cli.Context) Option {
+// ParseOption parses command arguments into Option sutrct, flags that are not
+// given in command line take values from configuration file of -config.
+func ParseOption(ctx *cli.Context) (Option, error) {
+	if name := ctx.String("config"); len(name) > 0 {
+		if err := LoadConfig(ctx, name); err != nil {
+			return Option{}, err
+		}
+	}
+
 	opt := Option{
 		Mode:      Mode(ctx.Int("mode")),
 		ImgDir:    ctx.String("img-dir"),
 		AbvPath:   ctx.String("abv-path"),
 		ColorSpec: ctx.String("color-spec"),
+		Overflow:  ctx.String("overflow"),
 		Range: &Range{
-			EndBandIdx: ctx.Int("max-band"),
-			EndPosIdx:  ctx.Int("max-pos"),
+			StartBandIdx: ctx.Int("min-band"),
+			EndBandIdx:   ctx.Int("max-band"),
+			StartPosIdx:  ctx.Int("min-pos"),
+			EndPosIdx:    ctx.Int("max-pos"),
 		},
-		MaxColIdx:   ctx.Int("max-col"),
-		BoxNum:      ctx.Int("box-num"),
-		SlotPixel:   ctx.Int("slot-pixel"),
-		Border:      ctx.Int("border"),
-		Force:       ctx.Bool("force"),
-		CountOnly:   ctx.Bool("count-only"),
-		ReversePath: ctx.String("reverse-path"),
-		WindowSize:  ctx.Int("size"),
-		HttpPort:    ctx.String("http-port"),
-		FastjPath:   ctx.String("fastj-path"),
-		RefLibPath:  ctx.String("lib-path"),
+		MaxColIdx:       ctx.Int("max-col"),
+		BoxNum:          ctx.Int("box-num"),
+		SlotPixel:       ctx.Int("slot-pixel"),
+		Border:          ctx.Int("border"),
+		Force:           ctx.Bool("force"),
+		DryRun:          ctx.Bool("dry-run"),
+		KeepGoing:       ctx.Bool("keep-going"),
+		CountOnly:       ctx.Bool("count-only"),
+		ReversePath:     ctx.String("reverse-path"),
+		AbvDir:          ctx.String("abv-dir"),
+		Jobs:            ctx.Int("jobs"),
+		WindowSize:      ctx.Int("size"),
+		HttpPort:        ctx.String("http-port"),
+		FastjPath:       ctx.String("fastj-path"),
+		RefLibPath:      ctx.String("lib-path"),
+		BandLenPath:     ctx.String("band-len"),
+		MinCallRate:     ctx.Float64("min-call-rate"),
+		MaxOverflowRate: ctx.Float64("max-overflow-rate"),
+		MaxProblems:     ctx.Int("max-problems"),
+		Format:          ctx.String("format"),
+		OutputDir:       ctx.String("output-dir"),
+		Compress:        ctx.Bool("compress"),
+		Output:          ctx.String("output"),
+		BandsPerFile:    ctx.Int("bands-per-file"),
+		Chunks:          ctx.Int("chunks"),
+		Tie:             ctx.String("tie"),
+		Order:           ctx.String("order"),
+		Annotate:        ctx.Bool("annotate"),
+		DiffPath:        ctx.String("diff-path"),
+		Metric:          ctx.String("metric"),
+		Humans:          ctx.Int("humans"),
+		Bands:           ctx.Int("bands"),
+		BandSize:        ctx.Int("band-size"),
+		LenJitter:       ctx.Float64("len-jitter"),
+		Variants:        ctx.Int("variants"),
+		Skew:            ctx.Float64("skew"),
+		Divergence:      ctx.Float64("divergence"),
+		NoCallRate:      ctx.Float64("no-call-rate"),
+		PoundRate:       ctx.Float64("pound-rate"),
+		Seed:            ctx.Int("seed"),
 	}
 
 	switch {
-	case ctx.Command.Name != "stat" &&
+	case ctx.Command.Name == "gen" &&
 		(opt.Mode == FULL_SIZE || opt.Mode == TRANSPARENT) && opt.BoxNum < 13:
-		log.Fatal("-box-num cannot be smaller than 13 in full size or transparent mode")
+		return opt, errors.New("-box-num cannot be smaller than 13 in full size or transparent mode")
+	case opt.EndBandIdx >= 0 && opt.StartBandIdx > opt.EndBandIdx:
+		return opt, errors.New("-min-band cannot be greater than -max-band")
+	case opt.Overflow == OVERFLOW_CLAMP:
+		return opt, fmt.Errorf("-overflow %s is only for images generated by older versions", OVERFLOW_CLAMP)
 	}
-	return opt
+	return opt, nil
 }
 
-var (
-	Gray      = image.NewUniform(color.RGBA{230, 230, 230, 255})
-	PoundGray = image.NewUniform(color.RGBA{230, 230, 231, 255}) // #
-)
-
 // Make large enough to store and being able to convert back to abv file.
+// Variant 59 used to share color 0, 51, 255 with variant 7, it is 0, 51, 254
+// since duplicate colors are refused.
 const DefaultVarColors = `255, 255, 255
 0, 204, 0
 0, 255, 0
@@ -140,67 +212,38 @@ const DefaultVarColors = `255, 255, 255
 0, 48, 255
 0, 49, 255
 0, 50, 255
-0, 51, 255
+0, 51, 254
 0, 52, 255
 0, 53, 255`
 
-var VarColors = make([]color.Color, 0, 20)
-
-// GetVarColorIdx returns index of given variant color based on current color map.
-// It returns -1 when it's the background color, -2 when no match.
-func GetVarColorIdx(c color.Color) int {
-	r, g, b, a := c.RGBA()
-	var vr, vg, vb, va uint32 // Declare once to save cost.
-
-	// Compare to background color first.
-	vr, vg, vb, va = Gray.RGBA()
-	if r == vr && g == vg && b == vb && a == va {
-		return -1
-	}
-
-	// Try to match on color map.
-	for i, vc := range VarColors {
-		vr, vg, vb, va = vc.RGBA()
-		if r == vr && g == vg && b == vb && a == va {
-			return i
+// ParseColorSpec parses color map based on given file or built-in palette
+// with prefix "name:", uses default color map if spec is empty.
+// Parsed color map replaces the one currently in use.
+func ParseColorSpec(spec string) error {
+	var cm *ColorMap
+	switch {
+	case len(spec) == 0 || strings.HasPrefix(spec, PALETTE_PREFIX):
+		name := strings.TrimPrefix(spec, PALETTE_PREFIX)
+		if len(name) == 0 {
+			name = "default"
 		}
-	}
-
-	// See if it's a pound gray.
-	vr, vg, vb, va = PoundGray.RGBA()
-	if r == vr && g == vg && b == vb && a == va {
-		return 99
-	}
-
-	return -2
-}
-
-func parseVarColors(str string) error {
-	lines := strings.Split(str, "\n")
-	for i, line := range lines {
-		infos := strings.Split(line, ",")
-		if len(infos) < 3 {
-			return fmt.Errorf("Not enough color assigned in line[%d]: %s", i, line)
+		cs, err := NamedColors(name)
+		if err != nil {
+			return err
 		}
-		VarColors = append(VarColors, color.RGBA{
-			StrTo(strings.TrimSpace(infos[0])).MustUint8(),
-			StrTo(strings.TrimSpace(infos[1])).MustUint8(),
-			StrTo(strings.TrimSpace(infos[2])).MustUint8(), 255})
-	}
-	return nil
-}
-
-// ParseColorSpec parses color map based on given file,
-// uses default color map if path is empty.
-func ParseColorSpec(specPath string) error {
-	if IsFile(specPath) {
-		spec, err := ioutil.ReadFile(specPath)
+		cm = NewColorMap(cs)
+	case IsFile(spec):
+		data, err := ioutil.ReadFile(spec)
 		if err != nil {
 			return err
 		}
-		parseVarColors(string(spec))
-	} else {
-		parseVarColors(DefaultVarColors)
+		if cm, err = ParseColorMap(string(data)); err != nil {
+			return fmt.Errorf("%s: %v", spec, err)
+		}
+	default:
+		return fmt.Errorf("color specification does not exist or not a file: %s", spec)
 	}
+
+	Colors = cm
 	return nil
 }
@@ -0,0 +1,49 @@
+package base
+
+import (
+	"fmt"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+// Failure represents failure of processing a file in batch.
+type Failure struct {
+	Name string
+	Err  error
+}
+
+// BatchError represents failures of files that have been skipped
+// while rest of batch kept going.
+type BatchError struct {
+	Failures []Failure
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d file(s) failed", len(e.Failures))
+}
+
+// Batch collects failures of files in batch, so that processing
+// can continue past per-file failures when it keeps going.
+type Batch struct {
+	KeepGoing bool
+	Failures  []Failure
+}
+
+// Fail returns given error of file prefixed by file name,
+// or records it and returns nil when batch keeps going.
+func (b *Batch) Fail(name string, err error) error {
+	if !b.KeepGoing {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	log.Error("Skip %s: %v", name, err)
+	b.Failures = append(b.Failures, Failure{name, err})
+	return nil
+}
+
+// Err returns BatchError of all failures, or nil when there is none.
+func (b *Batch) Err() error {
+	if len(b.Failures) == 0 {
+		return nil
+	}
+	return &BatchError{b.Failures}
+}
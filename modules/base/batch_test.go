@@ -0,0 +1,33 @@
+package base
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Batch(t *testing.T) {
+	Convey("Stop at first failure", t, func() {
+		b := &Batch{}
+		err := b.Fail("a.abv", errors.New("bad band"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "a.abv: bad band")
+		So(b.Err(), ShouldBeNil)
+	})
+
+	Convey("Keep going past failures", t, func() {
+		b := &Batch{KeepGoing: true}
+		So(b.Err(), ShouldBeNil)
+		So(b.Fail("a.abv", errors.New("bad band")), ShouldBeNil)
+		So(b.Fail("b.abv", errors.New("bad pos")), ShouldBeNil)
+
+		err := b.Err()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "2 file(s) failed")
+		be, ok := err.(*BatchError)
+		So(ok, ShouldBeTrue)
+		So(be.Failures, ShouldHaveLength, 2)
+		So(be.Failures[1].Name, ShouldEqual, "b.abv")
+	})
+}
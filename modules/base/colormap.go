@@ -0,0 +1,354 @@
+package base
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Variant indexes of tiles that are not real variants.
+const (
+	VAR_UNKNOWN     = -2 // Color is not in color map.
+	VAR_UNRECOGNIZE = -1 // '-'
+	VAR_POUND       = 99 // '#'
+)
+
+// Policies of variant indexes beyond variant colors of color map. Variant indexes
+// of abv data are less than PALETTE_SIZE, which is size of default color map.
+const (
+	// OVERFLOW_EXTEND draws them in extra colors generated from default palette.
+	OVERFLOW_EXTEND = "extend"
+	// OVERFLOW_ALPHA draws them in color of the last variant with index
+	// encoded in alpha channel, which is unused in opaque images.
+	OVERFLOW_ALPHA = "alpha"
+	// OVERFLOW_ERROR refuses to draw them.
+	OVERFLOW_ERROR = "error"
+	// OVERFLOW_CLAMP draws them in color of the last variant, which loses
+	// them. It is only for images generated before policies were introduced.
+	OVERFLOW_CLAMP = "clamp"
+)
+
+// Default colors of tiles that are not real variants.
+var (
+	DefaultBackground = color.NRGBA{230, 230, 230, 255}
+	DefaultPound      = color.NRGBA{230, 230, 231, 255}
+)
+
+// ColorMap represents colors of variants, pound and unrecognized tiles,
+// along with background color of images.
+// It should not be modified after creation.
+type ColorMap struct {
+	Vars         []color.NRGBA
+	Background   color.NRGBA
+	Pound        color.NRGBA // '#'
+	Unrecognized color.NRGBA // '-', same as background by default.
+	// Overflow is policy of variant indexes beyond Vars, OVERFLOW_EXTEND by default.
+	Overflow string
+
+	extra []color.NRGBA // Colors of variant indexes beyond Vars for OVERFLOW_EXTEND.
+	index map[color.RGBA]int
+}
+
+// Colors is the color map currently in use.
+var Colors = NewColorMap(defaultPalette(PALETTE_SIZE))
+
+// NewColorMap returns a new color map of given variant colors
+// and default colors of background, pound and unrecognized tiles.
+func NewColorMap(vars []color.NRGBA) *ColorMap {
+	cm := &ColorMap{
+		Vars:         vars,
+		Background:   DefaultBackground,
+		Pound:        DefaultPound,
+		Unrecognized: DefaultBackground,
+		Overflow:     OVERFLOW_EXTEND,
+	}
+	cm.buildIndex()
+	return cm
+}
+
+// WithOverflow returns copy of color map with given policy
+// of variant indexes beyond variant colors.
+func (cm *ColorMap) WithOverflow(policy string) (*ColorMap, error) {
+	switch policy {
+	case "":
+		policy = OVERFLOW_EXTEND
+	case OVERFLOW_EXTEND, OVERFLOW_ALPHA, OVERFLOW_ERROR, OVERFLOW_CLAMP:
+	default:
+		return nil, fmt.Errorf("unknown overflow policy '%s', expect %s, %s or %s",
+			policy, OVERFLOW_EXTEND, OVERFLOW_ALPHA, OVERFLOW_ERROR)
+	}
+
+	c := *cm
+	c.Overflow = policy
+	c.buildIndex()
+	return &c, nil
+}
+
+// colorKey returns color as it is stored in an RGBA image.
+func colorKey(c color.Color) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+func (cm *ColorMap) buildIndex() {
+	cm.index = make(map[color.RGBA]int, len(cm.Vars)+3)
+	add := func(c color.NRGBA, idx int) {
+		key := colorKey(c)
+		if _, ok := cm.index[key]; !ok {
+			cm.index[key] = idx
+		}
+	}
+
+	add(cm.Background, VAR_UNRECOGNIZE)
+	add(cm.Unrecognized, VAR_UNRECOGNIZE)
+	for i, c := range cm.Vars {
+		add(c, i)
+	}
+	add(cm.Pound, VAR_POUND)
+
+	cm.extra = nil
+	if cm.Overflow == OVERFLOW_EXTEND {
+		cm.extra = cm.extraColors()
+		for i, c := range cm.extra {
+			add(c, len(cm.Vars)+i)
+		}
+	}
+}
+
+// extraColors returns colors of variant indexes beyond Vars, which are colors
+// of default palette nudged away from all colors of color map.
+func (cm *ColorMap) extraColors() []color.NRGBA {
+	// Color map without variant colors is still being parsed.
+	if len(cm.Vars) == 0 || len(cm.Vars) >= PALETTE_SIZE {
+		return nil
+	}
+
+	seen := make(map[color.RGBA]bool, len(cm.index))
+	for key := range cm.index {
+		seen[key] = true
+	}
+	defaults := defaultPalette(PALETTE_SIZE)
+	extra := make([]color.NRGBA, PALETTE_SIZE-len(cm.Vars))
+	for i := range extra {
+		c := defaults[len(cm.Vars)+i]
+		for step := 1; seen[colorKey(c)]; step++ {
+			c = nudgeColor(defaults[len(cm.Vars)+i], step)
+		}
+		extra[i] = c
+		seen[colorKey(c)] = true
+	}
+	return extra
+}
+
+// Index returns variant index of given color, VAR_UNRECOGNIZE for
+// unrecognized tile or background, VAR_POUND for pound tile and
+// VAR_UNKNOWN when color is not in color map.
+func (cm *ColorMap) Index(c color.Color) int {
+	key := colorKey(c)
+	if idx, ok := cm.index[key]; ok {
+		return idx
+	}
+
+	// Only alpha is decoded, because other channels may be rounded
+	// when translucent color is encoded to and decoded from PNG.
+	if cm.Overflow == OVERFLOW_ALPHA && key.A > 0 && key.A < 255 {
+		if idx := len(cm.Vars) + 254 - int(key.A); idx < PALETTE_SIZE {
+			return idx
+		}
+	}
+	return VAR_UNKNOWN
+}
+
+// Color returns color of given variant index. Variant index beyond Vars
+// is drawn by policy of color map, and the last variant color is used
+// in case it has no color by policy.
+func (cm *ColorMap) Color(idx int) color.NRGBA {
+	switch {
+	case idx == VAR_POUND:
+		return cm.Pound
+	case idx < 0:
+		return cm.Unrecognized
+	case idx < len(cm.Vars):
+		return cm.Vars[idx]
+	}
+
+	c := cm.Vars[len(cm.Vars)-1]
+	switch k := idx - len(cm.Vars); {
+	case cm.Overflow == OVERFLOW_EXTEND && k < len(cm.extra):
+		return cm.extra[k]
+	case cm.Overflow == OVERFLOW_ALPHA && idx < PALETTE_SIZE:
+		c.A = uint8(254 - k)
+	}
+	return c
+}
+
+// CheckVariant returns error if given variant index is beyond Vars
+// and policy of color map refuses to draw it.
+func (cm *ColorMap) CheckVariant(idx int) error {
+	if cm.Overflow == OVERFLOW_ERROR && idx >= len(cm.Vars) && idx != VAR_POUND {
+		return fmt.Errorf("variant %d is beyond %d color(s) of color map", idx, len(cm.Vars))
+	}
+	return nil
+}
+
+// DrawUnrecognized returns true if unrecognized tiles have to be drawn
+// explicitly because they are different from background.
+func (cm *ColorMap) DrawUnrecognized() bool {
+	return colorKey(cm.Unrecognized) != colorKey(cm.Background)
+}
+
+// Validate returns error if any two variants share the same color or any
+// variant uses color of background, pound or unrecognized tiles,
+// which makes images irreversible.
+func (cm *ColorMap) Validate() error {
+	seen := make(map[color.RGBA]string, len(cm.Vars)+3)
+	check := func(name string, c color.NRGBA) error {
+		key := colorKey(c)
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("color of %s(%s) is the same as %s", name, formatColor(c), other)
+		}
+		seen[key] = name
+		return nil
+	}
+
+	if err := check("background", cm.Background); err != nil {
+		return err
+	}
+	if cm.DrawUnrecognized() {
+		if err := check("unrecognized", cm.Unrecognized); err != nil {
+			return err
+		}
+	}
+	if err := check("pound", cm.Pound); err != nil {
+		return err
+	}
+	for i, c := range cm.Vars {
+		if err := check("variant "+ToStr(i), c); err != nil {
+			return err
+		}
+	}
+
+	// Translucent colors are taken as variant indexes encoded in alpha channel.
+	if cm.Overflow == OVERFLOW_ALPHA {
+		for key, name := range seen {
+			if key.A != 255 {
+				return fmt.Errorf("color of %s is not opaque, which is required by overflow policy '%s'", name, OVERFLOW_ALPHA)
+			}
+		}
+	}
+	return nil
+}
+
+func formatColor(c color.NRGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf("%d, %d, %d", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("%d, %d, %d, %d", c.R, c.G, c.B, c.A)
+}
+
+// String returns color map in format of color specification file,
+// colors of background, pound and unrecognized tiles are only
+// included when they are not default.
+func (cm *ColorMap) String() string {
+	lines := make([]string, 0, len(cm.Vars)+3)
+	for _, c := range cm.Vars {
+		lines = append(lines, formatColor(c))
+	}
+	if cm.Background != DefaultBackground {
+		lines = append(lines, "background: "+formatColor(cm.Background))
+	}
+	if cm.Pound != DefaultPound {
+		lines = append(lines, "#: "+formatColor(cm.Pound))
+	}
+	if cm.DrawUnrecognized() {
+		lines = append(lines, "-: "+formatColor(cm.Unrecognized))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseColor parses color in format of "r, g, b", "r, g, b, a",
+// "#rrggbb" or "#rrggbbaa".
+func parseColor(str string) (color.NRGBA, error) {
+	var vals []uint8
+	if strings.HasPrefix(str, "#") {
+		hex := str[1:]
+		if len(hex) != 6 && len(hex) != 8 {
+			return color.NRGBA{}, fmt.Errorf("hex color must be #rrggbb or #rrggbbaa: %s", str)
+		}
+		for i := 0; i < len(hex); i += 2 {
+			v, err := strconv.ParseUint(hex[i:i+2], 16, 8)
+			if err != nil {
+				return color.NRGBA{}, fmt.Errorf("invalid hex color: %s", str)
+			}
+			vals = append(vals, uint8(v))
+		}
+	} else {
+		infos := strings.Split(str, ",")
+		if len(infos) != 3 && len(infos) != 4 {
+			return color.NRGBA{}, fmt.Errorf("color must have 3 or 4 values: %s", str)
+		}
+		for _, info := range infos {
+			v, err := strconv.Atoi(strings.TrimSpace(info))
+			if err != nil || v < 0 || v > 255 {
+				return color.NRGBA{}, fmt.Errorf("color value must be 0-255: %s", strings.TrimSpace(info))
+			}
+			vals = append(vals, uint8(v))
+		}
+	}
+
+	c := color.NRGBA{vals[0], vals[1], vals[2], 255}
+	if len(vals) == 4 {
+		c.A = vals[3]
+	}
+	return c, nil
+}
+
+// ParseColorMap parses color map in format of color specification file.
+// Every line is a variant color in order, lines start with "background:",
+// "#:" or "-:" set colors of background, pound and unrecognized tiles.
+// Text after "//" is comment.
+func ParseColorMap(data string) (*ColorMap, error) {
+	cm := NewColorMap(nil)
+	hasUnrecognized := false
+	for i, line := range strings.Split(data, "\n") {
+		if idx := strings.Index(line, "//"); idx > -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		key := ""
+		if idx := strings.Index(line, ":"); idx > -1 {
+			key, line = strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+		}
+		c, err := parseColor(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+
+		switch key {
+		case "":
+			cm.Vars = append(cm.Vars, c)
+		case "background":
+			cm.Background = c
+			if !hasUnrecognized {
+				cm.Unrecognized = c
+			}
+		case "#":
+			cm.Pound = c
+		case "-":
+			cm.Unrecognized = c
+			hasUnrecognized = true
+		default:
+			return nil, fmt.Errorf("line %d: unknown key '%s', expect 'background', '#' or '-'", i+1, key)
+		}
+	}
+	if len(cm.Vars) == 0 {
+		return nil, fmt.Errorf("no variant color is assigned")
+	}
+
+	cm.buildIndex()
+	return cm, nil
+}
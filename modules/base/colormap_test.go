@@ -0,0 +1,155 @@
+package base
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_ParseColorMap(t *testing.T) {
+	Convey("Parse colors in all formats", t, func() {
+		cm, err := ParseColorMap(`// Variants.
+255, 255, 255
+#00cc00   // Hex.
+0, 0, 255, 128
+#ff000080
+
+background: 0, 0, 0
+#: #e6e6e7
+-: 10, 10, 10
+`)
+		So(err, ShouldBeNil)
+		So(cm.Vars, ShouldResemble, []color.NRGBA{
+			{255, 255, 255, 255},
+			{0, 204, 0, 255},
+			{0, 0, 255, 128},
+			{255, 0, 0, 128},
+		})
+		So(cm.Background, ShouldResemble, color.NRGBA{0, 0, 0, 255})
+		So(cm.Pound, ShouldResemble, color.NRGBA{230, 230, 231, 255})
+		So(cm.Unrecognized, ShouldResemble, color.NRGBA{10, 10, 10, 255})
+		So(cm.DrawUnrecognized(), ShouldBeTrue)
+		So(cm.Validate(), ShouldBeNil)
+
+		Convey("Format back to the same color map", func() {
+			cm2, err := ParseColorMap(cm.String())
+			So(err, ShouldBeNil)
+			So(cm2, ShouldResemble, cm)
+		})
+	})
+
+	Convey("Unrecognized tiles follow background by default", t, func() {
+		cm, err := ParseColorMap("255, 255, 255\nbackground: 1, 2, 3")
+		So(err, ShouldBeNil)
+		So(cm.Unrecognized, ShouldResemble, color.NRGBA{1, 2, 3, 255})
+		So(cm.DrawUnrecognized(), ShouldBeFalse)
+	})
+
+	Convey("Report errors with line number", t, func() {
+		for data, msg := range map[string]string{
+			"255, 255, 255\n300, 0, 0":     "line 2: color value must be 0-255: 300",
+			"255, 255\n":                   "line 1: color must have 3 or 4 values",
+			"// Comment.\n#00cc0":          "line 2: hex color must be",
+			"#00gg00":                      "line 1: invalid hex color",
+			"255, 255, 255\nborder: 0,0,0": "line 2: unknown key 'border'",
+			"// Nothing.\n":                "no variant color",
+		} {
+			_, err := ParseColorMap(data)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, msg)
+		}
+	})
+}
+
+func Test_ColorMap_Index(t *testing.T) {
+	Convey("Look up variant index of colors", t, func() {
+		cm := NewColorMap([]color.NRGBA{{255, 255, 255, 255}, {0, 204, 0, 255}})
+		So(cm.Index(color.RGBA{255, 255, 255, 255}), ShouldEqual, 0)
+		So(cm.Index(color.NRGBA{0, 204, 0, 255}), ShouldEqual, 1)
+		So(cm.Index(DefaultBackground), ShouldEqual, VAR_UNRECOGNIZE)
+		So(cm.Index(DefaultPound), ShouldEqual, VAR_POUND)
+		So(cm.Index(color.RGBA{1, 2, 3, 255}), ShouldEqual, VAR_UNKNOWN)
+
+		So(cm.Color(1), ShouldResemble, color.NRGBA{0, 204, 0, 255})
+		So(cm.Color(VAR_POUND), ShouldResemble, DefaultPound)
+		So(cm.Color(VAR_UNRECOGNIZE), ShouldResemble, DefaultBackground)
+	})
+
+	Convey("Extend color map with distinct colors", t, func() {
+		cm := NewColorMap([]color.NRGBA{{255, 255, 255, 255}, {0, 204, 0, 255}})
+		So(cm.Overflow, ShouldEqual, OVERFLOW_EXTEND)
+		seen := make(map[color.NRGBA]bool)
+		for i := 0; i < PALETTE_SIZE; i++ {
+			c := cm.Color(i)
+			So(seen[c], ShouldBeFalse)
+			seen[c] = true
+			So(cm.Index(c), ShouldEqual, i)
+		}
+		So(cm.Validate(), ShouldBeNil)
+		So(cm.CheckVariant(PALETTE_SIZE-1), ShouldBeNil)
+	})
+
+	Convey("Encode variant index in alpha channel", t, func() {
+		cm, err := NewColorMap([]color.NRGBA{{255, 255, 255, 255}, {0, 204, 0, 255}}).WithOverflow(OVERFLOW_ALPHA)
+		So(err, ShouldBeNil)
+		So(cm.Color(2), ShouldResemble, color.NRGBA{0, 204, 0, 254})
+		So(cm.Color(PALETTE_SIZE-1), ShouldResemble, color.NRGBA{0, 204, 0, 195})
+		So(cm.Validate(), ShouldBeNil)
+
+		// As stored in and decoded from PNG image.
+		m := image.NewRGBA(image.Rect(0, 0, PALETTE_SIZE, 1))
+		for i := 0; i < PALETTE_SIZE; i++ {
+			m.Set(i, 0, cm.Color(i))
+		}
+		buf := new(bytes.Buffer)
+		So(png.Encode(buf, m), ShouldBeNil)
+		decoded, err := png.Decode(buf)
+		So(err, ShouldBeNil)
+		for i := 0; i < PALETTE_SIZE; i++ {
+			So(cm.Index(decoded.At(i, 0)), ShouldEqual, i)
+		}
+
+		cm, _ = NewColorMap([]color.NRGBA{{255, 255, 255, 255}, {0, 0, 255, 128}}).WithOverflow(OVERFLOW_ALPHA)
+		So(cm.Validate(), ShouldNotBeNil)
+	})
+
+	Convey("Refuse or clamp variants beyond color map", t, func() {
+		cm, err := NewColorMap([]color.NRGBA{{255, 255, 255, 255}, {0, 204, 0, 255}}).WithOverflow(OVERFLOW_ERROR)
+		So(err, ShouldBeNil)
+		So(cm.CheckVariant(1), ShouldBeNil)
+		So(cm.CheckVariant(VAR_POUND), ShouldBeNil)
+		So(cm.CheckVariant(5).Error(), ShouldEqual, "variant 5 is beyond 2 color(s) of color map")
+
+		cm, err = cm.WithOverflow(OVERFLOW_CLAMP)
+		So(err, ShouldBeNil)
+		So(cm.Color(5), ShouldResemble, color.NRGBA{0, 204, 0, 255})
+		So(cm.Index(cm.Color(5)), ShouldEqual, 1)
+
+		_, err = cm.WithOverflow("wrap")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Look up translucent colors as stored in image", t, func() {
+		c := color.NRGBA{0, 0, 255, 128}
+		cm := NewColorMap([]color.NRGBA{{255, 255, 255, 255}, c})
+		So(cm.Index(color.RGBAModel.Convert(c)), ShouldEqual, 1)
+	})
+}
+
+func Test_ColorMap_Validate(t *testing.T) {
+	Convey("Report colors that make image irreversible", t, func() {
+		cm := NewColorMap([]color.NRGBA{{255, 255, 255, 255}, DefaultPound})
+		So(cm.Validate().Error(), ShouldEqual, "color of variant 1(230, 230, 231) is the same as pound")
+
+		cm, _ = ParseColorMap("255, 255, 255\n-: 255, 255, 255")
+		So(cm.Validate().Error(), ShouldEqual, "color of variant 0(255, 255, 255) is the same as unrecognized")
+
+		// Translucent colors that are the same once stored in image.
+		cm = NewColorMap([]color.NRGBA{{0, 0, 0, 0}, {255, 255, 255, 0}})
+		So(cm.Validate(), ShouldNotBeNil)
+	})
+}
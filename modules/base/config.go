@@ -0,0 +1,127 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+// CONFIG_FILE is the name of effective configuration saved along with images.
+const CONFIG_FILE = "config.json"
+
+// LoadConfig sets flags that are not given in command line by values
+// in given configuration file, which is a JSON object whose keys are
+// long names of flags, e.g. {"mode": 2, "box-num": 15}. Keys of flags
+// the command does not have are skipped, so a config file of gen
+// can be used by other commands.
+func LoadConfig(ctx *cli.Context, name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var vals map[string]interface{}
+	if err = dec.Decode(&vals); err != nil {
+		return fmt.Errorf("fail to decode config file(%s): %v", name, err)
+	}
+
+	keys := make([]string, 0, len(vals))
+	for key := range vals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	flags := flagNames(ctx.Command)
+	for _, key := range keys {
+		if key == "config" {
+			return fmt.Errorf("config file(%s) cannot include another config file", name)
+		} else if !flags[key] {
+			log.Debug("Skip %s in config file(%s), command %s does not have it", key, name, ctx.Command.Name)
+			continue
+		} else if ctx.IsSet(key) {
+			continue
+		}
+
+		var value string
+		switch v := vals[key].(type) {
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = strconv.FormatBool(v)
+		case string:
+			value = v
+		default:
+			return fmt.Errorf("invalid value of %s in config file(%s): %v", key, name, v)
+		}
+		if err = ctx.Set(key, value); err != nil {
+			return fmt.Errorf("invalid %s in config file(%s): %v", key, name, err)
+		}
+	}
+	return nil
+}
+
+// longName returns long name of flag with given names, e.g. "keep-going, k".
+func longName(names string) string {
+	return strings.TrimSpace(strings.Split(names, ",")[0])
+}
+
+// flagNames returns long names of all flags of given command.
+func flagNames(cmd cli.Command) map[string]bool {
+	names := make(map[string]bool, len(cmd.Flags))
+	for _, f := range cmd.Flags {
+		switch f := f.(type) {
+		case cli.BoolFlag:
+			names[longName(f.Name)] = true
+		case cli.IntFlag:
+			names[longName(f.Name)] = true
+		case cli.Float64Flag:
+			names[longName(f.Name)] = true
+		case cli.StringFlag:
+			names[longName(f.Name)] = true
+		}
+	}
+	return names
+}
+
+// runFlags control how a run goes rather than what it produces,
+// so they are not saved in configuration.
+var runFlags = []string{"config", "force", "dry-run", "keep-going", "help", "generate-bash-completion"}
+
+// SaveConfig saves effective values of all flags of command to given path,
+// which can be loaded by -config to reproduce the run.
+func SaveConfig(ctx *cli.Context, name string) error {
+	vals := make(map[string]interface{})
+	for _, f := range ctx.Command.Flags {
+		switch f := f.(type) {
+		case cli.BoolFlag:
+			vals[longName(f.Name)] = ctx.Bool(longName(f.Name))
+		case cli.IntFlag:
+			vals[longName(f.Name)] = ctx.Int(longName(f.Name))
+		case cli.Float64Flag:
+			vals[longName(f.Name)] = ctx.Float64(longName(f.Name))
+		case cli.StringFlag:
+			vals[longName(f.Name)] = ctx.String(longName(f.Name))
+		}
+	}
+	for _, name := range runFlags {
+		delete(vals, name)
+	}
+
+	data, err := json.MarshalIndent(vals, "", "\t")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(path.Dir(name), os.ModePerm)
+	return ioutil.WriteFile(name, append(data, '\n'), 0644)
+}
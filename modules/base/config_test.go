@@ -0,0 +1,123 @@
+package base
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+)
+
+// runCmd runs a command of given name, flags and arguments with given action.
+func runCmd(name string, flags []cli.Flag, action func(ctx *cli.Context), args ...string) {
+	app := cli.NewApp()
+	app.Commands = []cli.Command{{
+		Name:   name,
+		Action: action,
+		Flags:  flags,
+	}}
+	app.Run(append([]string{"tr", name}, args...))
+}
+
+// runGen runs a gen command of given arguments with given action.
+func runGen(action func(ctx *cli.Context), args ...string) {
+	runCmd("gen", []cli.Flag{
+		cli.IntFlag{"mode, m", 0, ""},
+		cli.StringFlag{"img-dir", "tr_imgs", ""},
+		cli.IntFlag{"box-num", 15, ""},
+		cli.IntFlag{"max-band", 9, ""},
+		cli.BoolFlag{"keep-going, k", ""},
+		cli.BoolFlag{"force, f", ""},
+		cli.BoolFlag{"dry-run, n", ""},
+		cli.StringFlag{"config", "", ""},
+	}, action, args...)
+}
+
+func Test_Config(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := path.Join(dir, "run.json")
+	if err = ioutil.WriteFile(name, []byte(`{"mode": 2, "box-num": 13, "keep-going": true, "img-dir": "out"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Flags in command line override config file", t, func() {
+		var opt Option
+		runGen(func(ctx *cli.Context) {
+			opt, err = ParseOption(ctx)
+		}, "-config", name, "-box-num", "14", "-max-band", "20")
+		So(err, ShouldBeNil)
+		So(opt.Mode, ShouldEqual, FULL_SIZE)
+		So(opt.BoxNum, ShouldEqual, 14)
+		So(opt.EndBandIdx, ShouldEqual, 20)
+		So(opt.KeepGoing, ShouldBeTrue)
+		So(opt.ImgDir, ShouldEqual, "out")
+	})
+
+	Convey("Return errors of invalid config and options", t, func() {
+		bad := path.Join(dir, "bad.json")
+		So(ioutil.WriteFile(bad, []byte(`{"box-num": "many"}`), 0644), ShouldBeNil)
+		runGen(func(ctx *cli.Context) {
+			_, err = ParseOption(ctx)
+		}, "-config", bad)
+		So(err, ShouldNotBeNil)
+
+		runGen(func(ctx *cli.Context) {
+			_, err = ParseOption(ctx)
+		}, "-config", name, "-box-num", "10")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Save effective config that can be loaded back", t, func() {
+		saved := path.Join(dir, "out", CONFIG_FILE)
+		runGen(func(ctx *cli.Context) {
+			_, err = ParseOption(ctx)
+			if err == nil {
+				err = SaveConfig(ctx, saved)
+			}
+		}, "-config", name, "-force")
+		So(err, ShouldBeNil)
+
+		// Run-control flags are not part of reproducing the run.
+		data, err := ioutil.ReadFile(saved)
+		So(err, ShouldBeNil)
+		var vals map[string]interface{}
+		So(json.Unmarshal(data, &vals), ShouldBeNil)
+		So(vals, ShouldResemble, map[string]interface{}{
+			"mode":     2.0,
+			"img-dir":  "out",
+			"box-num":  13.0,
+			"max-band": 9.0,
+		})
+
+		var opt Option
+		runGen(func(ctx *cli.Context) {
+			opt, err = ParseOption(ctx)
+		}, "-config", saved)
+		So(err, ShouldBeNil)
+		So(opt.BoxNum, ShouldEqual, 13)
+		So(opt.KeepGoing, ShouldBeFalse)
+	})
+
+	Convey("Load config of gen in command without some of its flags", t, func() {
+		var opt Option
+		runCmd("reverse", []cli.Flag{
+			cli.IntFlag{"mode, m", 0, ""},
+			cli.StringFlag{"img-dir", "tr_imgs", ""},
+			cli.StringFlag{"config", "", ""},
+		}, func(ctx *cli.Context) {
+			opt, err = ParseOption(ctx)
+		}, "-config", name)
+		So(err, ShouldBeNil)
+		So(opt.Mode, ShouldEqual, FULL_SIZE)
+		So(opt.ImgDir, ShouldEqual, "out")
+	})
+}
@@ -0,0 +1,206 @@
+package base
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+// PALETTE_PREFIX is the prefix of color specification to select a built-in palette.
+const PALETTE_PREFIX = "name:"
+
+// PALETTE_SIZE is the number of variant colors of built-in palettes,
+// same as default color map.
+const PALETTE_SIZE = 62
+
+// palette generates colors of a built-in palette.
+type palette func(n int) []color.NRGBA
+
+// Categorical palettes only have 10(categorical) or 8(colorblind) base colors,
+// variants beyond them get lighter and darker shades of the same colors, which
+// are still unique but no longer easy to tell apart or color blind safe.
+var palettes = map[string]palette{
+	"default":     defaultPalette,
+	"viridis":     gradientPalette(viridisStops),
+	"categorical": cyclePalette(tableau10),
+	"colorblind":  cyclePalette(okabeIto),
+}
+
+// PaletteNames returns names of all built-in palettes in alphabetical order.
+func PaletteNames() []string {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Anchor colors of viridis colormap from matplotlib, evenly spaced.
+var viridisStops = []color.NRGBA{
+	{68, 1, 84, 255},
+	{71, 44, 122, 255},
+	{59, 81, 139, 255},
+	{44, 113, 142, 255},
+	{33, 145, 140, 255},
+	{39, 173, 129, 255},
+	{92, 200, 99, 255},
+	{170, 220, 50, 255},
+	{253, 231, 37, 255},
+}
+
+// Category colors of Tableau 10.
+var tableau10 = []color.NRGBA{
+	{31, 119, 180, 255},
+	{255, 127, 14, 255},
+	{44, 160, 44, 255},
+	{214, 39, 40, 255},
+	{148, 103, 189, 255},
+	{140, 86, 75, 255},
+	{227, 119, 194, 255},
+	{127, 127, 127, 255},
+	{188, 189, 34, 255},
+	{23, 190, 207, 255},
+}
+
+// Colors of Okabe-Ito palette, which are distinguishable with color blindness.
+var okabeIto = []color.NRGBA{
+	{230, 159, 0, 255},
+	{86, 180, 233, 255},
+	{0, 158, 115, 255},
+	{240, 228, 66, 255},
+	{0, 114, 178, 255},
+	{213, 94, 0, 255},
+	{204, 121, 167, 255},
+	{0, 0, 0, 255},
+}
+
+// defaultPalette returns first n colors of default color map,
+// which repeat like categorical palettes when n is greater.
+// Default color map is in use when package is initialized,
+// so it panics right at start if the constant is ever broken.
+func defaultPalette(n int) []color.NRGBA {
+	cm, err := ParseColorMap(DefaultVarColors)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default color map: %v", err))
+	}
+	return cyclePalette(cm.Vars)(n)
+}
+
+// gradientColor returns color at t(0-1) of linear gradient between given stops.
+func gradientColor(stops []color.NRGBA, t float64) color.NRGBA {
+	switch {
+	case t <= 0:
+		return stops[0]
+	case t >= 1:
+		return stops[len(stops)-1]
+	}
+	t *= float64(len(stops) - 1)
+	lo := int(t)
+	return mixColor(stops[lo], stops[lo+1], t-float64(lo))
+}
+
+// Ramp returns color at t(0-1) of viridis colormap as a continuous color ramp.
+func Ramp(t float64) color.NRGBA {
+	return gradientColor(viridisStops, t)
+}
+
+// gradientPalette returns a palette that interpolates between given stops.
+// Colors are spaced logarithmically because low variant indexes are far more
+// common, so they get most of the visual range.
+func gradientPalette(stops []color.NRGBA) palette {
+	return func(n int) []color.NRGBA {
+		cs := make([]color.NRGBA, n)
+		for i := range cs {
+			cs[i] = gradientColor(stops, math.Log1p(float64(i))/math.Log(float64(n)))
+		}
+		return cs
+	}
+}
+
+// cyclePalette returns a palette that repeats given colors,
+// every round alternately lighter and darker than the previous ones.
+func cyclePalette(base []color.NRGBA) palette {
+	return func(n int) []color.NRGBA {
+		cs := make([]color.NRGBA, n)
+		for i := range cs {
+			c := base[i%len(base)]
+			switch round := i / len(base); {
+			case round == 0:
+				cs[i] = c
+			case round%2 == 1:
+				cs[i] = mixColor(c, color.NRGBA{255, 255, 255, 255}, 0.15*float64(round/2+1))
+			default:
+				cs[i] = mixColor(c, color.NRGBA{0, 0, 0, 255}, 0.15*float64(round/2))
+			}
+		}
+		return cs
+	}
+}
+
+// mixColor returns color at t(0-1) between a and b.
+func mixColor(a, b color.NRGBA, t float64) color.NRGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*t + 0.5)
+	}
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// distinctColors nudges colors that collide with previous colors or default
+// colors of background and pound tiles by the smallest step on one channel,
+// so every color is unique and images can be reversed.
+// Such changes are invisible to eyes.
+func distinctColors(cs []color.NRGBA) []color.NRGBA {
+	seen := map[color.NRGBA]bool{DefaultBackground: true, DefaultPound: true}
+	for i, c := range cs {
+		for step := 1; seen[c]; step++ {
+			c = nudgeColor(cs[i], step)
+		}
+		cs[i] = c
+		seen[c] = true
+	}
+	return cs
+}
+
+// nudgeColor returns the step-th candidate near given color,
+// trying blue, green then red channel on both directions.
+func nudgeColor(c color.NRGBA, step int) color.NRGBA {
+	delta := (step-1)/6 + 1
+	if (step-1)%2 == 1 {
+		delta = -delta
+	}
+	shift := func(v uint8) uint8 {
+		n := int(v) + delta
+		if n < 0 || n > 255 {
+			n = int(v) - delta
+		}
+		return uint8(n)
+	}
+	switch (step - 1) % 6 / 2 {
+	case 0:
+		c.B = shift(c.B)
+	case 1:
+		c.G = shift(c.G)
+	default:
+		c.R = shift(c.R)
+	}
+	return c
+}
+
+// NamedColors returns variant colors of given built-in palette.
+// Variant 0 is always white as in default color map.
+func NamedColors(name string) ([]color.NRGBA, error) {
+	p, ok := palettes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown palette '%s', available: %s",
+			name, strings.Join(PaletteNames(), ", "))
+	}
+	if name == "default" {
+		return p(PALETTE_SIZE), nil
+	}
+
+	cs := append([]color.NRGBA{{255, 255, 255, 255}}, p(PALETTE_SIZE-1)...)
+	return distinctColors(cs), nil
+}
@@ -0,0 +1,84 @@
+package base
+
+import (
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_NamedColors(t *testing.T) {
+	Convey("Generate built-in palettes", t, func() {
+		for _, name := range PaletteNames() {
+			cs, err := NamedColors(name)
+			So(err, ShouldBeNil)
+			So(len(cs), ShouldEqual, PALETTE_SIZE)
+			So(cs[0], ShouldResemble, color.NRGBA{255, 255, 255, 255})
+			So(NewColorMap(cs).Validate(), ShouldBeNil)
+		}
+	})
+
+	Convey("Generate given number of default colors", t, func() {
+		cs := defaultPalette(PALETTE_SIZE)
+		So(defaultPalette(10), ShouldResemble, cs[:10])
+		more := defaultPalette(PALETTE_SIZE + 5)
+		So(more, ShouldHaveLength, PALETTE_SIZE+5)
+		So(more[:PALETTE_SIZE], ShouldResemble, cs)
+		So(more[PALETTE_SIZE+1], ShouldNotResemble, cs[1])
+	})
+
+	Convey("Reject unknown palette", t, func() {
+		_, err := NamedColors("rainbow")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "viridis")
+	})
+}
+
+func Test_distinctColors(t *testing.T) {
+	Convey("Nudge duplicate and reserved colors", t, func() {
+		cs := distinctColors([]color.NRGBA{
+			{0, 0, 255, 255},
+			{0, 0, 255, 255},
+			{0, 0, 255, 255},
+			{230, 230, 230, 255},
+		})
+		So(NewColorMap(cs).Validate(), ShouldBeNil)
+		So(cs[0], ShouldResemble, color.NRGBA{0, 0, 255, 255})
+		So(cs[1], ShouldResemble, color.NRGBA{0, 0, 254, 255})
+		So(cs[2], ShouldResemble, color.NRGBA{0, 1, 255, 255})
+	})
+}
+
+func Test_ParseColorSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "palette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Parse default and named color map", t, func() {
+		So(ParseColorSpec(""), ShouldBeNil)
+		So(Colors.String(), ShouldEqual, DefaultVarColors)
+		So(Colors.Validate(), ShouldBeNil)
+
+		So(ParseColorSpec("name:viridis"), ShouldBeNil)
+		So(len(Colors.Vars), ShouldEqual, PALETTE_SIZE)
+		So(Colors.Vars[1], ShouldResemble, color.NRGBA{68, 1, 84, 255})
+	})
+
+	Convey("Report duplicate colors in file", t, func() {
+		spec := path.Join(dir, "dup.txt")
+		So(ioutil.WriteFile(spec, []byte("255, 255, 255\n0, 0, 255\n0, 0, 255\n"), 0644), ShouldBeNil)
+		So(ParseColorSpec(spec), ShouldBeNil)
+		err := Colors.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "variant 2")
+	})
+
+	Convey("Report missing file", t, func() {
+		So(ParseColorSpec(path.Join(dir, "404.txt")), ShouldNotBeNil)
+	})
+}
@@ -96,13 +96,46 @@ func (c *Context) GlobalGeneric(name string) interface{} {
 
 // Determines if the flag was actually set exists
 func (c *Context) IsSet(name string) bool {
+	c.initSetFlags()
+	return c.setFlags[name] == true
+}
+
+// initSetFlags records flags given in command line, once.
+func (c *Context) initSetFlags() {
 	if c.setFlags == nil {
 		c.setFlags = make(map[string]bool)
 		c.flagSet.Visit(func(f *flag.Flag) {
 			c.setFlags[f.Name] = true
 		})
 	}
-	return c.setFlags[name] == true
+}
+
+// Sets value of a local flag as if it was given in command line, all names
+// of the flag get the same value. IsSet still only reports flags given in
+// command line.
+func (c *Context) Set(name, value string) error {
+	// Record flags given in command line before flag set is changed.
+	c.initSetFlags()
+
+	flags := c.Command.Flags
+	if len(flags) == 0 && c.App != nil {
+		flags = c.App.Flags
+	}
+	names := []string{name}
+	for _, f := range flags {
+		eachName(f.getName(), func(n string) {
+			if n == name {
+				names = strings.Split(f.getName(), ",")
+			}
+		})
+	}
+
+	for _, n := range names {
+		if err := c.flagSet.Set(strings.Trim(n, " "), value); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type Args []string
@@ -15,6 +15,8 @@ const (
 var (
 	NonColor    bool
 	LEVEL_FLAGS = [...]string{"DEBUG", " INFO", " WARN", "ERROR", "FATAL"}
+
+	exitHooks []func()
 )
 
 func init() {
@@ -36,6 +38,9 @@ func Print(level int, format string, args ...interface{}) {
 		fmt.Printf("%s %s [%s] %s\n",
 			PREFIX, time.Now().Format(TIME_FORMAT), LEVEL_FLAGS[level],
 			fmt.Sprintf(format, args...))
+		if level == FATAL {
+			Exit(1)
+		}
 		return
 	}
 
@@ -60,7 +65,7 @@ func Print(level int, format string, args ...interface{}) {
 		fmt.Printf("%s \033[36m%s\033[0m [\033[35m%s\033[0m] %s\n",
 			PREFIX, time.Now().Format(TIME_FORMAT), LEVEL_FLAGS[level],
 			fmt.Sprintf(format, args...))
-		os.Exit(1)
+		Exit(1)
 	default:
 		fmt.Printf("%s %s [%s] %s\n",
 			PREFIX, time.Now().Format(TIME_FORMAT), LEVEL_FLAGS[level],
@@ -87,3 +92,16 @@ func Error(format string, args ...interface{}) {
 func Fatal(format string, args ...interface{}) {
 	Print(FATAL, format, args...)
 }
+
+// OnExit registers function to run before process exits by Exit or Fatal.
+func OnExit(f func()) {
+	exitHooks = append(exitHooks, f)
+}
+
+// Exit runs functions registered by OnExit and exits with given code.
+func Exit(code int) {
+	for _, f := range exitHooks {
+		f()
+	}
+	os.Exit(code)
+}
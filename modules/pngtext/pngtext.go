@@ -0,0 +1,234 @@
+// Package pngtext reads and writes text chunks of PNG stream,
+// which image/png ignores when decoding and never writes.
+package pngtext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+var signature = []byte("\x89PNG\r\n\x1a\n")
+
+// Chunks of text, zTXt is compressed by zlib.
+const (
+	TEXT  = "tEXt"
+	ZTEXT = "zTXt"
+)
+
+// Chunk data of text is read into memory, so a corrupted length
+// does not exhaust it.
+const maxTextLen = 1 << 28
+
+// chunkReader reads chunks of PNG stream one by one.
+type chunkReader struct {
+	r   io.Reader
+	typ string
+	len uint32
+}
+
+func newChunkReader(r io.Reader) (*chunkReader, error) {
+	head := make([]byte, len(signature))
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, fmt.Errorf("fail to read signature: %v", err)
+	} else if !bytes.Equal(head, signature) {
+		return nil, errors.New("not a PNG stream")
+	}
+	return &chunkReader{r: r}, nil
+}
+
+// next reads length and type of next chunk, whose data and CRC have to be
+// consumed by data or copy before next call. It returns io.EOF after IEND.
+func (cr *chunkReader) next() error {
+	if cr.typ == "IEND" {
+		return io.EOF
+	}
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(cr.r, head); err != nil {
+		return fmt.Errorf("fail to read chunk: %v", err)
+	}
+	cr.len = binary.BigEndian.Uint32(head[:4])
+	cr.typ = string(head[4:])
+	return nil
+}
+
+// data returns data of current chunk after checking its CRC.
+func (cr *chunkReader) data() ([]byte, error) {
+	if cr.len > maxTextLen {
+		return nil, fmt.Errorf("chunk %s is too large: %d", cr.typ, cr.len)
+	}
+	buf := make([]byte, cr.len+4)
+	if _, err := io.ReadFull(cr.r, buf); err != nil {
+		return nil, fmt.Errorf("fail to read chunk %s: %v", cr.typ, err)
+	}
+	data := buf[:cr.len]
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(cr.typ))
+	crc.Write(data)
+	if crc.Sum32() != binary.BigEndian.Uint32(buf[cr.len:]) {
+		return nil, fmt.Errorf("chunk %s has invalid CRC", cr.typ)
+	}
+	return data, nil
+}
+
+// copy copies current chunk to given writer without reading it into memory,
+// it is discarded when writer is nil.
+func (cr *chunkReader) copy(w io.Writer) error {
+	if w == nil {
+		w = ioutil.Discard
+	} else {
+		head := make([]byte, 8)
+		binary.BigEndian.PutUint32(head[:4], cr.len)
+		copy(head[4:], cr.typ)
+		if _, err := w.Write(head); err != nil {
+			return err
+		}
+	}
+	_, err := io.CopyN(w, cr.r, int64(cr.len)+4)
+	return err
+}
+
+// writeChunk writes a chunk of given type and data.
+func writeChunk(w io.Writer, typ string, data []byte) error {
+	buf := make([]byte, 8, len(data)+12)
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(data)))
+	copy(buf[4:], typ)
+	buf = append(buf, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(buf[4:]))
+	_, err := w.Write(append(buf, crc...))
+	return err
+}
+
+// parseText returns keyword and text of data of tEXt or zTXt chunk.
+func parseText(typ string, data []byte) (string, string, error) {
+	i := bytes.IndexByte(data, 0)
+	if i < 1 || i > 79 {
+		return "", "", fmt.Errorf("chunk %s has invalid keyword", typ)
+	}
+	keyword, text := string(data[:i]), data[i+1:]
+	if typ == TEXT {
+		return keyword, string(text), nil
+	}
+
+	if len(text) == 0 || text[0] != 0 {
+		return "", "", fmt.Errorf("chunk %s(%s) has unknown compression method", typ, keyword)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(text[1:]))
+	if err != nil {
+		return "", "", fmt.Errorf("fail to decompress chunk %s(%s): %v", typ, keyword, err)
+	}
+	defer zr.Close()
+	if text, err = ioutil.ReadAll(zr); err != nil {
+		return "", "", fmt.Errorf("fail to decompress chunk %s(%s): %v", typ, keyword, err)
+	}
+	return keyword, string(text), nil
+}
+
+// Read returns texts of all tEXt and zTXt chunks in PNG stream, keyed by keyword.
+func Read(r io.Reader) (map[string]string, error) {
+	cr, err := newChunkReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make(map[string]string)
+	for {
+		if err = cr.next(); err == io.EOF {
+			return texts, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if cr.typ != TEXT && cr.typ != ZTEXT {
+			if err = cr.copy(nil); err != nil {
+				return nil, fmt.Errorf("fail to read chunk %s: %v", cr.typ, err)
+			}
+			continue
+		}
+		data, err := cr.data()
+		if err != nil {
+			return nil, err
+		}
+		keyword, text, err := parseText(cr.typ, data)
+		if err != nil {
+			return nil, err
+		}
+		texts[keyword] = text
+	}
+}
+
+// rewrite copies PNG stream from r to w without text chunks of given keyword,
+// and calls given function to write more chunks before IEND.
+func rewrite(w io.Writer, r io.Reader, keyword string, beforeEnd func() error) error {
+	cr, err := newChunkReader(r)
+	if err != nil {
+		return err
+	} else if _, err = w.Write(signature); err != nil {
+		return err
+	}
+
+	for {
+		if err = cr.next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch cr.typ {
+		case TEXT, ZTEXT:
+			data, err := cr.data()
+			if err != nil {
+				return err
+			}
+			if i := bytes.IndexByte(data, 0); i >= 0 && string(data[:i]) == keyword {
+				continue
+			} else if err = writeChunk(w, cr.typ, data); err != nil {
+				return err
+			}
+			continue
+		case "IEND":
+			if beforeEnd != nil {
+				if err = beforeEnd(); err != nil {
+					return err
+				}
+			}
+		}
+		if err = cr.copy(w); err != nil {
+			return fmt.Errorf("fail to copy chunk %s: %v", cr.typ, err)
+		}
+	}
+}
+
+// Embed copies PNG stream from r to w with given text embedded before end of
+// image, in zTXt chunk when compress is true. Texts of the same keyword are replaced.
+func Embed(w io.Writer, r io.Reader, keyword, text string, compress bool) error {
+	if len(keyword) < 1 || len(keyword) > 79 || bytes.IndexByte([]byte(keyword), 0) >= 0 {
+		return fmt.Errorf("invalid keyword: %q", keyword)
+	}
+
+	return rewrite(w, r, keyword, func() error {
+		if !compress {
+			return writeChunk(w, TEXT, []byte(keyword+"\x00"+text))
+		}
+
+		buf := bytes.NewBufferString(keyword + "\x00\x00")
+		zw := zlib.NewWriter(buf)
+		if _, err := zw.Write([]byte(text)); err != nil {
+			return err
+		} else if err = zw.Close(); err != nil {
+			return err
+		}
+		return writeChunk(w, ZTEXT, buf.Bytes())
+	})
+}
+
+// Strip copies PNG stream from r to w without text chunks of given keyword.
+func Strip(w io.Writer, r io.Reader, keyword string) error {
+	return rewrite(w, r, keyword, nil)
+}
@@ -0,0 +1,60 @@
+package pngtext
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Text(t *testing.T) {
+	orig := new(bytes.Buffer)
+	if err := png.Encode(orig, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Embed texts that image/png ignores", t, func() {
+		plain := new(bytes.Buffer)
+		So(Embed(plain, bytes.NewReader(orig.Bytes()), "a", "plain text", false), ShouldBeNil)
+		both := new(bytes.Buffer)
+		So(Embed(both, bytes.NewReader(plain.Bytes()), "b", strings.Repeat("zip", 100), true), ShouldBeNil)
+
+		texts, err := Read(bytes.NewReader(both.Bytes()))
+		So(err, ShouldBeNil)
+		So(texts, ShouldResemble, map[string]string{"a": "plain text", "b": strings.Repeat("zip", 100)})
+
+		m, err := png.Decode(bytes.NewReader(both.Bytes()))
+		So(err, ShouldBeNil)
+		So(m.Bounds(), ShouldResemble, image.Rect(0, 0, 3, 2))
+
+		Convey("Replace text of the same keyword", func() {
+			again := new(bytes.Buffer)
+			So(Embed(again, bytes.NewReader(both.Bytes()), "a", "new", true), ShouldBeNil)
+			texts, err := Read(bytes.NewReader(again.Bytes()))
+			So(err, ShouldBeNil)
+			So(texts["a"], ShouldEqual, "new")
+			So(texts["b"], ShouldEqual, strings.Repeat("zip", 100))
+		})
+
+		Convey("Strip text of given keyword", func() {
+			stripped := new(bytes.Buffer)
+			So(Strip(stripped, bytes.NewReader(plain.Bytes()), "a"), ShouldBeNil)
+			So(stripped.Bytes(), ShouldResemble, orig.Bytes())
+		})
+
+		Convey("Return errors of broken chunks", func() {
+			broken := append([]byte(nil), plain.Bytes()...)
+			i := bytes.Index(broken, []byte("plain text"))
+			broken[i] = 'P'
+			_, err := Read(bytes.NewReader(broken))
+			So(err, ShouldNotBeNil)
+
+			_, err = Read(strings.NewReader("GIF89a"))
+			So(err, ShouldNotBeNil)
+			So(Embed(new(bytes.Buffer), bytes.NewReader(orig.Bytes()), "", "text", false), ShouldNotBeNil)
+		})
+	})
+}
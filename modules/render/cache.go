@@ -0,0 +1,243 @@
+package render
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+// CACHE_VERSION is part of every input hash, it has to be increased
+// whenever same inputs are drawn differently, so existed images are rebuilt.
+const CACHE_VERSION = 1
+
+// CACHE_FILE is the name of file in image directory that caches
+// fingerprints of input files.
+const CACHE_FILE = ".tr_cache.json"
+
+// inputInfo represents fingerprint of an input file, it is reused
+// as long as size and modification time of the file are unchanged.
+type inputInfo struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	Hash    string `json:"hash"`
+	// Band lengths without range limit, -1 for bands not in file.
+	// It is only for abv files.
+	BandLen []int `json:"band_len,omitempty"`
+}
+
+// human returns a human with only band lengths within given range,
+// which is the same as parsing abv file in count only mode.
+func (info *inputInfo) human(name string, r *base.Range) *abv.Human {
+	h := &abv.Human{
+		Name:       path.Base(name),
+		BandLength: make(map[int]int),
+	}
+	for i := r.StartBandIdx; i < len(info.BandLen); i++ {
+		if r.EndBandIdx >= 0 && i > r.EndBandIdx {
+			break
+		} else if info.BandLen[i] < 0 {
+			continue
+		}
+
+		h.MaxBand = i
+		bandLen := info.BandLen[i]
+		if r.EndPosIdx >= 0 && bandLen > r.EndPosIdx+1 {
+			bandLen = r.EndPosIdx + 1
+		}
+		if bandLen-1 > h.MaxPos {
+			h.MaxPos = bandLen - 1
+		}
+		h.BandLength[i] = bandLen
+	}
+	return h
+}
+
+// inputCache caches fingerprints of input files by absolute path.
+type inputCache struct {
+	name    string
+	Inputs  map[string]*inputInfo `json:"inputs"`
+	changed bool
+}
+
+// loadInputCache loads cache of image directory, a new cache is returned
+// when there is no cache or cache is broken.
+func loadInputCache(opt base.Option) *inputCache {
+	ic := &inputCache{
+		name:   path.Join(opt.ImgDir, CACHE_FILE),
+		Inputs: make(map[string]*inputInfo),
+	}
+	data, err := ioutil.ReadFile(ic.name)
+	if err != nil {
+		return ic
+	}
+	if err = json.Unmarshal(data, ic); err != nil || ic.Inputs == nil {
+		log.Warn("Ignore broken cache(%s): %v", ic.name, err)
+		ic.Inputs = make(map[string]*inputInfo)
+	}
+	return ic
+}
+
+// hashFile returns SHA1 of content of given file.
+func hashFile(name string) (string, error) {
+	fr, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fr.Close()
+
+	h := sha1.New()
+	if _, err = io.Copy(h, fr); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// info returns fingerprint of given file, the file is only read
+// when it is not cached or has been changed since cached.
+// Band lengths are counted when isAbv is true.
+func (ic *inputCache) info(name string, isAbv bool) (*inputInfo, error) {
+	key, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := ic.Inputs[key]
+	if ok && info.Size == fi.Size() && info.ModTime == fi.ModTime().UnixNano() &&
+		(!isAbv || info.BandLen != nil) {
+		return info, nil
+	}
+
+	info = &inputInfo{Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+	if info.Hash, err = hashFile(name); err != nil {
+		return nil, err
+	}
+	if isAbv {
+		all := &base.Range{StartBandIdx: 0, EndBandIdx: -1, EndPosIdx: -1}
+		h, err := abv.Parse(name, true, all, nil)
+		if err != nil {
+			return nil, err
+		}
+		info.BandLen = make([]int, h.MaxBand+1)
+		for i := range info.BandLen {
+			if l, ok := h.BandLength[i]; ok {
+				info.BandLen[i] = l
+			} else {
+				info.BandLen[i] = -1
+			}
+		}
+	}
+	log.Debug("Input fingerprinted: %s", name)
+
+	ic.Inputs[key] = info
+	ic.changed = true
+	return info, nil
+}
+
+// save saves cache when it has been changed, nothing is saved in dry-run mode.
+func (ic *inputCache) save(opt base.Option) error {
+	if !ic.changed || opt.DryRun {
+		return nil
+	}
+	data, err := json.Marshal(ic)
+	if err != nil {
+		return fmt.Errorf("fail to encode cache: %v", err)
+	}
+	os.MkdirAll(opt.ImgDir, os.ModePerm)
+	if err = ioutil.WriteFile(ic.name, data, 0644); err != nil {
+		return fmt.Errorf("fail to save cache(%s): %v", ic.name, err)
+	}
+	return nil
+}
+
+// inputHash returns hash of options that affect image, color map in use
+// and given fingerprints of inputs.
+func inputHash(opt base.Option, inputs ...string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "v%d mode=%d band=%d-%d pos=%d col=%d box=%d slot=%d border=%d "+
+		"annotate=%v format=%s order=%s metric=%s\n",
+		CACHE_VERSION, opt.Mode, opt.StartBandIdx, opt.EndBandIdx, opt.EndPosIdx,
+		opt.MaxColIdx, opt.BoxNum, opt.SlotPixel, opt.Border,
+		opt.Annotate, opt.Format, opt.Order, opt.Metric)
+	io.WriteString(h, base.Colors.String())
+	io.WriteString(h, "\noverflow="+base.Colors.Overflow)
+	for _, input := range inputs {
+		io.WriteString(h, "\n"+input)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var svgHashPattern = regexp.MustCompile(`data-input-hash="([0-9a-f]+)"`)
+
+// storedHash returns input hash recorded in given profile, or in root element
+// of SVG image when profile is empty. Profiles of older versions have no hash,
+// so that images are regenerated with profiles of current version.
+func storedHash(img, profile string) string {
+	if len(profile) == 0 {
+		fr, err := os.Open(img)
+		if err != nil {
+			return ""
+		}
+		defer fr.Close()
+
+		line, _ := bufio.NewReader(fr).ReadString('\n')
+		if m := svgHashPattern.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+		return ""
+	}
+
+	data, err := ioutil.ReadFile(profile)
+	if err != nil {
+		return ""
+	}
+	var p struct {
+		Version   int    `json:"version"`
+		InputHash string `json:"input_hash"`
+	}
+	if json.Unmarshal(data, &p) != nil || p.Version != PROFILE_VERSION {
+		return ""
+	}
+	return p.InputHash
+}
+
+// needBuild returns true if image has to be (re)built because it does not exist
+// or its inputs have changed since last built, i.e. input hash recorded
+// in profile is different. In dry-run mode, it only logs image that
+// would be rebuilt and returns false.
+func needBuild(opt base.Option, img, profile, hash string) bool {
+	reason := ""
+	switch {
+	case opt.Force:
+		reason = "forced"
+	case !base.IsFile(img):
+		reason = "missing"
+	case storedHash(img, profile) != hash:
+		reason = "inputs changed"
+	default:
+		log.Debug("Skip up-to-date image: %s", img)
+		return false
+	}
+
+	if opt.DryRun {
+		log.Info("Would rebuild %s: %s", img, reason)
+		return false
+	}
+	log.Debug("Rebuild %s: %s", img, reason)
+	return true
+}
@@ -0,0 +1,112 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func writeAbv(name string, bands ...*abv.Band) error {
+	fw, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	w := abv.NewWriter(fw, "hu1")
+	for _, b := range bands {
+		if err = w.WriteBand(b); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func Test_inputCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Band 2 is not in file.
+	name := path.Join(dir, "hu1.abv")
+	if err = writeAbv(name,
+		&abv.Band{Index: 0, Data: []byte(strings.Repeat(".", 30))},
+		&abv.Band{Index: 1, Data: []byte(strings.Repeat(".-", 8))},
+		&abv.Band{Index: 3, Data: []byte(strings.Repeat("#.", 20))}); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := base.Option{ImgDir: dir, Range: &base.Range{}}
+	Convey("Band lengths of cached input are the same as count only parsing", t, func() {
+		ic := loadInputCache(opt)
+		info, err := ic.info(name, true)
+		So(err, ShouldBeNil)
+		So(info.BandLen, ShouldResemble, []int{30, 16, -1, 40})
+
+		for _, r := range []base.Range{
+			{0, -1, 0, -1}, {0, 1, 0, 19}, {1, 2, 0, -1}, {2, 2, 0, 9}, {1, 9, 0, 24}, {5, -1, 0, -1},
+		} {
+			h, err := abv.Parse(name, true, &r, nil)
+			So(err, ShouldBeNil)
+			ch := info.human(name, &r)
+			So(ch.BandLength, ShouldResemble, h.BandLength)
+			So(ch.MaxBand, ShouldEqual, h.MaxBand)
+			So(ch.MaxPos, ShouldEqual, h.MaxPos)
+		}
+	})
+
+	Convey("Files are only read again when changed", t, func() {
+		ic := loadInputCache(opt)
+		info, err := ic.info(name, true)
+		So(err, ShouldBeNil)
+		ic.save(opt)
+
+		ic = loadInputCache(opt)
+		cached, err := ic.info(name, true)
+		So(err, ShouldBeNil)
+		So(ic.changed, ShouldBeFalse)
+		So(cached, ShouldResemble, info)
+
+		So(writeAbv(name, &abv.Band{Index: 0, Data: []byte("..")}), ShouldBeNil)
+		changed, err := ic.info(name, true)
+		So(err, ShouldBeNil)
+		So(ic.changed, ShouldBeTrue)
+		So(changed.Hash, ShouldNotEqual, info.Hash)
+		So(changed.BandLen, ShouldResemble, []int{2})
+	})
+
+	Convey("Images are only rebuilt when inputs have changed", t, func() {
+		img := path.Join(dir, "img.png")
+		profile := path.Join(dir, "profile.json")
+		hash := inputHash(opt, "a")
+		So(needBuild(opt, img, profile, hash), ShouldBeTrue)
+
+		So(ioutil.WriteFile(img, nil, 0644), ShouldBeNil)
+		So(ioutil.WriteFile(profile, []byte(`{"input_hash": "`+hash+`"}`), 0644), ShouldBeNil)
+		So(needBuild(opt, img, profile, hash), ShouldBeTrue)
+		So(ioutil.WriteFile(profile, []byte(`{"version": 1, "input_hash": "`+hash+`"}`), 0644), ShouldBeNil)
+		So(needBuild(opt, img, profile, hash), ShouldBeFalse)
+		So(needBuild(opt, img, profile, inputHash(opt, "b")), ShouldBeTrue)
+
+		slotOpt := opt
+		slotOpt.SlotPixel = 3
+		So(needBuild(opt, img, profile, inputHash(slotOpt, "a")), ShouldBeTrue)
+
+		dryOpt := opt
+		dryOpt.DryRun = true
+		So(needBuild(dryOpt, img, profile, inputHash(opt, "b")), ShouldBeFalse)
+
+		forceOpt := opt
+		forceOpt.Force = true
+		So(needBuild(forceOpt, img, profile, hash), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,309 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/annotate"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+// Categories of tiles in difference image, which are also variant indexes
+// of its color map.
+const (
+	DIFF_SAME = iota
+	DIFF_VARIANT
+	DIFF_ONE_UNRECOGNIZED
+	DIFF_BOTH_UNRECOGNIZED
+)
+
+// DefaultDiffColors is the default color map of difference image,
+// in order of categories.
+const DefaultDiffColors = `255, 255, 255
+215, 48, 39
+253, 174, 97
+69, 117, 180`
+
+var diffLabels = []string{"SAME", "VARIANT", "ONE -", "BOTH -"}
+
+// diffLegend returns entries of colors of all categories in given color map.
+func diffLegend(cm *base.ColorMap) []annotate.LegendEntry {
+	entries := make([]annotate.LegendEntry, len(diffLabels))
+	for i, label := range diffLabels {
+		entries[i] = annotate.LegendEntry{Label: label, Color: cm.Color(i)}
+	}
+	return entries
+}
+
+// diffSource provides humans by name from an abv file,
+// a directory of abv files or a cohort file.
+type diffSource struct {
+	names  []string
+	paths  map[string]string     // Abv files.
+	cohort string                // Cohort file.
+	humans map[string]*abv.Human // Samples of cohort file.
+}
+
+func openDiffSource(name string, r *base.Range) (*diffSource, error) {
+	s := &diffSource{}
+	if abv.IsCohortFile(name) {
+		s.cohort = name
+		fr, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer fr.Close()
+
+		cr, err := abv.NewCohortReader(fr)
+		if err != nil {
+			return nil, err
+		}
+		humans, err := cr.Humans(r)
+		if err != nil {
+			return nil, err
+		}
+		s.humans = make(map[string]*abv.Human, len(humans))
+		for _, h := range humans {
+			s.names = append(s.names, h.Name)
+			s.humans[h.Name] = h
+		}
+		return s, nil
+	}
+
+	files, err := base.GetFileListBySuffix(name, ".abv")
+	if err != nil {
+		return nil, err
+	}
+	s.paths = make(map[string]string, len(files))
+	for _, f := range files {
+		human := strings.TrimSuffix(path.Base(f), ".abv")
+		s.names = append(s.names, human)
+		s.paths[human] = f
+	}
+	return s, nil
+}
+
+func (s *diffSource) human(name string, r *base.Range) (*abv.Human, error) {
+	if s.humans != nil {
+		return s.humans[name], nil
+	}
+	return abv.Parse(s.paths[name], false, r, nil)
+}
+
+// source returns file of human of given name and its checksum.
+func (s *diffSource) source(cache *inputCache, name string) (SourceProfile, error) {
+	file := s.cohort
+	if s.humans == nil {
+		file = s.paths[name]
+	}
+	info, err := cache.info(file, false)
+	if err != nil {
+		return SourceProfile{}, err
+	}
+	return SourceProfile{path.Base(file), info.Hash}, nil
+}
+
+// input returns fingerprint of human of given name.
+func (s *diffSource) input(src SourceProfile, name string) string {
+	if s.humans != nil {
+		return src.Hash + ":" + name
+	}
+	return src.Hash
+}
+
+// diffPair represents names of two humans to compare.
+type diffPair struct {
+	name1, name2 string
+}
+
+// diffPairs pairs humans of same name in two sources,
+// two sources of one human each are always paired.
+func diffPairs(s1, s2 *diffSource) []diffPair {
+	if len(s1.names) == 1 && len(s2.names) == 1 {
+		return []diffPair{{s1.names[0], s2.names[0]}}
+	}
+
+	names2 := make(map[string]bool, len(s2.names))
+	for _, name := range s2.names {
+		names2[name] = true
+	}
+	pairs := make([]diffPair, 0, len(s1.names))
+	for _, name := range s1.names {
+		if names2[name] {
+			pairs = append(pairs, diffPair{name, name})
+			delete(names2, name)
+		} else {
+			log.Warn("Skip human only in -abv-path: %s", name)
+		}
+	}
+	rest := make([]string, 0, len(names2))
+	for name := range names2 {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		log.Warn("Skip human only in -diff-path: %s", name)
+	}
+	return pairs
+}
+
+// diffHuman returns a human whose variants are categories of
+// differences between tiles of two humans.
+func diffHuman(h1, h2 *abv.Human) *abv.Human {
+	h := &abv.Human{
+		Blocks:     make(map[int]map[int]*abv.Block),
+		BandLength: make(map[int]int),
+	}
+
+	bands := make(map[int]bool)
+	for i := range h1.BandLength {
+		bands[i] = true
+	}
+	for i := range h2.BandLength {
+		bands[i] = true
+	}
+
+	for i := range bands {
+		bandLen := h1.BandLength[i]
+		if h2.BandLength[i] > bandLen {
+			bandLen = h2.BandLength[i]
+		}
+		h.BandLength[i] = bandLen
+		if i > h.MaxBand {
+			h.MaxBand = i
+		}
+		if bandLen-1 > h.MaxPos {
+			h.MaxPos = bandLen - 1
+		}
+
+		h.Blocks[i] = make(map[int]*abv.Block, bandLen)
+		for j := 0; j < bandLen; j++ {
+			// Tiles are unrecognized when missing.
+			b1, ok1 := h1.Blocks[i][j]
+			b2, ok2 := h2.Blocks[i][j]
+
+			var category byte
+			switch {
+			case !ok1 && !ok2:
+				category = DIFF_BOTH_UNRECOGNIZED
+			case !ok1 || !ok2:
+				category = DIFF_ONE_UNRECOGNIZED
+			case b1.Variant != b2.Variant:
+				category = DIFF_VARIANT
+			default:
+				category = DIFF_SAME
+			}
+			h.Blocks[i][j] = &abv.Block{Variant: category}
+			h.PosCount++
+		}
+	}
+	return h
+}
+
+// generateDiffImg generates difference image of i-th pair of humans
+// when their inputs have changed.
+func generateDiffImg(opt base.Option, cache *inputCache, s1, s2 *diffSource, i int, p diffPair) error {
+	h1, err := s1.human(p.name1, opt.Range)
+	if err != nil {
+		return fmt.Errorf("fail to parse abv file(%s): %v", p.name1, err)
+	}
+	h2, err := s2.human(p.name2, opt.Range)
+	if err != nil {
+		return fmt.Errorf("fail to parse abv file(%s): %v", p.name2, err)
+	}
+
+	h := diffHuman(h1, h2)
+	h.Name = p.name1
+	if p.name1 != p.name2 {
+		h.Name = fmt.Sprintf("%s_vs_%s", p.name1, p.name2)
+	}
+
+	// Adjust range for every pair.
+	r := *opt.Range
+	opt.Range = &r
+	if opt.EndBandIdx == -1 || opt.EndBandIdx > h.MaxBand {
+		opt.EndBandIdx = h.MaxBand
+	}
+	if opt.EndPosIdx == -1 {
+		opt.EndPosIdx = 3999
+	} else if opt.EndPosIdx > h.MaxPos {
+		opt.EndPosIdx = h.MaxPos
+	}
+
+	src1, err := s1.source(cache, p.name1)
+	if err != nil {
+		return fmt.Errorf("fail to read abv file(%s): %v", p.name1, err)
+	}
+	src2, err := s2.source(cache, p.name2)
+	if err != nil {
+		return fmt.Errorf("fail to read abv file(%s): %v", p.name2, err)
+	}
+	profile := ""
+	if opt.Format != FORMAT_SVG {
+		profile = path.Join(getAbvProfileDir(opt, h.Name), PROFILE_FILE)
+	}
+	hash := inputHash(opt, s1.input(src1, p.name1), s2.input(src2, p.name2))
+	if !needBuild(opt, path.Join(opt.ImgDir, getAbvImgName(opt, h.Name)), profile, hash) {
+		return nil
+	}
+
+	if opt.Format == FORMAT_SVG {
+		if err = generateAbvSvg(opt, h, hash); err != nil {
+			return fmt.Errorf("fail to generate diff image: %v", err)
+		}
+	} else {
+		area, err := generateAbvImg(opt, h)
+		if err != nil {
+			return fmt.Errorf("fail to generate diff image: %v", err)
+		} else if err = saveAbvImgProfile(opt, h, area, nil, hash, src1, src2); err != nil {
+			return fmt.Errorf("fail to save diff image profile: %v", err)
+		}
+	}
+	log.Info("[%d] %s: %d * %d", i, h.Name, h.MaxBand, h.MaxPos)
+	return nil
+}
+
+// generateDiffImgs is a high level function to generate difference image
+// of each pair of humans, in the same layout as mode 1.
+func generateDiffImgs(opt base.Option, batch *base.Batch) error {
+	// Colors of categories are given by color map.
+	if len(opt.ColorSpec) == 0 {
+		base.Colors, _ = base.ParseColorMap(DefaultDiffColors)
+	} else if len(base.Colors.Vars) < len(diffLabels) {
+		return fmt.Errorf("color map needs at least %d colors in mode 4", len(diffLabels))
+	}
+
+	s1, err := openDiffSource(opt.AbvPath, opt.Range)
+	if err != nil {
+		return fmt.Errorf("fail to open abv path(%s): %v", opt.AbvPath, err)
+	}
+	s2, err := openDiffSource(opt.DiffPath, opt.Range)
+	if err != nil {
+		return fmt.Errorf("fail to open diff path(%s): %v", opt.DiffPath, err)
+	}
+
+	pairs := diffPairs(s1, s2)
+	if len(pairs) == 0 {
+		return errors.New("no human to compare in -abv-path and -diff-path")
+	}
+
+	cache := loadInputCache(opt)
+	for i, p := range pairs {
+		if err = generateDiffImg(opt, cache, s1, s2, i, p); err != nil {
+			name := p.name1
+			if p.name1 != p.name2 {
+				name = fmt.Sprintf("%s_vs_%s", p.name1, p.name2)
+			}
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+		}
+	}
+	return cache.save(opt)
+}
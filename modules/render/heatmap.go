@@ -0,0 +1,227 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/annotate"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+// MetricRange represents range of metric values that color ramp spans.
+type MetricRange struct {
+	Name string  `json:"name"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+}
+
+// color returns color of given value on color ramp.
+func (mr *MetricRange) color(v float64) image.Image {
+	t := 0.0
+	if mr.Max > mr.Min {
+		t = (v - mr.Min) / (mr.Max - mr.Min)
+	}
+	return image.NewUniform(base.Ramp(t))
+}
+
+// legend returns entries of evenly spaced values on color ramp
+// and tiles without value, which have background of given color map.
+func (mr *MetricRange) legend(cm *base.ColorMap) []annotate.LegendEntry {
+	const steps = 4
+	entries := make([]annotate.LegendEntry, 0, steps+2)
+	for i := 0; i <= steps; i++ {
+		v := mr.Min + (mr.Max-mr.Min)*float64(i)/steps
+		entries = append(entries, annotate.LegendEntry{
+			Label: fmt.Sprintf("%.3g", v),
+			Color: base.Ramp(float64(i) / steps),
+		})
+	}
+	return append(entries, annotate.LegendEntry{Label: "-", Color: cm.Background})
+}
+
+// loadHeatmap accumulates tiles of all humans in a cohort file
+// or abv file(s) of given path, abv files that fail are skipped
+// when batch keeps going.
+func loadHeatmap(opt base.Option, batch *base.Batch) (*abv.Heatmap, error) {
+	hm := abv.NewHeatmap()
+	if !abv.IsCohortFile(opt.AbvPath) {
+		names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			h, err := abv.Parse(name, false, opt.Range, nil)
+			if err != nil {
+				if err = batch.Fail(name, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			hm.AddHuman(h)
+		}
+		return hm, nil
+	}
+
+	fr, err := os.Open(opt.AbvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	cr, err := abv.NewCohortReader(fr)
+	if err != nil {
+		return nil, err
+	}
+	hm.Humans = len(cr.Samples)
+	for {
+		cb, err := cr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if cb.Index < opt.StartBandIdx {
+			continue
+		} else if opt.EndBandIdx >= 0 && cb.Index > opt.EndBandIdx {
+			break
+		}
+		for _, tiles := range cb.Tiles {
+			if opt.EndPosIdx >= 0 && len(tiles) > opt.EndPosIdx+1 {
+				tiles = tiles[:opt.EndPosIdx+1]
+			}
+			hm.AddTiles(cb.Index, tiles)
+		}
+	}
+	return hm, nil
+}
+
+// heatmapSources returns abv file(s) or cohort file of given path and their checksums.
+func heatmapSources(opt base.Option, cache *inputCache) ([]SourceProfile, error) {
+	names := []string{opt.AbvPath}
+	if !abv.IsCohortFile(opt.AbvPath) {
+		var err error
+		if names, err = base.GetFileListBySuffix(opt.AbvPath, ".abv"); err != nil {
+			return nil, err
+		}
+	}
+
+	sources := make([]SourceProfile, len(names))
+	for i, name := range names {
+		info, err := cache.info(name, false)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = SourceProfile{path.Base(name), info.Hash}
+	}
+	return sources, nil
+}
+
+// heatmapName returns name of heat-map image based on abv path and metric.
+func heatmapName(opt base.Option) string {
+	name := opt.AbvPath
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	name = strings.TrimSuffix(path.Base(filepath.ToSlash(name)), ".abvc")
+	return name + "_" + opt.Metric
+}
+
+// generateHeatmapImg generates one PNG of all humans, every tile is colored
+// by metric across cohort, in the same layout as mode 1.
+func generateHeatmapImg(opt base.Option, batch *base.Batch) error {
+	if err := abv.ValidateMetric(opt.Metric); err != nil {
+		return fmt.Errorf("invalid -metric: %v", err)
+	}
+
+	hm, err := loadHeatmap(opt, batch)
+	if err != nil {
+		return fmt.Errorf("fail to load humans(%s): %v", opt.AbvPath, err)
+	} else if hm.Humans == 0 {
+		return fmt.Errorf("no human found in %s", opt.AbvPath)
+	}
+
+	// Adjust range.
+	if opt.EndBandIdx == -1 || opt.EndBandIdx > hm.MaxBand {
+		opt.EndBandIdx = hm.MaxBand
+	}
+	if opt.EndPosIdx == -1 || opt.EndPosIdx > hm.MaxPos {
+		opt.EndPosIdx = hm.MaxPos
+	}
+
+	h := &abv.Human{
+		Name:       heatmapName(opt),
+		BandLength: make(map[int]int),
+		MaxBand:    hm.MaxBand,
+		MaxPos:     hm.MaxPos,
+	}
+
+	cache := loadInputCache(opt)
+	sources, err := heatmapSources(opt, cache)
+	if err != nil {
+		return fmt.Errorf("fail to read humans(%s): %v", opt.AbvPath, err)
+	}
+	inputs := make([]string, len(sources))
+	for i, src := range sources {
+		inputs[i] = src.Name + ":" + src.Hash
+	}
+	hash := inputHash(opt, inputs...)
+	if !needBuild(opt, path.Join(opt.ImgDir, getAbvImgName(opt, h.Name)),
+		path.Join(getAbvProfileDir(opt, h.Name), PROFILE_FILE), hash) {
+		return cache.save(opt)
+	}
+
+	// Range of metric values.
+	mr := &MetricRange{Name: opt.Metric}
+	hasValue := false
+	for i := opt.StartBandIdx; i <= opt.EndBandIdx; i++ {
+		h.BandLength[i] = len(hm.Bands[i])
+		for j := 0; j <= opt.EndPosIdx; j++ {
+			v, ok := hm.Value(opt.Metric, i, j)
+			switch {
+			case !ok:
+			case !hasValue:
+				mr.Min, mr.Max, hasValue = v, v, true
+			case v < mr.Min:
+				mr.Min = v
+			case v > mr.Max:
+				mr.Max = v
+			}
+		}
+	}
+
+	r := rendererOf(opt)
+	m := r.initImage(opt.EndBandIdx - opt.StartBandIdx + 1)
+	for i := opt.StartBandIdx; i <= opt.EndBandIdx; i++ {
+		for j := 0; j <= opt.EndPosIdx; j++ {
+			if v, ok := hm.Value(opt.Metric, i, j); ok {
+				x, y := j*opt.SlotPixel, (i-opt.StartBandIdx)*opt.SlotPixel
+				draw.Draw(m, image.Rect(x, y, x+opt.SlotPixel, y+opt.SlotPixel),
+					mr.color(v), image.ZP, draw.Src)
+			}
+		}
+	}
+
+	var area *DataArea
+	if opt.Annotate {
+		var rect image.Rectangle
+		m, rect = r.annotateAbvImg(m, mr.legend(r.Colors))
+		area = newDataArea(rect)
+	}
+
+	if err = saveImgFile(path.Join(opt.ImgDir, getAbvImgName(opt, h.Name)), m); err != nil {
+		return fmt.Errorf("fail to generate heat-map image(%s): %v", h.Name, err)
+	} else if err = saveAbvImgProfile(opt, h, area, mr, hash, sources...); err != nil {
+		return fmt.Errorf("fail to save heat-map image(%s) profile: %v", h.Name, err)
+	}
+	log.Info("%s: %d humans, %s %.3g - %.3g", h.Name, hm.Humans, mr.Name, mr.Min, mr.Max)
+	return cache.save(opt)
+}
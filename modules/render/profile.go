@@ -0,0 +1,566 @@
+package render
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/pngtext"
+)
+
+// PROFILE_VERSION is version of profile schema, it has to be increased
+// when schema changes and LoadProfile has to migrate older profiles.
+// Profiles saved before schema was versioned are version 0.
+const PROFILE_VERSION = 1
+
+// PROFILE_FILE is the name of profile in profile directory of image.
+const PROFILE_FILE = "profile.json"
+
+// PROFILE_KEYWORD is the keyword of text chunk that profile is embedded in PNG image.
+const PROFILE_KEYWORD = "tileruler.profile"
+
+// AppVer is version of tool that is recorded in profiles.
+var AppVer string
+
+// HumanProfile represents a human in slot of full size image.
+type HumanProfile struct {
+	Name    string `json:"name"`
+	BandLen []int  `json:"band_len"`
+	Hash    string `json:"hash,omitempty"` // Hash of abv file.
+}
+
+// SourceProfile represents a source file that image is generated from.
+type SourceProfile struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"` // SHA1 of file content.
+}
+
+// Profile represents profile of image in any mode, which is saved in profile
+// directory along with image to verify and reverse it.
+type Profile struct {
+	Version   int       `json:"version"`
+	AppVer    string    `json:"app_ver,omitempty"`
+	Type      base.Mode `json:"type"`
+	Name      string    `json:"name,omitempty"` // Human of single, difference or heat-map image.
+	StartBand int       `json:"start_band"`
+	EndBand   int       `json:"end_band"`
+	EndPos    int       `json:"end_pos"` // -1 means unknown in migrated profiles.
+	MaxCol    int       `json:"max_col"`
+	SlotPixel int       `json:"slot_pixel"`
+	BoxNum    int       `json:"box_num,omitempty"`
+	Border    int       `json:"border,omitempty"`
+	BandRows  []int     `json:"band_rows,omitempty"` // Rows of each band in full size image.
+	// Size of whole image, 0 means unknown in migrated profiles.
+	Width    int       `json:"width"`
+	Height   int       `json:"height"`
+	DataArea *DataArea `json:"data_area,omitempty"`
+	Colors   string    `json:"colors"` // Color map in use, in format of color specification file.
+	// Policy of variant indexes beyond color map, see base.OVERFLOW_*.
+	Overflow string       `json:"overflow"`
+	Metric   *MetricRange `json:"metric,omitempty"`
+	Order    string       `json:"order,omitempty"`
+	BandLen  []int        `json:"band_len,omitempty"` // Band lengths of single image.
+	// Humans in order of slots of full size image.
+	Humans    []HumanProfile  `json:"humans,omitempty"`
+	Sources   []SourceProfile `json:"sources,omitempty"`
+	ImageHash string          `json:"image_hash,omitempty"`
+	InputHash string          `json:"input_hash,omitempty"`
+	// Hash of options and row offsets, slots of full size image
+	// in the same layout can be reused.
+	LayoutHash string `json:"layout_hash,omitempty"`
+}
+
+// newProfile returns profile of image of given options with color map in use,
+// options are supposed to be validated and range adjusted.
+func newProfile(opt base.Option) *Profile {
+	p := &Profile{
+		Version:   PROFILE_VERSION,
+		AppVer:    AppVer,
+		Type:      opt.Mode,
+		StartBand: opt.StartBandIdx,
+		EndBand:   opt.EndBandIdx,
+		EndPos:    opt.EndPosIdx,
+		MaxCol:    opt.MaxColIdx,
+		SlotPixel: opt.SlotPixel,
+		Colors:    base.Colors.String(),
+		Overflow:  base.Colors.Overflow,
+	}
+	switch opt.Mode {
+	case base.FULL_SIZE:
+		p.Order = opt.Order
+		fallthrough
+	case base.TRANSPARENT:
+		p.BoxNum = opt.BoxNum
+		p.Border = opt.Border
+	}
+	return p
+}
+
+// bandLens returns lengths of given number of bands of human from band 0,
+// bands longer than given end position index are cut when it is not -1.
+func bandLens(h *abv.Human, n, endPos int) []int {
+	lens := make([]int, n)
+	for i := range lens {
+		lens[i] = h.BandLength[i]
+		if endPos >= 0 && lens[i] > endPos+1 {
+			lens[i] = endPos + 1
+		}
+	}
+	return lens
+}
+
+// RenderProfile renders given humans like Render and returns profile of image
+// to reverse it without file system, which records no checksum. Humans are named
+// by their names without .abv suffix. Difference image cannot be reversed to humans.
+func (r *Renderer) RenderProfile(humans ...*abv.Human) (image.Image, *Profile, error) {
+	if r.Mode == base.DIFF {
+		return nil, nil, errors.New("difference image cannot be reversed to humans")
+	}
+	m, area, err := r.render(humans)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fr := r.fitHumans(humans)
+	p := &Profile{
+		Version:   PROFILE_VERSION,
+		AppVer:    AppVer,
+		Type:      r.Mode,
+		StartBand: fr.StartBandIdx,
+		EndBand:   fr.EndBandIdx,
+		EndPos:    fr.EndPosIdx,
+		MaxCol:    fr.MaxColIdx,
+		SlotPixel: r.SlotPixel,
+		Width:     m.Bounds().Dx(),
+		Height:    m.Bounds().Dy(),
+		DataArea:  area,
+		Colors:    r.Colors.String(),
+		Overflow:  r.Colors.Overflow,
+	}
+	switch r.Mode {
+	case base.SINGLE:
+		p.Name = strings.TrimSuffix(humans[0].Name, ".abv")
+		p.BandLen = bandLens(humans[0], fr.EndBandIdx+1, fr.EndPosIdx)
+	case base.TRANSPARENT:
+		p.Name = strings.TrimSuffix(humans[0].Name, ".abv")
+		p.BoxNum, p.Border = r.BoxNum, r.Border
+		p.BandLen = bandLens(humans[0], humans[0].MaxBand+1, fr.EndPosIdx)
+	case base.FULL_SIZE:
+		p.BoxNum, p.Border = r.BoxNum, r.Border
+		_, maxRows := fr.fullSizeRows(humans)
+		p.BandRows = make([]int, fr.EndBandIdx+1)
+		for i := range p.BandRows {
+			p.BandRows[i] = maxRows[i]
+		}
+		p.Humans = make([]HumanProfile, len(humans))
+		for slot, h := range humans {
+			p.Humans[slot] = HumanProfile{
+				Name:    strings.TrimSuffix(h.Name, ".abv"),
+				BandLen: bandLens(h, h.MaxBand+1, fr.EndPosIdx),
+			}
+		}
+	}
+	return m, p, nil
+}
+
+// hashImage returns SHA1 of image file, profile embedded in PNG image is excluded,
+// so that checksum recorded in profile stays valid after embedding.
+func hashImage(name string) (string, error) {
+	if !strings.HasSuffix(name, ".png") {
+		return hashFile(name)
+	}
+
+	fr, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fr.Close()
+
+	h := sha1.New()
+	if err = pngtext.Strip(h, bufio.NewReader(fr), PROFILE_KEYWORD); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// embed embeds given profile data into PNG image file,
+// so image can be reversed without its profile directory.
+func embed(img string, data []byte) error {
+	fr, err := os.Open(img)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	tmp := img + ".tmp"
+	fw, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer fw.Close()
+
+	bw := bufio.NewWriter(fw)
+	if err = pngtext.Embed(bw, bufio.NewReader(fr), PROFILE_KEYWORD, string(data), true); err != nil {
+		return err
+	} else if err = bw.Flush(); err != nil {
+		return err
+	} else if err = fw.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, img)
+}
+
+// save records size and checksum of given image in profile, and saves profile
+// to given directory. Color map is also saved alone to be reused by -color-spec.
+// Profile is embedded in PNG image as well.
+func (p *Profile) save(dirName, img string) error {
+	var err error
+	if p.ImageHash, err = hashImage(img); err != nil {
+		return fmt.Errorf("fail to read image: %v", err)
+	}
+	if strings.HasSuffix(img, ".png") {
+		fr, err := os.Open(img)
+		if err != nil {
+			return fmt.Errorf("fail to read image: %v", err)
+		}
+		cfg, _, err := image.DecodeConfig(fr)
+		fr.Close()
+		if err != nil {
+			return fmt.Errorf("fail to decode image: %v", err)
+		}
+		p.Width, p.Height = cfg.Width, cfg.Height
+	}
+
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return fmt.Errorf("fail to encode json: %v", err)
+	}
+	os.MkdirAll(dirName, os.ModePerm)
+	if err = ioutil.WriteFile(path.Join(dirName, PROFILE_FILE), data, 0644); err != nil {
+		return fmt.Errorf("fail to save %s: %v", PROFILE_FILE, err)
+	}
+
+	// Built-in palettes are expanded to colors.
+	if err = ioutil.WriteFile(path.Join(dirName, "colormap.txt"), []byte(p.Colors), 0644); err != nil {
+		return fmt.Errorf("fail to save color map: %v", err)
+	}
+
+	if strings.HasSuffix(img, ".png") {
+		if err = embed(img, data); err != nil {
+			return fmt.Errorf("fail to embed profile in image: %v", err)
+		}
+	}
+	return nil
+}
+
+// LoadProfile loads profile in given profile directory,
+// profiles of older versions are migrated to current version.
+func LoadProfile(dirName string) (*Profile, error) {
+	data, err := ioutil.ReadFile(path.Join(dirName, PROFILE_FILE))
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(Profile)
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("fail to decode %s: %v", PROFILE_FILE, err)
+	}
+	if err = p.check(dirName); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadImageProfile loads profile embedded in given PNG image.
+func LoadImageProfile(img string) (*Profile, error) {
+	fr, err := os.Open(img)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	texts, err := pngtext.Read(bufio.NewReader(fr))
+	if err != nil {
+		return nil, fmt.Errorf("fail to read text chunks: %v", err)
+	}
+	data, ok := texts[PROFILE_KEYWORD]
+	if !ok {
+		return nil, errors.New("image has no embedded profile")
+	}
+
+	p := new(Profile)
+	if err = json.Unmarshal([]byte(data), p); err != nil {
+		return nil, fmt.Errorf("fail to decode embedded profile: %v", err)
+	} else if p.Version == 0 {
+		return nil, errors.New("embedded profile has no version")
+	}
+	if err = p.check(""); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// check migrates profile of older version with files in given profile directory
+// and validates it.
+func (p *Profile) check(dirName string) error {
+	switch {
+	case p.Version > PROFILE_VERSION:
+		return fmt.Errorf("profile version %d is newer than supported version %d, upgrade tool(%s)",
+			p.Version, PROFILE_VERSION, AppVer)
+	case p.Version == 0:
+		if err := p.migrateV0(dirName); err != nil {
+			return fmt.Errorf("fail to migrate profile of version 0: %v", err)
+		}
+	}
+
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("invalid profile: %v", err)
+	}
+	return nil
+}
+
+// v0VarColors is default color map of version 0, whose variant 59 had
+// the same color as variant 7, and such tiles are reversed as variant 7.
+var v0VarColors = strings.Replace(base.DefaultVarColors, "\n0, 51, 254\n", "\n0, 51, 255\n", 1)
+
+// migrateV0 migrates profile saved before schema was versioned,
+// whose color map and row offsets were saved in separate files,
+// and variant indexes beyond color map were drawn in the last variant color.
+func (p *Profile) migrateV0(dirName string) error {
+	p.Version = PROFILE_VERSION
+	p.EndPos = -1
+	p.Overflow = base.OVERFLOW_CLAMP
+	// Profiles without max column were generated with default value.
+	if p.MaxCol == 0 {
+		p.MaxCol = 3999
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dirName, "colormap.txt"))
+	if err == nil {
+		p.Colors = string(data)
+	} else if os.IsNotExist(err) {
+		log.Warn("Profile(%s) has no color map, assume default one of version 0", dirName)
+		p.Colors = v0VarColors
+	} else {
+		return err
+	}
+
+	if p.Type != base.FULL_SIZE {
+		// Band lengths are indexed from band 0.
+		p.EndBand = len(p.BandLen) - 1
+		return nil
+	}
+
+	data, err = ioutil.ReadFile(path.Join(dirName, "offsets.txt"))
+	if err != nil {
+		return err
+	}
+	for _, rows := range strings.Split(string(data), ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(rows))
+		if err != nil {
+			return fmt.Errorf("invalid offsets.txt: %v", err)
+		}
+		p.BandRows = append(p.BandRows, n)
+	}
+	p.EndBand = len(p.BandRows) - 1
+	return nil
+}
+
+// renderer returns renderer of profile's layout.
+func (p *Profile) renderer() *Renderer {
+	r := &Renderer{Config{
+		Mode:      p.Type,
+		SlotPixel: p.SlotPixel,
+		BoxNum:    p.BoxNum,
+		Border:    p.Border,
+		MaxColIdx: p.MaxCol,
+		Range:     base.Range{StartBandIdx: p.StartBand, EndBandIdx: p.EndBand, EndPosIdx: p.EndPos},
+	}}
+	return r.fit(p.EndBand, p.EndPos)
+}
+
+// dataSize returns expected size of data area of image,
+// it returns empty rectangle when end position is unknown.
+func (p *Profile) dataSize() image.Rectangle {
+	if p.EndPos < 0 {
+		return image.Rectangle{}
+	}
+
+	r := p.renderer()
+	switch p.Type {
+	case base.FULL_SIZE:
+		totalRows := 0
+		for _, rows := range p.BandRows {
+			totalRows += rows
+		}
+		return image.Rect(0, 0, r.calInitImgX(p.BoxNum, p.Border), r.calInitImgY(totalRows, p.BoxNum, p.Border))
+	case base.TRANSPARENT:
+		return image.Rect(0, 0, r.calInitImgX(p.BoxNum, p.Border), r.calInitImgY(p.EndBand+1, p.BoxNum, p.Border))
+	}
+	return image.Rect(0, 0, r.calInitImgX(1, 0), r.calInitImgY(p.EndBand-p.StartBand+1, 1, 0))
+}
+
+// validName returns true if given name of human can be used as file name.
+func validName(name string) bool {
+	return len(name) > 0 && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
+
+// Validate returns error if profile is inconsistent,
+// so image cannot be reversed by it.
+func (p *Profile) Validate() error {
+	switch {
+	case p.Version != PROFILE_VERSION:
+		return fmt.Errorf("unsupported version: %d", p.Version)
+	case p.Type < base.SINGLE || p.Type > base.HEATMAP:
+		return fmt.Errorf("unsupported mode: %v", p.Type)
+	case p.SlotPixel < 1:
+		return errors.New("slot pixel cannot be smaller than 1")
+	case p.MaxCol < 1:
+		return errors.New("max column index cannot be smaller than 1")
+	case p.StartBand < 0 || p.EndBand < p.StartBand:
+		return fmt.Errorf("invalid band range: %d - %d", p.StartBand, p.EndBand)
+	case p.EndPos < -1:
+		return fmt.Errorf("invalid end position index: %d", p.EndPos)
+	case p.Width < 0 || p.Height < 0:
+		return fmt.Errorf("invalid image size: %d * %d", p.Width, p.Height)
+	}
+	if _, err := p.ColorMap(); err != nil {
+		return fmt.Errorf("invalid color map: %v", err)
+	}
+
+	if (p.Type == base.FULL_SIZE || p.Type == base.TRANSPARENT) && (p.BoxNum < 2 || p.Border < 0) {
+		return fmt.Errorf("invalid box number or border: %d, %d", p.BoxNum, p.Border)
+	}
+	if p.Type == base.FULL_SIZE {
+		switch {
+		case len(p.BandRows) != p.EndBand+1:
+			return fmt.Errorf("expect rows of %d bands but got %d", p.EndBand+1, len(p.BandRows))
+		case len(p.Humans) > p.BoxNum*p.BoxNum:
+			return fmt.Errorf("%d humans do not fit in box of %d slots", len(p.Humans), p.BoxNum*p.BoxNum)
+		}
+		for i, rows := range p.BandRows {
+			if rows < 0 {
+				return fmt.Errorf("invalid rows of band %d: %d", i, rows)
+			}
+		}
+		for slot, h := range p.Humans {
+			if !validName(h.Name) {
+				return fmt.Errorf("invalid name of human in slot %d: %q", slot, h.Name)
+			} else if len(h.BandLen) > len(p.BandRows) {
+				return fmt.Errorf("human %s has more bands than image", h.Name)
+			}
+			for i, l := range h.BandLen {
+				if l < 0 || l > p.BandRows[i]*(p.MaxCol+1) {
+					return fmt.Errorf("length of band %d of human %s is out of bound: %d", i, h.Name, l)
+				}
+			}
+		}
+	} else {
+		switch {
+		case !validName(p.Name):
+			return fmt.Errorf("invalid name of human: %q", p.Name)
+		// Transparent layer has rows of bands that human does not have.
+		case p.Type != base.TRANSPARENT && len(p.BandLen) < p.EndBand+1:
+			return fmt.Errorf("expect lengths of %d bands but got %d", p.EndBand+1, len(p.BandLen))
+		}
+		for i, l := range p.BandLen {
+			if l < 0 {
+				return fmt.Errorf("invalid length of band %d: %d", i, l)
+			}
+		}
+	}
+
+	// Data area has to be in image and of expected size.
+	if p.Width == 0 {
+		return nil
+	}
+	bounds := image.Rect(0, 0, p.Width, p.Height)
+	data := bounds
+	if p.DataArea != nil {
+		data = image.Rect(p.DataArea.X, p.DataArea.Y,
+			p.DataArea.X+p.DataArea.Width, p.DataArea.Y+p.DataArea.Height)
+		if !data.In(bounds) {
+			return errors.New("data area is out of image")
+		}
+	}
+	if size := p.dataSize(); !size.Empty() && size.Size() != data.Size() {
+		return fmt.Errorf("expect data area of %v but got %v", size.Size(), data.Size())
+	}
+	return nil
+}
+
+// ColorMap returns color map that image is drawn in, with overflow policy in use.
+func (p *Profile) ColorMap() (*base.ColorMap, error) {
+	cm, err := base.ParseColorMap(p.Colors)
+	if err != nil {
+		return nil, err
+	}
+	return cm.WithOverflow(p.Overflow)
+}
+
+// BandOffsets returns row offset of each band in full size image.
+func (p *Profile) BandOffsets() []int {
+	offsets := make([]int, len(p.BandRows))
+	offsetRow := 0
+	for i, rows := range p.BandRows {
+		offsets[i] = offsetRow
+		offsetRow += rows
+	}
+	return offsets
+}
+
+// Match returns error if given image file is not the one profile belongs to,
+// i.e. image has been changed or replaced after profile is saved.
+func (p *Profile) Match(img string) error {
+	fr, err := os.Open(img)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	cfg, _, err := image.DecodeConfig(fr)
+	if err != nil {
+		return fmt.Errorf("fail to decode image: %v", err)
+	}
+	if p.Width > 0 && (cfg.Width != p.Width || cfg.Height != p.Height) {
+		return fmt.Errorf("image is %d * %d but profile expects %d * %d",
+			cfg.Width, cfg.Height, p.Width, p.Height)
+	} else if p.Width == 0 {
+		// Size of image is unknown in migrated profiles, check its data area at least.
+		data := image.Rect(0, 0, cfg.Width, cfg.Height)
+		if p.DataArea != nil {
+			area := image.Rect(p.DataArea.X, p.DataArea.Y,
+				p.DataArea.X+p.DataArea.Width, p.DataArea.Y+p.DataArea.Height)
+			if !area.In(data) {
+				return errors.New("data area of profile is out of image")
+			}
+			data = area
+		}
+		if data.Dx()%p.SlotPixel != 0 || data.Dy()%p.SlotPixel != 0 {
+			return fmt.Errorf("data area of %v is not in slots of %d pixels", data.Size(), p.SlotPixel)
+		}
+	}
+
+	if len(p.ImageHash) > 0 {
+		hash, err := hashImage(img)
+		if err != nil {
+			return err
+		} else if hash != p.ImageHash {
+			return errors.New("checksum of image does not match profile")
+		}
+	}
+	return nil
+}
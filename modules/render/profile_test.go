@@ -0,0 +1,145 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func Test_Profile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base.ParseColorSpec("")
+	opt := base.Option{
+		Mode:      base.SINGLE,
+		ImgDir:    dir,
+		SlotPixel: 2,
+		MaxColIdx: 3999,
+		Range:     &base.Range{EndBandIdx: 1, EndPosIdx: 2},
+	}
+	h, err := abv.ParseReader(strings.NewReader("hu1 0 .DE 1 E-"), false, opt.Range)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Name = "hu1.abv"
+
+	Convey("Save profile that can be loaded back", t, func() {
+		area, err := generateAbvImg(opt, h)
+		So(err, ShouldBeNil)
+		So(saveAbvImgProfile(opt, h, area, nil, "hash", SourceProfile{"hu1.abv", "sha1"}), ShouldBeNil)
+
+		p, err := LoadProfile(getAbvProfileDir(opt, "hu1"))
+		So(err, ShouldBeNil)
+		So(p.Version, ShouldEqual, PROFILE_VERSION)
+		So(p.Width, ShouldEqual, 6)
+		So(p.Height, ShouldEqual, 4)
+		So(p.BandLen, ShouldResemble, []int{3, 2})
+		So(p.Overflow, ShouldEqual, base.OVERFLOW_EXTEND)
+		So(p.Sources, ShouldResemble, []SourceProfile{{"hu1.abv", "sha1"}})
+		So(p.Match(path.Join(dir, getAbvImgName(opt, h.Name))), ShouldBeNil)
+
+		cm, err := p.ColorMap()
+		So(err, ShouldBeNil)
+		So(cm.String(), ShouldEqual, base.Colors.String())
+	})
+
+	Convey("Load profile embedded in image", t, func() {
+		img := path.Join(dir, getAbvImgName(opt, h.Name))
+		p, err := LoadImageProfile(img)
+		So(err, ShouldBeNil)
+		So(p.Name, ShouldEqual, "hu1")
+		So(p.Match(img), ShouldBeNil)
+
+		_, err = LoadImageProfile(path.Join(getAbvProfileDir(opt, "hu1"), PROFILE_FILE))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Refuse image that profile does not belong to", t, func() {
+		p, err := LoadProfile(getAbvProfileDir(opt, "hu1"))
+		So(err, ShouldBeNil)
+
+		other := opt
+		other.SlotPixel = 1
+		So(saveImgFile(path.Join(dir, "other.png"), rendererOf(other).initImage(2)), ShouldBeNil)
+		So(p.Match(path.Join(dir, "other.png")), ShouldNotBeNil)
+
+		p.ImageHash = "changed"
+		So(p.Match(path.Join(dir, getAbvImgName(opt, h.Name))), ShouldNotBeNil)
+	})
+
+	Convey("Validate profile", t, func() {
+		p, err := LoadProfile(getAbvProfileDir(opt, "hu1"))
+		So(err, ShouldBeNil)
+
+		bad := *p
+		bad.SlotPixel = 0
+		So(bad.Validate(), ShouldNotBeNil)
+
+		bad = *p
+		bad.BandLen = []int{3}
+		So(bad.Validate(), ShouldNotBeNil)
+
+		bad = *p
+		bad.EndPos = 5
+		So(bad.Validate(), ShouldNotBeNil)
+
+		fsp := &Profile{
+			Version:   PROFILE_VERSION,
+			Type:      base.FULL_SIZE,
+			EndBand:   1,
+			EndPos:    -1,
+			MaxCol:    1,
+			SlotPixel: 1,
+			BoxNum:    13,
+			Border:    1,
+			BandRows:  []int{2, 1},
+			Colors:    base.Colors.String(),
+			Humans:    []HumanProfile{{Name: "hu1", BandLen: []int{4, 2}}},
+		}
+		So(fsp.Validate(), ShouldBeNil)
+		So(fsp.BandOffsets(), ShouldResemble, []int{0, 2})
+
+		fsp.Humans[0].BandLen[1] = 3
+		So(fsp.Validate(), ShouldNotBeNil)
+		fsp.Humans[0] = HumanProfile{Name: "../hu1"}
+		So(fsp.Validate(), ShouldNotBeNil)
+	})
+
+	Convey("Migrate profile of version 0", t, func() {
+		v0 := path.Join(dir, "v0")
+		os.MkdirAll(v0, os.ModePerm)
+		So(ioutil.WriteFile(path.Join(v0, PROFILE_FILE), []byte(`{"type": 2, "slot_pixel": 1,
+			"box_num": 13, "border": 1, "humans": [{"name": "hu1", "band_len": [3]}]}`), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(path.Join(v0, "offsets.txt"), []byte("1,1"), 0644), ShouldBeNil)
+
+		p, err := LoadProfile(v0)
+		So(err, ShouldBeNil)
+		So(p.Version, ShouldEqual, PROFILE_VERSION)
+		So(p.MaxCol, ShouldEqual, 3999)
+		So(p.EndBand, ShouldEqual, 1)
+		So(p.BandRows, ShouldResemble, []int{1, 1})
+		So(p.Colors, ShouldEqual, v0VarColors)
+		cm, err := p.ColorMap()
+		So(err, ShouldBeNil)
+		So(cm.Vars[59], ShouldResemble, cm.Vars[7])
+		So(cm.Index(cm.Vars[59]), ShouldEqual, 7)
+		So(p.Overflow, ShouldEqual, base.OVERFLOW_CLAMP)
+		p.Overflow = "wrap"
+		So(p.Validate(), ShouldNotBeNil)
+
+		So(ioutil.WriteFile(path.Join(v0, PROFILE_FILE), []byte(`{"version": 99}`), 0644), ShouldBeNil)
+		_, err = LoadProfile(v0)
+		So(err, ShouldNotBeNil)
+	})
+}
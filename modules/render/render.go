@@ -0,0 +1,1147 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/annotate"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+)
+
+// Image formats.
+const (
+	FORMAT_PNG = "png"
+	FORMAT_SVG = "svg"
+)
+
+// Validate returns error if given options cannot be used together.
+func Validate(opt base.Option) error {
+	switch {
+	case opt.Mode < base.SINGLE || opt.Mode > base.HEATMAP:
+		return fmt.Errorf("unknown mode: %v", opt.Mode)
+	case opt.SlotPixel < 1:
+		return errors.New("-slot-pixel cannot be smaller than 1")
+	case opt.MaxColIdx < 1:
+		return errors.New("-max-col cannot be smaller than 1")
+	case opt.Border < 1:
+		return errors.New("-border cannot be smaller than 1")
+	case opt.StartBandIdx < 0:
+		return errors.New("-min-band cannot be smaller than 0")
+	case opt.StartBandIdx > 0 && (opt.Mode == base.FULL_SIZE || opt.Mode == base.TRANSPARENT):
+		return errors.New("-min-band is not supported in mode 2 and 3")
+	case opt.EndBandIdx >= 0 && opt.StartBandIdx > opt.EndBandIdx:
+		return errors.New("-min-band cannot be greater than -max-band")
+	case len(opt.Order) > 0 && opt.Mode != base.FULL_SIZE:
+		return errors.New("-order is only supported in mode 2")
+	case opt.Annotate && opt.Mode == base.TRANSPARENT:
+		return errors.New("-annotate is not supported in mode 3")
+	case opt.DryRun && opt.Mode == base.TRANSPARENT:
+		return errors.New("-dry-run is not supported in mode 3")
+	case opt.Format != FORMAT_PNG && opt.Format != FORMAT_SVG:
+		return fmt.Errorf("unknown image format: %s", opt.Format)
+	case opt.Format == FORMAT_SVG && (opt.Mode == base.TRANSPARENT || opt.Mode == base.HEATMAP):
+		return errors.New("-format=svg is not supported in mode 3 and 5")
+	case opt.Format == FORMAT_SVG && opt.Annotate:
+		return errors.New("-annotate is only supported in png format")
+	case opt.Mode == base.DIFF && len(opt.DiffPath) == 0:
+		return errors.New("-diff-path is required in mode 4")
+	case opt.Mode != base.DIFF && len(opt.DiffPath) > 0:
+		return errors.New("-diff-path is only supported in mode 4")
+	case (opt.Mode == base.SINGLE || opt.Mode == base.TRANSPARENT) && abv.IsCohortFile(opt.AbvPath):
+		return errors.New("cohort file is only supported in mode 2, 4 and 5")
+	}
+	return nil
+}
+
+// Generate generates images of given options. When opt.KeepGoing is true,
+// files that fail are skipped and returned together as *base.BatchError.
+func Generate(opt base.Option) error {
+	if err := Validate(opt); err != nil {
+		return err
+	}
+
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	var err error
+	switch {
+	case opt.Mode == base.DIFF:
+		log.Info("Mode: Difference image for each pair of humans")
+		err = generateDiffImgs(opt, batch)
+	case opt.Mode == base.HEATMAP:
+		log.Info("Mode: Heat-map image of all humans")
+		err = generateHeatmapImg(opt, batch)
+	case abv.IsCohortFile(opt.AbvPath):
+		log.Info("Mode: Full-size image for cohort file")
+		err = generateFullSizeImgFromCohort(opt, opt.AbvPath)
+	default:
+		var names []string
+		if names, err = base.GetFileListBySuffix(opt.AbvPath, ".abv"); err != nil {
+			return fmt.Errorf("fail to get abv list: %v", err)
+		}
+
+		switch opt.Mode {
+		case base.SINGLE:
+			log.Info("Mode: Single image for each abv file")
+			err = generateSingleAbvImgs(opt, names, batch)
+		case base.FULL_SIZE:
+			log.Info("Mode: Full-size image for all abv files")
+			err = generateFullSizeImg(opt, names, batch)
+		case base.TRANSPARENT:
+			log.Info("Mode: Full-size transparent image for each abv file")
+			err = generateTransparentLayers(opt, names, batch)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return batch.Err()
+}
+
+// calInitImgX returns width of image, longer bands wrap at max column index,
+// which is ignored when it is 0. Wrapped bands need all max column index plus
+// one columns, end position index modulo that is too narrow and loses tiles.
+func (r *Renderer) calInitImgX(boxNum, border int) int {
+	cols := r.EndPosIdx
+	if r.MaxColIdx > 0 && cols > r.MaxColIdx {
+		cols = r.MaxColIdx
+	}
+	return (cols+1)*boxNum*r.SlotPixel + border*cols
+}
+
+func (r *Renderer) calInitImgY(totalRows, boxNum, border int) int {
+	return totalRows*boxNum*r.SlotPixel + border*(totalRows-1)
+}
+
+func (r *Renderer) initImage(totalRows int) *image.RGBA {
+	boxNum := 1
+	border := 0
+	switch r.Mode {
+	case base.FULL_SIZE, base.TRANSPARENT:
+		boxNum = r.BoxNum
+		border = r.Border
+	}
+	m := image.NewRGBA(image.Rect(0, 0,
+		r.calInitImgX(boxNum, border), r.calInitImgY(totalRows, boxNum, border)))
+
+	// Transparent layer doesn't need base color.
+	if r.Mode != base.TRANSPARENT {
+		draw.Draw(m, m.Bounds(), image.NewUniform(r.Colors.Background), image.ZP, draw.Src)
+	}
+	return m
+}
+
+// DataArea represents area of data in annotated image.
+type DataArea struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func newDataArea(r image.Rectangle) *DataArea {
+	return &DataArea{r.Min.X, r.Min.Y, r.Dx(), r.Dy()}
+}
+
+// dataImage is a view of data area of annotated image with origin at (0, 0).
+type dataImage struct {
+	image.Image
+	area *DataArea
+}
+
+func (di dataImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, di.area.Width, di.area.Height)
+}
+
+func (di dataImage) At(x, y int) color.Color {
+	return di.Image.At(x+di.area.X, y+di.area.Y)
+}
+
+// Image returns data area of given image, it returns image itself
+// when data area is nil, i.e. image is not annotated.
+func (da *DataArea) Image(m image.Image) image.Image {
+	if da == nil {
+		return m
+	}
+	return dataImage{m, da}
+}
+
+// saveImgFile saves image to given path in PNG format.
+func saveImgFile(name string, m *image.RGBA) error {
+	os.MkdirAll(path.Dir(name), os.ModePerm)
+	fw, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("fail to create image file: %v", err)
+	}
+	defer fw.Close()
+
+	if err = png.Encode(fw, m); err != nil {
+		return fmt.Errorf("fail to encode image file: %v", err)
+	}
+	runtime.GC()
+	return nil
+}
+
+//   _________.___ _______    ________.____     ___________
+//  /   _____/|   |\      \  /  _____/|    |    \_   _____/
+//  \_____  \ |   |/   |   \/   \  ___|    |     |    __)_
+//  /        \|   /    |    \    \_\  \    |___  |        \
+// /_______  /|___\____|__  /\______  /_______ \/_______  /
+//         \/             \/        \/        \/        \/
+
+// getAbvImgName returns corresponding image name
+// based on current option and human abv file name.
+func getAbvImgName(opt base.Option, name string) string {
+	bands := base.ToStr(opt.EndBandIdx + 1)
+	if opt.StartBandIdx > 0 {
+		bands = fmt.Sprintf("%d-%d", opt.StartBandIdx, opt.EndBandIdx+1)
+	}
+	ext := ".png"
+	if opt.Format == FORMAT_SVG {
+		ext = ".svg"
+	}
+	prefix := "SI"
+	switch opt.Mode {
+	case base.DIFF:
+		prefix = "DI"
+	case base.HEATMAP:
+		prefix = "HM"
+	}
+	return fmt.Sprintf("%s_%s_%s_%d%s", prefix, strings.TrimSuffix(name, ".abv"),
+		bands, opt.EndPosIdx+1, ext)
+}
+
+func (r *Renderer) drawSingleSquare(m *image.RGBA, idx, x, y int) {
+	c := r.Colors.Color(idx)
+	for i := 0; i < r.SlotPixel; i++ {
+		for j := 0; j < r.SlotPixel; j++ {
+			m.Set(x*r.SlotPixel+i, y*r.SlotPixel+j, c)
+		}
+	}
+}
+
+// annotateAbvImg surrounds single image with band labels, position ticks and given legend.
+func (r *Renderer) annotateAbvImg(m *image.RGBA, legend []annotate.LegendEntry) (*image.RGBA, image.Rectangle) {
+	bands := make([]annotate.Tick, 0, r.EndBandIdx-r.StartBandIdx+1)
+	for i := r.StartBandIdx; i <= r.EndBandIdx; i++ {
+		bands = append(bands, annotate.Tick{
+			Offset: (i - r.StartBandIdx) * r.SlotPixel,
+			Label:  base.Int2HexStr(i),
+		})
+	}
+	positions := make([]annotate.Tick, r.EndPosIdx+1)
+	for j := range positions {
+		positions[j] = annotate.Tick{Offset: j * r.SlotPixel, Label: base.ToStr(j)}
+	}
+	return annotate.Annotate(m, bands, positions, legend)
+}
+
+// checkVariants returns error of the first tile of human whose variant index
+// is refused by overflow policy of given color map.
+func checkVariants(cm *base.ColorMap, h *abv.Human) error {
+	if cm.Overflow != base.OVERFLOW_ERROR {
+		return nil
+	}
+	for i := 0; i <= h.MaxBand; i++ {
+		for j := 0; j < h.BandLength[i]; j++ {
+			if b, ok := h.Blocks[i][j]; ok {
+				if err := cm.CheckVariant(int(b.Variant)); err != nil {
+					return fmt.Errorf("band %s, position %d: %v", base.Int2HexStr(i), j, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// generateAbvImg generates one PNG for each abv file,
+// it returns data area when image is annotated.
+func generateAbvImg(opt base.Option, h *abv.Human) (*DataArea, error) {
+	m, area := rendererOf(opt).Single(h)
+	if err := saveImgFile(path.Join(opt.ImgDir,
+		getAbvImgName(opt, path.Base(h.Name))), m); err != nil {
+		return nil, fmt.Errorf("%s: %v", h.Name, err)
+	}
+	return area, nil
+}
+
+// generateAbvSvg generates one SVG for each abv file along with given input hash.
+func generateAbvSvg(opt base.Option, h *abv.Human, hash string) error {
+	os.MkdirAll(opt.ImgDir, os.ModePerm)
+	fw, err := os.Create(path.Join(opt.ImgDir, getAbvImgName(opt, path.Base(h.Name))))
+	if err != nil {
+		return fmt.Errorf("%s: fail to create image file: %v", h.Name, err)
+	}
+	defer fw.Close()
+
+	r := rendererOf(opt)
+	c := newSvgCanvas(fw, r.calInitImgX(1, 0),
+		r.calInitImgY(opt.EndBandIdx-opt.StartBandIdx+1, 1, 0), hash)
+	drawUnrecognized := base.Colors.DrawUnrecognized()
+	for i := opt.StartBandIdx; i <= opt.EndBandIdx; i++ {
+		for j := 0; j <= opt.EndPosIdx; j++ {
+			variant := base.VAR_UNRECOGNIZE
+			if b, ok := h.Blocks[i][j]; ok {
+				variant = int(b.Variant)
+			} else if !drawUnrecognized || j >= h.BandLength[i] {
+				continue
+			}
+			c.tile(j*opt.SlotPixel, (i-opt.StartBandIdx)*opt.SlotPixel, opt.SlotPixel,
+				"", i, j, variant)
+		}
+	}
+	return c.close()
+}
+
+// getAbvProfileDir returns profile directory of single image of given human.
+func getAbvProfileDir(opt base.Option, name string) string {
+	imgName := getAbvImgName(opt, name)
+	return path.Join(opt.ImgDir, strings.TrimSuffix(imgName, path.Ext(imgName)))
+}
+
+// saveAbvImgProfile generates and saves corresponding image profile
+// of given information for converting back from image to abv file,
+// range of metric is only for heat-map image.
+func saveAbvImgProfile(opt base.Option, h *abv.Human, area *DataArea, mr *MetricRange,
+	hash string, sources ...SourceProfile) error {
+	rawName := strings.TrimSuffix(h.Name, ".abv")
+	p := newProfile(opt)
+	p.Name = rawName
+	p.DataArea = area
+	p.Metric = mr
+	p.Sources = sources
+	p.InputHash = hash
+
+	p.BandLen = bandLens(h, h.MaxBand+1, -1)
+	return p.save(getAbvProfileDir(opt, rawName), path.Join(opt.ImgDir, getAbvImgName(opt, h.Name)))
+}
+
+// generateSingleAbvImg generates image of i-th abv file when its inputs have changed.
+func generateSingleAbvImg(opt base.Option, cache *inputCache, i int, name string) error {
+	info, err := cache.info(name, true)
+	if err != nil {
+		return fmt.Errorf("fail to read abv file: %v", err)
+	}
+	h := info.human(name, opt.Range)
+
+	// Adjust range.
+	if opt.EndBandIdx == -1 || opt.EndBandIdx > h.MaxBand {
+		opt.EndBandIdx = h.MaxBand
+	}
+	if opt.EndPosIdx == -1 {
+		opt.EndPosIdx = 3999
+	} else if opt.EndPosIdx > h.MaxPos {
+		opt.EndPosIdx = h.MaxPos
+	}
+
+	// Skip if up-to-date, SVG is not for reversing,
+	// so it needs no profile and records input hash itself.
+	imgName := path.Join(opt.ImgDir, getAbvImgName(opt, h.Name))
+	profile := ""
+	if opt.Format != FORMAT_SVG {
+		profile = path.Join(getAbvProfileDir(opt, h.Name), PROFILE_FILE)
+	}
+	hash := inputHash(opt, info.Hash)
+	if !needBuild(opt, imgName, profile, hash) {
+		return nil
+	}
+
+	h, err = abv.Parse(name, false, opt.Range, nil)
+	if err != nil {
+		return fmt.Errorf("fail to parse abv file: %v", err)
+	}
+	h.Name = path.Base(name)
+	if err = checkVariants(base.Colors, h); err != nil {
+		return err
+	}
+
+	if opt.Format == FORMAT_SVG {
+		if err = generateAbvSvg(opt, h, hash); err != nil {
+			return fmt.Errorf("fail to generate abv image: %v", err)
+		}
+	} else {
+		area, err := generateAbvImg(opt, h)
+		if err != nil {
+			return fmt.Errorf("fail to generate abv image: %v", err)
+		} else if err = saveAbvImgProfile(opt, h, area, nil, hash,
+			SourceProfile{h.Name, info.Hash}); err != nil {
+			return fmt.Errorf("fail to save abv image profile: %v", err)
+		}
+	}
+
+	log.Info("[%d] %s: %d * %d", i, h.Name, h.MaxBand, h.MaxPos)
+	return nil
+}
+
+// generateSingleAbvImgs is a high level function to generate image for each abv file.
+// Images are only regenerated when their inputs have changed.
+func generateSingleAbvImgs(opt base.Option, names []string, batch *base.Batch) error {
+	cache := loadInputCache(opt)
+	for i, name := range names {
+		if err := generateSingleAbvImg(opt, cache, i, name); err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+		}
+	}
+	return cache.save(opt)
+}
+
+// _______________ ___.____    .____        _________.________________________
+// \_   _____/    |   \    |   |    |      /   _____/|   \____    /\_   _____/
+//  |    __) |    |   /    |   |    |      \_____  \ |   | /     /  |    __)_
+//  |     \  |    |  /|    |___|    |___   /        \|   |/     /_  |        \
+//  \___  /  |______/ |_______ \_______ \ /_______  /|___/_______ \/_______  /
+//      \/                    \/       \/         \/             \/        \/
+
+// Orders of humans in full size image, default is order of directory listing.
+const (
+	ORDER_NAME       = "name"
+	ORDER_CALL_RATE  = "callrate"
+	ORDER_SIMILARITY = "similarity"
+	ORDER_FILE       = "file:"
+)
+
+// humanSlots sorts human indexes in slots by given less function.
+type humanSlots struct {
+	slots []int
+	less  func(i, j int) bool
+}
+
+func (hs humanSlots) Len() int {
+	return len(hs.slots)
+}
+
+func (hs humanSlots) Swap(i, j int) {
+	hs.slots[i], hs.slots[j] = hs.slots[j], hs.slots[i]
+}
+
+func (hs humanSlots) Less(i, j int) bool {
+	return hs.less(hs.slots[i], hs.slots[j])
+}
+
+// orderByList returns human indexes in order of sample list file,
+// humans not in the list follow in their original order.
+func orderByList(name string, samples []string) ([]int, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make(map[string]int, len(samples))
+	for i, sample := range samples {
+		indexes[sample] = i
+	}
+
+	slots := make([]int, 0, len(samples))
+	listed := make(map[int]bool, len(samples))
+	for _, line := range strings.Split(string(data), "\n") {
+		sample := strings.TrimSpace(line)
+		if len(sample) == 0 {
+			continue
+		}
+
+		idx, ok := indexes[sample]
+		if !ok {
+			return nil, fmt.Errorf("sample %s in list does not exist", sample)
+		} else if listed[idx] {
+			return nil, fmt.Errorf("sample %s is listed more than once", sample)
+		}
+		listed[idx] = true
+		slots = append(slots, idx)
+	}
+
+	for i, sample := range samples {
+		if !listed[i] {
+			log.Warn("Sample %s is not in list, put it after listed ones", sample)
+			slots = append(slots, i)
+		}
+	}
+	return slots, nil
+}
+
+// humanOrder returns index of human in each slot of full size image by given order.
+// Humans are loaded by given function only when order needs their tiles.
+func humanOrder(order string, samples []string, load func() ([]*abv.Human, error)) ([]int, error) {
+	slots := make([]int, len(samples))
+	for i := range slots {
+		slots[i] = i
+	}
+
+	switch {
+	case len(order) == 0:
+	case order == ORDER_NAME:
+		sort.Stable(humanSlots{slots, func(i, j int) bool {
+			return samples[i] < samples[j]
+		}})
+	case order == ORDER_CALL_RATE:
+		humans, err := load()
+		if err != nil {
+			return nil, err
+		}
+		rates := make([]float64, len(humans))
+		for i, h := range humans {
+			rates[i] = h.CallRate()
+		}
+		sort.Stable(humanSlots{slots, func(i, j int) bool {
+			return rates[i] > rates[j]
+		}})
+	case order == ORDER_SIMILARITY:
+		humans, err := load()
+		if err != nil {
+			return nil, err
+		}
+		slots = abv.ClusterOrder(humans)
+	case strings.HasPrefix(order, ORDER_FILE):
+		return orderByList(strings.TrimPrefix(order, ORDER_FILE), samples)
+	default:
+		return nil, fmt.Errorf("unknown order: %s", order)
+	}
+	return slots, nil
+}
+
+func (r *Renderer) drawFullSizeSquare(m *image.RGBA, idx, x, y int) {
+	c := r.Colors.Color(idx)
+	for i := 0; i < r.SlotPixel; i++ {
+		for j := 0; j < r.SlotPixel; j++ {
+			m.Set(x+i, y+j, c)
+		}
+	}
+}
+
+// updateMaxRows updates max rows of each band based on given band lengths.
+func (r *Renderer) updateMaxRows(maxRows, bandLength map[int]int) {
+	for i := 0; i <= r.EndBandIdx; i++ {
+		row := (bandLength[i]-1)/(r.MaxColIdx+1) + 1
+		if row > maxRows[i] {
+			maxRows[i] = row
+		} else if maxRows[i] == 0 {
+			maxRows[i] = 1
+		}
+	}
+}
+
+// prepareFullSizeDir creates profile directory of full size image,
+// saves row offsets of bands and returns directory name and total rows.
+// Nothing is created in dry-run mode.
+func prepareFullSizeDir(opt base.Option, maxRows map[int]int) (string, int, error) {
+	totalRows := 0
+	bandRows := make([]string, opt.EndBandIdx+1)
+	for i := 0; i <= opt.EndBandIdx; i++ {
+		totalRows += maxRows[i]
+		bandRows[i] = base.ToStr(maxRows[i])
+	}
+
+	dirName := fmt.Sprintf("%s/FS_%d(%d)_%d(%d)",
+		opt.ImgDir, opt.EndBandIdx+1, totalRows,
+		opt.EndPosIdx+1, opt.EndPosIdx%(opt.MaxColIdx+1)+1)
+	log.Info("Total rows: %d", totalRows)
+	if opt.DryRun {
+		return dirName, totalRows, nil
+	}
+
+	os.MkdirAll(dirName, os.ModePerm)
+	if err := ioutil.WriteFile(path.Join(dirName, "offsets.txt"),
+		[]byte(strings.Join(bandRows, ",")), os.ModePerm); err != nil {
+		return "", 0, fmt.Errorf("fail to save offsets.txt: %v", err)
+	}
+	return dirName, totalRows, nil
+}
+
+// getFullSizeImgName returns name of full size image of given profile directory.
+func getFullSizeImgName(opt base.Option, dirName string) string {
+	if opt.Format == FORMAT_SVG {
+		return dirName + ".svg"
+	}
+	return dirName + ".png"
+}
+
+// fullSizeLayoutHash returns hash of options and row offsets of bands.
+func fullSizeLayoutHash(opt base.Option, maxRows map[int]int) string {
+	bandRows := make([]string, opt.EndBandIdx+1)
+	for i := range bandRows {
+		bandRows[i] = base.ToStr(maxRows[i])
+	}
+	return inputHash(opt, strings.Join(bandRows, ","))
+}
+
+// orderInputs returns fingerprint of sample list file when humans
+// are ordered by it, because slots depend on its content.
+func orderInputs(cache *inputCache, order string) ([]string, error) {
+	if !strings.HasPrefix(order, ORDER_FILE) {
+		return nil, nil
+	}
+	info, err := cache.info(strings.TrimPrefix(order, ORDER_FILE), false)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read sample list: %v", err)
+	}
+	return []string{info.Hash}, nil
+}
+
+// FullSizeTileXY returns top-left pixel of a tile of human in given slot
+// at given position of band, which starts at given row offset.
+func FullSizeTileXY(maxCol, slotPixel, boxNum, border, slot, offsetRow, pos int) (int, int) {
+	rowIdx := pos/(maxCol+1) + offsetRow
+	colIdx := pos % (maxCol + 1)
+	return colIdx*(slotPixel*boxNum) + border*colIdx + (slot%boxNum)*slotPixel,
+		rowIdx*(slotPixel*boxNum) + border*rowIdx + (slot/boxNum)*slotPixel
+}
+
+// drawFullSizeTile draws a tile of human in given slot at given position of band,
+// which starts at given row offset.
+func (r *Renderer) drawFullSizeTile(m *image.RGBA, slot, offsetRow, pos, variant int) {
+	x, y := FullSizeTileXY(r.MaxColIdx, r.SlotPixel, r.BoxNum, r.Border, slot, offsetRow, pos)
+	r.drawFullSizeSquare(m, variant, x, y)
+}
+
+// annotateFullSizeImg surrounds full size image with band labels, column ticks and legend.
+func (r *Renderer) annotateFullSizeImg(m *image.RGBA, maxRows map[int]int) (*image.RGBA, image.Rectangle) {
+	unit := r.SlotPixel*r.BoxNum + r.Border
+	bands := make([]annotate.Tick, r.EndBandIdx+1)
+	offsetRow := 0
+	for i := range bands {
+		bands[i] = annotate.Tick{Offset: offsetRow * unit, Label: base.Int2HexStr(i)}
+		offsetRow += maxRows[i]
+	}
+	cols := make([]annotate.Tick, 0, r.MaxColIdx+1)
+	for i := 0; i <= r.EndPosIdx && i <= r.MaxColIdx; i++ {
+		cols = append(cols, annotate.Tick{Offset: i * unit, Label: base.ToStr(i)})
+	}
+	return annotate.Annotate(m, bands, cols, annotate.VariantLegend(r.Colors))
+}
+
+// fullSizeCanvas is the full size image being drawn in PNG or SVG format.
+type fullSizeCanvas struct {
+	opt base.Option
+	r   *Renderer
+	m   *image.RGBA
+	fw  *os.File
+	svg *svgCanvas
+}
+
+func newFullSizeCanvas(opt base.Option, dirName string, totalRows int) (*fullSizeCanvas, error) {
+	c := &fullSizeCanvas{opt: opt, r: rendererOf(opt)}
+	if opt.Format != FORMAT_SVG {
+		c.m = c.r.initImage(totalRows)
+		return c, nil
+	}
+
+	var err error
+	if c.fw, err = os.Create(getFullSizeImgName(opt, dirName)); err != nil {
+		return nil, fmt.Errorf("fail to create image file: %v", err)
+	}
+	c.svg = newSvgCanvas(c.fw, c.r.calInitImgX(opt.BoxNum, opt.Border),
+		c.r.calInitImgY(totalRows, opt.BoxNum, opt.Border), "")
+	return c, nil
+}
+
+// reuse draws previous PNG image of the same layout onto canvas and returns
+// its humans in order of slots, so only slots whose humans have changed
+// need to be redrawn. It returns nil when there is nothing to reuse.
+func (c *fullSizeCanvas) reuse(dirName, layoutHash string) []HumanProfile {
+	if c.svg != nil || c.opt.Force {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dirName, PROFILE_FILE))
+	if err != nil {
+		return nil
+	}
+	var fsp Profile
+	if err = json.Unmarshal(data, &fsp); err != nil || fsp.LayoutHash != layoutHash {
+		return nil
+	}
+
+	fr, err := os.Open(getFullSizeImgName(c.opt, dirName))
+	if err != nil {
+		return nil
+	}
+	defer fr.Close()
+
+	m, err := png.Decode(fr)
+	if err != nil {
+		log.Warn("Fail to decode previous image, redraw all slots: %v", err)
+		return nil
+	}
+	m = fsp.DataArea.Image(m)
+	if m.Bounds() != c.m.Bounds() {
+		return nil
+	}
+	draw.Draw(c.m, c.m.Bounds(), m, image.ZP, draw.Src)
+	return fsp.Humans
+}
+
+// clearSlot fills all tiles of human in given slot with background.
+func (c *fullSizeCanvas) clearSlot(slot int, maxRows map[int]int) {
+	bg := image.NewUniform(c.r.Colors.Background)
+	offsetRow := 0
+	for i := 0; i <= c.opt.EndBandIdx; i++ {
+		for j := 0; j < maxRows[i]*(c.opt.MaxColIdx+1) && j <= c.opt.EndPosIdx; j++ {
+			x, y := FullSizeTileXY(c.opt.MaxColIdx, c.opt.SlotPixel, c.opt.BoxNum, c.opt.Border,
+				slot, offsetRow, j)
+			draw.Draw(c.m, image.Rect(x, y, x+c.opt.SlotPixel, y+c.opt.SlotPixel),
+				bg, image.ZP, draw.Src)
+		}
+		offsetRow += maxRows[i]
+	}
+}
+
+// drawTile draws a tile of human in given slot at given position of band,
+// which starts at given row offset.
+func (c *fullSizeCanvas) drawTile(slot, offsetRow int, human string, band, pos, variant int) {
+	if c.svg == nil {
+		c.r.drawFullSizeTile(c.m, slot, offsetRow, pos, variant)
+		return
+	}
+
+	x, y := FullSizeTileXY(c.opt.MaxColIdx, c.opt.SlotPixel, c.opt.BoxNum, c.opt.Border,
+		slot, offsetRow, pos)
+	c.svg.tile(x, y, c.opt.SlotPixel, human, band, pos, variant)
+}
+
+// saveFullSizeImg saves full size image along with its profile.
+func saveFullSizeImg(opt base.Option, dirName string, c *fullSizeCanvas, maxRows map[int]int, fsp *Profile) error {
+	if c.svg != nil {
+		err := c.svg.close()
+		c.fw.Close()
+		if err != nil {
+			return fmt.Errorf("fail to save image: %v", err)
+		}
+	} else if err := saveFullSizePng(opt, dirName, c.m, maxRows, fsp); err != nil {
+		return err
+	}
+
+	fsp.BandRows = make([]int, opt.EndBandIdx+1)
+	for i := range fsp.BandRows {
+		fsp.BandRows[i] = maxRows[i]
+	}
+	return fsp.save(dirName, getFullSizeImgName(opt, dirName))
+}
+
+// saveFullSizePng saves full size image in PNG format, annotations are drawn
+// and data area is recorded in profile when needed.
+func saveFullSizePng(opt base.Option, dirName string, m *image.RGBA, maxRows map[int]int, fsp *Profile) error {
+	if opt.Annotate {
+		var rect image.Rectangle
+		m, rect = rendererOf(opt).annotateFullSizeImg(m, maxRows)
+		fsp.DataArea = newDataArea(rect)
+
+		// Key image of human-to-slot layout.
+		names := make([]string, len(fsp.Humans))
+		for i := range fsp.Humans {
+			names[i] = fsp.Humans[i].Name
+		}
+		if err := saveImgFile(path.Join(dirName, "key.png"),
+			annotate.SlotKey(names, opt.BoxNum)); err != nil {
+			return fmt.Errorf("fail to save key image: %v", err)
+		}
+	}
+
+	if err := saveImgFile(getFullSizeImgName(opt, dirName), m); err != nil {
+		return fmt.Errorf("fail to save image: %v", err)
+	}
+	return nil
+}
+
+// adjustFullSizeRange sets default range of full size image.
+func adjustFullSizeRange(opt base.Option) {
+	// NOTE: in order to generate whole PNG for shorter porcessing time,
+	// 	use user input to specify the -max-band=862 and -max-pos=58999
+	// 	would be very nice.
+	if opt.EndBandIdx == -1 {
+		opt.EndBandIdx = 862
+	}
+	if opt.EndPosIdx == -1 {
+		opt.EndPosIdx = 3999
+	}
+}
+
+// generateFullSizeImg generates a single image file that contains all abv files' info.
+// Band lengths are taken from cache, and previous image of the same layout is
+// reused, so only abv files that have changed are read. When batch keeps going,
+// humans that fail are skipped and their slots are left empty.
+func generateFullSizeImg(opt base.Option, names []string, batch *base.Batch) error {
+	adjustFullSizeRange(opt)
+
+	cache := loadInputCache(opt)
+	infos := make([]*inputInfo, 0, len(names))
+	readable := make([]string, 0, len(names))
+	for _, name := range names {
+		info, err := cache.info(name, true)
+		if err != nil {
+			if err = batch.Fail(name, fmt.Errorf("fail to read abv file: %v", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		infos = append(infos, info)
+		readable = append(readable, name)
+	}
+	names = readable
+
+	samples := make([]string, len(names))
+	for i, name := range names {
+		samples[i] = strings.TrimSuffix(path.Base(name), ".abv")
+	}
+	failed := make(map[int]bool)
+	slots, err := humanOrder(opt.Order, samples, func() ([]*abv.Human, error) {
+		humans := make([]*abv.Human, len(names))
+		for i, name := range names {
+			h, err := abv.Parse(name, false, opt.Range, nil)
+			if err != nil {
+				if err = batch.Fail(name, fmt.Errorf("fail to parse abv file: %v", err)); err != nil {
+					return nil, err
+				}
+				failed[i] = true
+				h = &abv.Human{Blocks: make(map[int]map[int]*abv.Block), BandLength: make(map[int]int)}
+			}
+			humans[i] = h
+		}
+		return humans, nil
+	})
+	if err != nil {
+		return fmt.Errorf("fail to order humans: %v", err)
+	}
+
+	// NOTE: Go has huge memory usage for image process, consider generate images
+	// directly from raw data.
+
+	// First pass, determine how many rows are going to draw.
+	r := rendererOf(opt)
+	maxRows := make(map[int]int)
+	for i, name := range names {
+		r.updateMaxRows(maxRows, infos[i].human(name, opt.Range).BandLength)
+	}
+
+	dirName, totalRows, err := prepareFullSizeDir(opt, maxRows)
+	if err != nil || opt.CountOnly {
+		return err
+	}
+
+	inputs, err := orderInputs(cache, opt.Order)
+	if err != nil {
+		return err
+	}
+	for _, idx := range slots {
+		inputs = append(inputs, samples[idx]+":"+infos[idx].Hash)
+	}
+	hash := inputHash(opt, inputs...)
+	if !needBuild(opt, getFullSizeImgName(opt, dirName), path.Join(dirName, PROFILE_FILE), hash) {
+		return cache.save(opt)
+	}
+
+	c, err := newFullSizeCanvas(opt, dirName, totalRows)
+	if err != nil {
+		return err
+	}
+	drawUnrecognized := r.Colors.DrawUnrecognized()
+	layoutHash := fullSizeLayoutHash(opt, maxRows)
+	prev := c.reuse(dirName, layoutHash)
+	log.Info("Image initialized")
+
+	fsp := newProfile(opt)
+	fsp.Humans = make([]HumanProfile, len(names))
+	fsp.Sources = make([]SourceProfile, len(names))
+	fsp.InputHash = hash
+	fsp.LayoutHash = layoutHash
+	for i, name := range names {
+		fsp.Sources[i] = SourceProfile{path.Base(name), infos[i].Hash}
+	}
+
+	// Second pass, actually draw slots that have changed.
+	for slot, idx := range slots {
+		name := names[idx]
+		hp := &fsp.Humans[slot]
+		hp.Name, hp.Hash = samples[idx], infos[idx].Hash
+		if slot < len(prev) {
+			if prev[slot].Name == hp.Name && prev[slot].Hash == hp.Hash {
+				hp.BandLen = prev[slot].BandLen
+				log.Info("[%d] %s: unchanged", slot, hp.Name)
+				continue
+			}
+			c.clearSlot(slot, maxRows)
+		}
+		if failed[idx] {
+			hp.Hash = ""
+			continue
+		}
+
+		h, err := abv.Parse(name, false, opt.Range, nil)
+		if err != nil {
+			if err = batch.Fail(name, fmt.Errorf("fail to parse abv file: %v", err)); err != nil {
+				return err
+			}
+			hp.Hash = ""
+			continue
+		}
+		h.Name = path.Base(name)
+		if err = checkVariants(r.Colors, h); err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+			hp.Hash = ""
+			continue
+		}
+
+		offsetRow := 0
+		for i := 0; i <= opt.EndBandIdx; i++ {
+			for j := 0; j < h.BandLength[i]; j++ {
+				if b, ok := h.Blocks[i][j]; ok {
+					c.drawTile(slot, offsetRow, samples[idx], i, j, int(b.Variant))
+				} else if drawUnrecognized {
+					c.drawTile(slot, offsetRow, samples[idx], i, j, base.VAR_UNRECOGNIZE)
+				}
+			}
+			offsetRow += maxRows[i]
+		}
+
+		hp.BandLen = bandLens(h, h.MaxBand+1, -1)
+
+		log.Info("[%d] %s: %d * %d", slot, h.Name, h.MaxBand, h.MaxPos)
+		runtime.GC()
+	}
+	// Humans have been removed.
+	for slot := len(slots); slot < len(prev); slot++ {
+		c.clearSlot(slot, maxRows)
+	}
+
+	if err = saveFullSizeImg(opt, dirName, c, maxRows, fsp); err != nil {
+		return err
+	}
+	return cache.save(opt)
+}
+
+// generateFullSizeImgFromCohort generates a full size image from a cohort file
+// in a single sequential scan, because band lengths are known from band table.
+func generateFullSizeImgFromCohort(opt base.Option, name string) error {
+	adjustFullSizeRange(opt)
+
+	fr, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("fail to open cohort file(%s): %v", name, err)
+	}
+	defer fr.Close()
+
+	cr, err := abv.NewCohortReader(fr)
+	if err != nil {
+		return fmt.Errorf("fail to read cohort file(%s): %v", name, err)
+	}
+
+	slots, err := humanOrder(opt.Order, cr.Samples, func() ([]*abv.Human, error) {
+		// Tiles are needed before drawing, so read cohort file once more.
+		fr, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer fr.Close()
+
+		cr, err := abv.NewCohortReader(fr)
+		if err != nil {
+			return nil, err
+		}
+		return cr.Humans(opt.Range)
+	})
+	if err != nil {
+		return fmt.Errorf("fail to order humans: %v", err)
+	}
+	slotOf := make([]int, len(slots))
+	for slot, idx := range slots {
+		slotOf[idx] = slot
+	}
+
+	fsp := newProfile(opt)
+	fsp.Humans = make([]HumanProfile, len(cr.Samples))
+
+	// Band lengths of each sample within range.
+	bandLens := make([]map[int]int, len(cr.Samples))
+	for idx := range cr.Samples {
+		bandLens[idx] = make(map[int]int)
+		fsp.Humans[slotOf[idx]].Name = cr.Samples[idx]
+	}
+	for _, info := range cr.Bands {
+		if info.Index > opt.EndBandIdx {
+			break
+		}
+		for idx, l := range info.Lens {
+			// Sample does not have this band.
+			if l < 0 {
+				continue
+			}
+			if l > opt.EndPosIdx+1 {
+				l = opt.EndPosIdx + 1
+			}
+			bandLens[idx][info.Index] = l
+			if l > 0 {
+				hp := &fsp.Humans[slotOf[idx]]
+				hp.BandLen = append(hp.BandLen, make([]int, info.Index+1-len(hp.BandLen))...)
+				hp.BandLen[info.Index] = l
+			}
+		}
+	}
+
+	r := rendererOf(opt)
+	maxRows := make(map[int]int)
+	for idx := range bandLens {
+		r.updateMaxRows(maxRows, bandLens[idx])
+	}
+
+	dirName, totalRows, err := prepareFullSizeDir(opt, maxRows)
+	if err != nil || opt.CountOnly {
+		return err
+	}
+
+	cache := loadInputCache(opt)
+	info, err := cache.info(name, false)
+	if err != nil {
+		return fmt.Errorf("fail to read cohort file(%s): %v", name, err)
+	}
+	inputs, err := orderInputs(cache, opt.Order)
+	if err != nil {
+		return err
+	}
+	fsp.Sources = []SourceProfile{{path.Base(name), info.Hash}}
+	fsp.InputHash = inputHash(opt, append(inputs, info.Hash)...)
+	if !needBuild(opt, getFullSizeImgName(opt, dirName), path.Join(dirName, PROFILE_FILE), fsp.InputHash) {
+		return cache.save(opt)
+	}
+
+	c, err := newFullSizeCanvas(opt, dirName, totalRows)
+	if err != nil {
+		return err
+	}
+	drawUnrecognized := r.Colors.DrawUnrecognized()
+	log.Info("Image initialized")
+
+	offsetRow := 0
+	nextBand := 0
+	for {
+		cb, err := cr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("fail to read cohort file(%s): %v", name, err)
+		}
+
+		if cb.Index > opt.EndBandIdx {
+			break
+		}
+		// Skip row offsets of bands that no sample has.
+		for ; nextBand < cb.Index; nextBand++ {
+			offsetRow += maxRows[nextBand]
+		}
+
+		for idx, tiles := range cb.Tiles {
+			for j, tile := range tiles[:bandLens[idx][cb.Index]] {
+				switch {
+				case tile != abv.TILE_UNRECOGNIZE:
+					if err = r.Colors.CheckVariant(int(tile)); err != nil {
+						return fmt.Errorf("%s: band %s, position %d: %v",
+							cr.Samples[idx], base.Int2HexStr(cb.Index), j, err)
+					}
+					c.drawTile(slotOf[idx], offsetRow, cr.Samples[idx], cb.Index, j, int(tile))
+				case drawUnrecognized:
+					c.drawTile(slotOf[idx], offsetRow, cr.Samples[idx], cb.Index, j, base.VAR_UNRECOGNIZE)
+				}
+			}
+		}
+		offsetRow += maxRows[cb.Index]
+		nextBand++
+		log.Debug("Band %d drawn", cb.Index)
+	}
+
+	if err = saveFullSizeImg(opt, dirName, c, maxRows, fsp); err != nil {
+		return err
+	}
+	return cache.save(opt)
+}
+
+// _____________________    _____    _______    ___________________  _____
+// \__    ___/\______   \  /  _  \   \      \  /   _____/\______   \/  _  \
+//   |    |    |       _/ /  /_\  \  /   |   \ \_____  \  |     ___/  /_\  \
+//   |    |    |    |   \/    |    \/    |    \/        \ |    |  /    |    \
+//   |____|    |____|_  /\____|__  /\____|__  /_______  / |____|  \____|__  /
+//                    \/         \/         \/        \/                  \/
+// _____________________ __________________
+// \______   \_   _____/ \      \__    ___/
+//  |       _/|    __)_  /   |   \|    |
+//  |    |   \|        \/    |    \    |
+//  |____|_  /_______  /\____|__  /____|
+//         \/        \/         \/
+
+func (r *Renderer) drawTransparentSquare(m *image.RGBA, idx, x, y int) {
+	c := r.Colors.Color(idx)
+	for i := 0; i < 2*r.SlotPixel; i++ {
+		for j := 0; j < 2*r.SlotPixel; j++ {
+			m.Set(x+i, y+j, c)
+		}
+	}
+}
+
+// generateTransparentLayer generates transparent layer for each abv file
+// along with its profile.
+func generateTransparentLayer(opt base.Option, h *abv.Human, hash string) error {
+	if err := checkVariants(base.Colors, h); err != nil {
+		return fmt.Errorf("%s: %v", h.Name, err)
+	}
+	m := rendererOf(opt).Transparent(h)
+	imgName := fmt.Sprintf("%s/TL_%s.png", opt.ImgDir, h.Name)
+	if err := saveImgFile(imgName, m); err != nil {
+		return fmt.Errorf("%s: %v", h.Name, err)
+	}
+
+	p := newProfile(opt)
+	p.Name = strings.TrimSuffix(h.Name, ".abv")
+	p.Sources = []SourceProfile{{h.Name, hash}}
+	p.BandLen = bandLens(h, h.MaxBand+1, -1)
+	if err := p.save(strings.TrimSuffix(imgName, ".png"), imgName); err != nil {
+		return fmt.Errorf("%s: fail to save profile: %v", h.Name, err)
+	}
+	return nil
+}
+
+// generateTransparentLayers is a high level function to generate transparent layer
+// for each abv file.
+func generateTransparentLayers(opt base.Option, names []string, batch *base.Batch) error {
+	// NOTE: in order to generate whole PNG for shorter porcessing time,
+	// use user input to specify the -max-band=862 and -max-pos=58999
+	// would be very nice.
+	if opt.EndBandIdx == -1 {
+		opt.EndBandIdx = 862
+	}
+	if opt.EndPosIdx == -1 {
+		opt.EndPosIdx = 3999
+	}
+
+	for i, name := range names {
+		h, err := abv.Parse(name, false, opt.Range, nil)
+		if err != nil {
+			err = fmt.Errorf("fail to parse abv file: %v", err)
+		} else {
+			h.Name = path.Base(name)
+			var hash string
+			if hash, err = hashFile(name); err == nil {
+				err = generateTransparentLayer(opt, h, hash)
+			}
+		}
+		if err != nil {
+			if err = batch.Fail(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("[%d] %s", i, h.Name)
+	}
+	return nil
+}
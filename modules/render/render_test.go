@@ -0,0 +1,176 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func Test_calInitImg(t *testing.T) {
+	type Val struct {
+		endBandIdx, endPosIdx int
+		slotPixel             int
+		boxNum, border        int
+		x, y                  int
+	}
+	vals := []Val{
+		{9, 9, 1, 13, 1, 139, 139},
+		{9, 99, 1, 13, 1, 1399, 139},
+		{99, 99, 1, 13, 1, 1399, 1399},
+		{99, 999, 1, 13, 1, 13999, 1399},
+		{862, 999, 1, 13, 1, 13999, 12081},
+		{862, 9999, 1, 13, 1, 139999, 12081},
+		{862, 19999, 1, 13, 1, 279999, 12081},
+		{862, 29999, 1, 13, 1, 419999, 12081},
+		{862, 39999, 1, 13, 1, 559999, 12081},
+		{862, 49999, 1, 13, 1, 699999, 12081},
+		{862, 59999, 1, 13, 1, 839999, 12081},
+		{862, 59999, 2, 13, 1, 1619999, 23300},
+		{862, 59999, 2, 13, 2, 1679998, 24162},
+		{862, 59999, 2, 14, 2, 1799998, 25888},
+		{862, 59999, 2, 15, 2, 1919998, 27614},
+	}
+	Convey("Calculate init image x and y", t, func() {
+		for _, v := range vals {
+			r := &Renderer{Config{
+				Range: base.Range{
+					EndBandIdx: v.endBandIdx,
+					EndPosIdx:  v.endPosIdx,
+				},
+				SlotPixel: v.slotPixel,
+			}}
+			So(r.calInitImgX(v.boxNum, v.border), ShouldEqual, v.x)
+			So(r.calInitImgY(r.EndBandIdx+1, v.boxNum, v.border), ShouldEqual, v.y)
+		}
+	})
+
+	Convey("Do not wrap bands when max column index is 0", t, func() {
+		for _, endPos := range []int{0, 99, 5000} {
+			r := &Renderer{Config{
+				Range:     base.Range{EndBandIdx: 9, EndPosIdx: endPos},
+				SlotPixel: 1,
+			}}
+			So(r.calInitImgX(13, 1), ShouldEqual, (endPos+1)*13+endPos)
+		}
+	})
+
+	Convey("Wrap bands at max column index", t, func() {
+		for _, endPos := range []int{99, 100, 120, 199} {
+			r := &Renderer{Config{
+				Range:     base.Range{EndBandIdx: 9, EndPosIdx: endPos},
+				SlotPixel: 1,
+				MaxColIdx: 99,
+			}}
+			x := r.calInitImgX(13, 1)
+			So(x, ShouldEqual, 1399)
+
+			// Last slot of last column has to be inside of image.
+			tx, _ := FullSizeTileXY(r.MaxColIdx, r.SlotPixel, 13, 1, 168, 0, 99)
+			So(tx, ShouldBeLessThan, x)
+		}
+	})
+}
+
+func Test_getAbvProfileDir(t *testing.T) {
+	Convey("Profile directory is image name without extension", t, func() {
+		opt := base.Option{ImgDir: "imgs", Mode: base.SINGLE,
+			Range: &base.Range{EndBandIdx: 9, EndPosIdx: 49}}
+		for _, format := range []string{FORMAT_PNG, FORMAT_SVG} {
+			opt.Format = format
+			So(getAbvProfileDir(opt, "hu1.abv"), ShouldEqual, "imgs/SI_hu1_10_50")
+		}
+	})
+}
+
+func Test_svgCanvas(t *testing.T) {
+	base.ParseColorSpec("")
+
+	Convey("Merge consecutive tiles of the same variant", t, func() {
+		buf := new(bytes.Buffer)
+		c := newSvgCanvas(buf, 10, 4, "")
+		c.tile(0, 0, 2, "", 0, 0, 1)
+		c.tile(2, 0, 2, "", 0, 1, 1)
+		c.tile(4, 0, 2, "", 0, 2, 2)
+		c.tile(6, 2, 2, "", 1, 3, 2)
+		So(c.close(), ShouldBeNil)
+
+		svg := buf.String()
+		So(strings.Count(svg, "<rect"), ShouldEqual, 4)
+		So(svg, ShouldContainSubstring, `x="0" y="0" width="4" height="2"`)
+		So(svg, ShouldContainSubstring, `data-band="0" data-pos="0-1" data-variant="1"`)
+		So(svg, ShouldContainSubstring, `<title>band 1, pos 3, variant 2</title>`)
+		So(svg, ShouldEndWith, "</svg>\n")
+	})
+}
+
+func Test_diffHuman(t *testing.T) {
+	newHuman := func(bands ...string) *abv.Human {
+		h := &abv.Human{
+			Blocks:     make(map[int]map[int]*abv.Block),
+			BandLength: make(map[int]int),
+		}
+		for i, band := range bands {
+			h.BandLength[i] = len(band)
+			h.Blocks[i] = make(map[int]*abv.Block)
+			for j := range band {
+				if band[j] != '-' {
+					h.Blocks[i][j] = &abv.Block{Variant: band[j] - '0'}
+				}
+			}
+		}
+		return h
+	}
+
+	Convey("Categorize differences of every tile", t, func() {
+		h := diffHuman(newHuman("012-", "1"), newHuman("02--3", "1", "0"))
+		So(h.MaxBand, ShouldEqual, 2)
+		So(h.MaxPos, ShouldEqual, 4)
+		So(h.BandLength, ShouldResemble, map[int]int{0: 5, 1: 1, 2: 1})
+
+		expects := [][]byte{
+			{DIFF_SAME, DIFF_VARIANT, DIFF_ONE_UNRECOGNIZED, DIFF_BOTH_UNRECOGNIZED, DIFF_ONE_UNRECOGNIZED},
+			{DIFF_SAME},
+			{DIFF_ONE_UNRECOGNIZED},
+		}
+		for i, expect := range expects {
+			for j, category := range expect {
+				So(h.Blocks[i][j].Variant, ShouldEqual, category)
+			}
+		}
+	})
+}
+
+func Test_diffPairs(t *testing.T) {
+	Convey("Pair humans by name", t, func() {
+		s1 := &diffSource{names: []string{"a", "b", "c"}}
+		s2 := &diffSource{names: []string{"c", "a", "d"}}
+		So(diffPairs(s1, s2), ShouldResemble, []diffPair{{"a", "a"}, {"c", "c"}})
+
+		Convey("Always pair two single humans", func() {
+			s1 := &diffSource{names: []string{"a"}}
+			s2 := &diffSource{names: []string{"b"}}
+			So(diffPairs(s1, s2), ShouldResemble, []diffPair{{"a", "b"}})
+		})
+	})
+}
+
+func BenchmarkDrawFullSizeSquare(b *testing.B) {
+	for _, slotPixel := range []int{1, 2, 4} {
+		b.Run("slot-pixel="+base.ToStr(slotPixel), func(b *testing.B) {
+			r := benchRenderer(b, base.FULL_SIZE)
+			r.SlotPixel = slotPixel
+			r = r.fit(0, r.MaxColIdx)
+			m := r.initImage(1)
+			w, h := m.Bounds().Dx()/slotPixel, m.Bounds().Dy()/slotPixel
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.drawFullSizeSquare(m, i%16, i%w*slotPixel, i/w%h*slotPixel)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/annotate"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// Config represents configuration of Renderer.
+type Config struct {
+	Mode      base.Mode // SINGLE, FULL_SIZE, TRANSPARENT or DIFF.
+	SlotPixel int       // Pixels of width and height of a tile.
+	BoxNum    int       // Slots of width and height of a box, for FULL_SIZE and TRANSPARENT.
+	Border    int       // Pixels between boxes, for FULL_SIZE.
+	MaxColIdx int       // Max column index of FULL_SIZE, longer bands wrap into more rows.
+	// Color map of variants, default is base.Colors,
+	// or DefaultDiffColors in DIFF mode.
+	Colors *base.ColorMap
+	// Range of bands and positions to render, end index of -1
+	// means to fit humans being rendered.
+	base.Range
+	// Annotate draws band labels, position ticks and legend around image,
+	// not for TRANSPARENT.
+	Annotate bool
+}
+
+// Renderer renders humans into images without touching file system,
+// so it can be used by other Go programs.
+type Renderer struct {
+	Config
+}
+
+// NewRenderer validates given configuration and returns a new renderer.
+func NewRenderer(cfg Config) (*Renderer, error) {
+	switch {
+	case cfg.Mode != base.SINGLE && cfg.Mode != base.FULL_SIZE &&
+		cfg.Mode != base.TRANSPARENT && cfg.Mode != base.DIFF:
+		return nil, fmt.Errorf("unsupported mode: %v", cfg.Mode)
+	case cfg.SlotPixel < 1:
+		return nil, errors.New("slot pixel cannot be smaller than 1")
+	case cfg.StartBandIdx < 0:
+		return nil, errors.New("start band index cannot be smaller than 0")
+	case cfg.EndBandIdx >= 0 && cfg.StartBandIdx > cfg.EndBandIdx:
+		return nil, errors.New("start band index cannot be greater than end band index")
+	case cfg.Annotate && cfg.Mode == base.TRANSPARENT:
+		return nil, errors.New("annotation is not supported in transparent mode")
+	}
+
+	if cfg.Mode == base.FULL_SIZE || cfg.Mode == base.TRANSPARENT {
+		switch {
+		case cfg.BoxNum < 13:
+			return nil, errors.New("box number cannot be smaller than 13 in full size or transparent mode")
+		case cfg.StartBandIdx > 0:
+			return nil, errors.New("start band index is not supported in full size or transparent mode")
+		case cfg.Mode == base.FULL_SIZE && cfg.Border < 1:
+			return nil, errors.New("border cannot be smaller than 1 in full size mode")
+		case cfg.Mode == base.FULL_SIZE && cfg.MaxColIdx < 1:
+			return nil, errors.New("max column index cannot be smaller than 1 in full size mode")
+		}
+	}
+
+	if cfg.Colors == nil {
+		cfg.Colors = base.Colors
+		if cfg.Mode == base.DIFF {
+			cfg.Colors, _ = base.ParseColorMap(DefaultDiffColors)
+		}
+	} else if cfg.Mode == base.DIFF && len(cfg.Colors.Vars) < len(diffLabels) {
+		return nil, fmt.Errorf("color map needs at least %d colors in difference mode", len(diffLabels))
+	}
+	return &Renderer{cfg}, nil
+}
+
+// rendererOf returns renderer of given options with color map in use,
+// options are supposed to be validated and range adjusted.
+func rendererOf(opt base.Option) *Renderer {
+	return &Renderer{Config{
+		Mode:      opt.Mode,
+		SlotPixel: opt.SlotPixel,
+		BoxNum:    opt.BoxNum,
+		Border:    opt.Border,
+		MaxColIdx: opt.MaxColIdx,
+		Colors:    base.Colors,
+		Range:     *opt.Range,
+		Annotate:  opt.Annotate,
+	}}
+}
+
+// fit returns copy of renderer whose end indexes of -1 are
+// replaced by given max band and position indexes.
+// Bands only wrap into more rows in full size mode.
+func (r *Renderer) fit(maxBand, maxPos int) *Renderer {
+	fr := *r
+	if fr.EndBandIdx == -1 {
+		fr.EndBandIdx = maxBand
+	}
+	if fr.EndPosIdx == -1 {
+		fr.EndPosIdx = maxPos
+	}
+	if fr.Mode != base.FULL_SIZE && fr.MaxColIdx < fr.EndPosIdx {
+		fr.MaxColIdx = fr.EndPosIdx
+	}
+	return &fr
+}
+
+// fitHumans returns copy of renderer that fits given humans.
+func (r *Renderer) fitHumans(humans []*abv.Human) *Renderer {
+	maxBand, maxPos := 0, 0
+	for _, h := range humans {
+		if h.MaxBand > maxBand {
+			maxBand = h.MaxBand
+		}
+		if h.MaxPos > maxPos {
+			maxPos = h.MaxPos
+		}
+	}
+	return r.fit(maxBand, maxPos)
+}
+
+// Single renders a human in layout of mode 1, one row per band.
+// It returns data area when image is annotated.
+func (r *Renderer) Single(h *abv.Human) (*image.RGBA, *DataArea) {
+	r = r.fit(h.MaxBand, h.MaxPos)
+	m := r.initImage(r.EndBandIdx - r.StartBandIdx + 1)
+	drawUnrecognized := r.Colors.DrawUnrecognized()
+	for i := r.StartBandIdx; i <= r.EndBandIdx; i++ {
+		for j := 0; j <= r.EndPosIdx; j++ {
+			if b, ok := h.Blocks[i][j]; ok {
+				r.drawSingleSquare(m, int(b.Variant), j, i-r.StartBandIdx)
+			} else if drawUnrecognized && j < h.BandLength[i] {
+				r.drawSingleSquare(m, base.VAR_UNRECOGNIZE, j, i-r.StartBandIdx)
+			}
+		}
+	}
+
+	if !r.Annotate {
+		return m, nil
+	}
+	legend := annotate.VariantLegend(r.Colors)
+	if r.Mode == base.DIFF {
+		legend = diffLegend(r.Colors)
+	}
+	m, rect := r.annotateAbvImg(m, legend)
+	return m, newDataArea(rect)
+}
+
+// Diff renders categories of differences between tiles of two humans
+// in layout of mode 1. It returns data area when image is annotated.
+func (r *Renderer) Diff(h1, h2 *abv.Human) (*image.RGBA, *DataArea) {
+	return r.Single(diffHuman(h1, h2))
+}
+
+// FullSize renders humans in layout of mode 2, one slot per human in given order.
+// It returns data area when image is annotated.
+func (r *Renderer) FullSize(humans []*abv.Human) (*image.RGBA, *DataArea) {
+	r = r.fitHumans(humans)
+	bandLens, maxRows := r.fullSizeRows(humans)
+	totalRows := 0
+	for i := 0; i <= r.EndBandIdx; i++ {
+		totalRows += maxRows[i]
+	}
+
+	m := r.initImage(totalRows)
+	drawUnrecognized := r.Colors.DrawUnrecognized()
+	for slot, h := range humans {
+		offsetRow := 0
+		for i := 0; i <= r.EndBandIdx; i++ {
+			for j := 0; j < bandLens[slot][i]; j++ {
+				if b, ok := h.Blocks[i][j]; ok {
+					r.drawFullSizeTile(m, slot, offsetRow, j, int(b.Variant))
+				} else if drawUnrecognized {
+					r.drawFullSizeTile(m, slot, offsetRow, j, base.VAR_UNRECOGNIZE)
+				}
+			}
+			offsetRow += maxRows[i]
+		}
+	}
+
+	if !r.Annotate {
+		return m, nil
+	}
+	m, rect := r.annotateFullSizeImg(m, maxRows)
+	return m, newDataArea(rect)
+}
+
+// fullSizeRows returns band lengths of humans within range,
+// and max rows of each band in full size image.
+func (r *Renderer) fullSizeRows(humans []*abv.Human) ([]map[int]int, map[int]int) {
+	bandLens := make([]map[int]int, len(humans))
+	maxRows := make(map[int]int)
+	for slot, h := range humans {
+		bandLens[slot] = make(map[int]int, len(h.BandLength))
+		for i, l := range h.BandLength {
+			if l > r.EndPosIdx+1 {
+				l = r.EndPosIdx + 1
+			}
+			bandLens[slot][i] = l
+		}
+		r.updateMaxRows(maxRows, bandLens[slot])
+	}
+	return bandLens, maxRows
+}
+
+// Transparent renders a human in layout of mode 3, which is a transparent layer
+// to put on top of full size image.
+func (r *Renderer) Transparent(h *abv.Human) *image.RGBA {
+	r = r.fit(h.MaxBand, h.MaxPos)
+	m := r.initImage(r.EndBandIdx + 1)
+	for i := range h.Blocks {
+		for j, b := range h.Blocks[i] {
+			r.drawTransparentSquare(m, int(b.Variant),
+				j*(r.SlotPixel*r.BoxNum)+r.Border*j+(r.BoxNum-2)*r.SlotPixel,
+				i*(r.SlotPixel*r.BoxNum)+r.Border*i+(r.BoxNum-2)*r.SlotPixel)
+		}
+	}
+	return m
+}
+
+// Render renders given humans in configured mode. SINGLE and TRANSPARENT need
+// one human, DIFF needs two and FULL_SIZE needs at least one.
+func (r *Renderer) Render(humans ...*abv.Human) (image.Image, error) {
+	m, _, err := r.render(humans)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// render renders given humans in configured mode along with data area of image.
+func (r *Renderer) render(humans []*abv.Human) (*image.RGBA, *DataArea, error) {
+	if r.Mode != base.DIFF {
+		for _, h := range humans {
+			if err := checkVariants(r.Colors, h); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", h.Name, err)
+			}
+		}
+	}
+
+	switch r.Mode {
+	case base.SINGLE, base.TRANSPARENT:
+		if len(humans) != 1 {
+			return nil, nil, fmt.Errorf("mode %d needs 1 human but got %d", r.Mode, len(humans))
+		} else if r.Mode == base.TRANSPARENT {
+			return r.Transparent(humans[0]), nil, nil
+		}
+		m, area := r.Single(humans[0])
+		return m, area, nil
+	case base.DIFF:
+		if len(humans) != 2 {
+			return nil, nil, fmt.Errorf("mode %d needs 2 humans but got %d", r.Mode, len(humans))
+		}
+		m, area := r.Diff(humans[0], humans[1])
+		return m, area, nil
+	default:
+		if len(humans) == 0 {
+			return nil, nil, fmt.Errorf("mode %d needs at least 1 human", r.Mode)
+		}
+		m, area := r.FullSize(humans)
+		return m, area, nil
+	}
+}
+
+// RenderReaders parses abv data of a human from each reader within range,
+// and renders them in configured mode.
+func (r *Renderer) RenderReaders(rds ...io.Reader) (image.Image, error) {
+	humans := make([]*abv.Human, len(rds))
+	for i, rd := range rds {
+		h, err := abv.ParseReader(rd, false, &r.Range)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse human %d: %v", i, err)
+		}
+		humans[i] = h
+	}
+	return r.Render(humans...)
+}
+
+// Encode renders given humans in configured mode and writes image
+// to given writer in PNG format.
+func (r *Renderer) Encode(w io.Writer, humans ...*abv.Human) error {
+	m, err := r.Render(humans...)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, m)
+}
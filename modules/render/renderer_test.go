@@ -0,0 +1,155 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv/abvtest"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+func Test_Renderer(t *testing.T) {
+	base.ParseColorSpec("")
+	all := base.Range{EndBandIdx: -1, EndPosIdx: -1}
+	parse := func(data string) *abv.Human {
+		h, err := abv.ParseReader(strings.NewReader(data), false, &all)
+		So(err, ShouldBeNil)
+		return h
+	}
+
+	Convey("Validate configuration", t, func() {
+		_, err := NewRenderer(Config{Mode: base.HEATMAP, SlotPixel: 1})
+		So(err, ShouldNotBeNil)
+		_, err = NewRenderer(Config{Mode: base.SINGLE})
+		So(err, ShouldNotBeNil)
+		_, err = NewRenderer(Config{Mode: base.FULL_SIZE, SlotPixel: 1, BoxNum: 2, Border: 1, MaxColIdx: 1})
+		So(err, ShouldNotBeNil)
+		_, err = NewRenderer(Config{Mode: base.TRANSPARENT, SlotPixel: 1, BoxNum: 13, Annotate: true})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Render single image from reader", t, func() {
+		r, err := NewRenderer(Config{Mode: base.SINGLE, SlotPixel: 2, Range: all})
+		So(err, ShouldBeNil)
+		m, err := r.RenderReaders(strings.NewReader("hu1 0 .DE 1 E-"))
+		So(err, ShouldBeNil)
+		So(m.Bounds(), ShouldResemble, image.Rect(0, 0, 6, 4))
+		So(base.Colors.Index(m.At(0, 0)), ShouldEqual, 0)
+		So(base.Colors.Index(m.At(3, 1)), ShouldEqual, 1)
+		So(base.Colors.Index(m.At(5, 1)), ShouldEqual, 2)
+		So(base.Colors.Index(m.At(0, 2)), ShouldEqual, 2)
+		So(base.Colors.Index(m.At(2, 2)), ShouldEqual, base.VAR_UNRECOGNIZE)
+
+		_, err = r.Render(parse("hu1 0 ."), parse("hu2 0 ."))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Render difference with its own colors", t, func() {
+		r, err := NewRenderer(Config{Mode: base.DIFF, SlotPixel: 1, Range: all})
+		So(err, ShouldBeNil)
+		m, _ := r.Diff(parse("hu1 0 .D-"), parse("hu2 0 .E."))
+		So(m.Bounds(), ShouldResemble, image.Rect(0, 0, 3, 1))
+		So(r.Colors.Index(m.At(0, 0)), ShouldEqual, DIFF_SAME)
+		So(r.Colors.Index(m.At(1, 0)), ShouldEqual, DIFF_VARIANT)
+		So(r.Colors.Index(m.At(2, 0)), ShouldEqual, DIFF_ONE_UNRECOGNIZED)
+	})
+
+	Convey("Render full size image in slots", t, func() {
+		r, err := NewRenderer(Config{
+			Mode:      base.FULL_SIZE,
+			SlotPixel: 1,
+			BoxNum:    13,
+			Border:    1,
+			MaxColIdx: 1,
+			Range:     all,
+		})
+		So(err, ShouldBeNil)
+		m, area := r.FullSize([]*abv.Human{parse("hu1 0 .... 1 D"), parse("hu2 0 .DE. 1 E")})
+		So(area, ShouldBeNil)
+
+		// Band 0 wraps into 2 rows, so band 1 starts at row 2.
+		So(m.Bounds(), ShouldResemble, image.Rect(0, 0, 27, 41))
+		x, y := FullSizeTileXY(1, 1, 13, 1, 1, 0, 2)
+		So(base.Colors.Index(m.At(x, y)), ShouldEqual, 2)
+		x, y = FullSizeTileXY(1, 1, 13, 1, 0, 2, 0)
+		So(base.Colors.Index(m.At(x, y)), ShouldEqual, 1)
+		x, y = FullSizeTileXY(1, 1, 13, 1, 1, 2, 0)
+		So(base.Colors.Index(m.At(x, y)), ShouldEqual, 2)
+
+		buf := new(bytes.Buffer)
+		So(r.Encode(buf, parse("hu1 0 ...")), ShouldBeNil)
+		_, err = png.Decode(buf)
+		So(err, ShouldBeNil)
+	})
+}
+
+// benchHumans returns given number of synthetic humans of a few bands.
+func benchHumans(b *testing.B, n int) []*abv.Human {
+	cfg := abvtest.DefaultConfig
+	cfg.Humans, cfg.Bands, cfg.BandSize = n, 4, 1000
+	g, err := abvtest.New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	humans := make([]*abv.Human, n)
+	for i := range humans {
+		if humans[i], err = g.Human(i); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return humans
+}
+
+// benchRenderer returns renderer of given mode in layout of 100 columns,
+// so full size image of a box is about 3000 * 1000.
+func benchRenderer(b *testing.B, mode base.Mode) *Renderer {
+	base.ParseColorSpec("")
+	r, err := NewRenderer(Config{
+		Mode:      mode,
+		SlotPixel: 2,
+		BoxNum:    13,
+		Border:    2,
+		MaxColIdx: 99,
+		Range:     base.Range{EndBandIdx: -1, EndPosIdx: -1},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return r
+}
+
+func BenchmarkRenderer_Single(b *testing.B) {
+	r := benchRenderer(b, base.SINGLE)
+	h := benchHumans(b, 1)[0]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Single(h)
+	}
+}
+
+func BenchmarkRenderer_FullSize(b *testing.B) {
+	r := benchRenderer(b, base.FULL_SIZE)
+	humans := benchHumans(b, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.FullSize(humans)
+	}
+}
+
+func BenchmarkEncodePNG(b *testing.B) {
+	m, _ := benchRenderer(b, base.FULL_SIZE).FullSize(benchHumans(b, 16))
+	b.SetBytes(int64(len(m.Pix)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := png.Encode(ioutil.Discard, m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
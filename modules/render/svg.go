@@ -0,0 +1,104 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+)
+
+// svgRun represents consecutive tiles of the same variant in a row.
+type svgRun struct {
+	x, y, width, size int
+	human             string
+	band, start, end  int
+	variant           int
+}
+
+// svgCanvas writes tiles as rectangles of SVG document, consecutive tiles
+// of the same variant in a row are merged into one rectangle.
+type svgCanvas struct {
+	w       *bufio.Writer
+	pending *svgRun
+}
+
+// newSvgCanvas writes header and background of SVG document of given size,
+// input hash is recorded in root element when it is not empty.
+func newSvgCanvas(w io.Writer, width, height int, hash string) *svgCanvas {
+	c := &svgCanvas{w: bufio.NewWriter(w)}
+	attr := ""
+	if len(hash) > 0 {
+		attr = fmt.Sprintf(` data-input-hash="%s"`, hash)
+	}
+	fmt.Fprintf(c.w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+		`viewBox="0 0 %d %d" shape-rendering="crispEdges"%s>`+"\n", width, height, width, height, attr)
+	fmt.Fprintf(c.w, `<rect width="%d" height="%d" %s/>`+"\n", width, height, svgFill(base.Colors.Background))
+	return c
+}
+
+// svgFill returns fill attributes of given color.
+func svgFill(c color.NRGBA) string {
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A < 255 {
+		fill += fmt.Sprintf(` fill-opacity="%.3g"`, float64(c.A)/255)
+	}
+	return fill
+}
+
+// tile draws a square tile of human at given pixel, empty human name means
+// image of single human.
+func (c *svgCanvas) tile(x, y, size int, human string, band, pos, variant int) {
+	if p := c.pending; p != nil && p.y == y && p.x+p.width == x && p.size == size &&
+		p.human == human && p.band == band && p.end+1 == pos && p.variant == variant {
+		p.width += size
+		p.end = pos
+		return
+	}
+
+	c.flush()
+	c.pending = &svgRun{x, y, size, size, human, band, pos, pos, variant}
+}
+
+// flush writes pending rectangle.
+func (c *svgCanvas) flush() {
+	p := c.pending
+	if p == nil {
+		return
+	}
+	c.pending = nil
+
+	pos := base.ToStr(p.start)
+	if p.end > p.start {
+		pos += "-" + base.ToStr(p.end)
+	}
+	variant := base.ToStr(p.variant)
+	switch p.variant {
+	case base.VAR_POUND:
+		variant = "#"
+	case base.VAR_UNRECOGNIZE:
+		variant = "-"
+	}
+	band := base.Int2HexStr(p.band)
+
+	fmt.Fprintf(c.w, `<rect x="%d" y="%d" width="%d" height="%d" %s `,
+		p.x, p.y, p.width, p.size, svgFill(base.Colors.Color(p.variant)))
+	title := fmt.Sprintf("band %s, pos %s, variant %s", band, pos, variant)
+	if len(p.human) > 0 {
+		human := html.EscapeString(p.human)
+		fmt.Fprintf(c.w, `data-human="%s" `, human)
+		title = human + ": " + title
+	}
+	fmt.Fprintf(c.w, `data-band="%s" data-pos="%s" data-variant="%s"><title>%s</title></rect>`+"\n",
+		band, pos, variant, title)
+}
+
+// close writes end of SVG document and flushes all data,
+// but does not close underlying writer.
+func (c *svgCanvas) close() error {
+	c.flush()
+	c.w.WriteString("</svg>\n")
+	return c.w.Flush()
+}
@@ -0,0 +1,164 @@
+package reverse
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/render"
+)
+
+// imgPrefixes are prefixes of names of images that can be reversed,
+// which are single images, full size images and transparent layers.
+var imgPrefixes = []string{"SI_", "FS_", "TL_"}
+
+// findImgs returns images that can be reversed in given directory.
+func findImgs(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	imgs := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".png") {
+			continue
+		}
+		for _, prefix := range imgPrefixes {
+			if strings.HasPrefix(fi.Name(), prefix) {
+				imgs = append(imgs, path.Join(dir, fi.Name()))
+				break
+			}
+		}
+	}
+	return imgs, nil
+}
+
+// abvNames returns paths of abv files that are reversed from given image.
+func abvNames(opt base.Option, img string, p *render.Profile) []string {
+	if p.Type != base.FULL_SIZE {
+		return []string{abvPath(opt, img, p, p.Name)}
+	}
+	names := make([]string, len(p.Humans))
+	for i, h := range p.Humans {
+		names[i] = abvPath(opt, img, p, h.Name)
+	}
+	return names
+}
+
+// reverseDir reverses all images in directory of opt.ReversePath by -jobs workers,
+// images of other modes are skipped when opt.Mode is not 0. Images whose abv files
+// would overwrite ones of previous images fail.
+func reverseDir(opt base.Option) error {
+	imgs, err := findImgs(opt.ReversePath)
+	if err != nil {
+		return fmt.Errorf("fail to list images: %v", err)
+	} else if len(imgs) == 0 {
+		return fmt.Errorf("no image to reverse in %s", opt.ReversePath)
+	}
+
+	// Load profiles first to infer modes and detect collisions of abv files.
+	profiles := make([]*render.Profile, len(imgs))
+	errs := make([]error, len(imgs))
+	var failed int32
+	owners := make(map[string]string)
+	for i, img := range imgs {
+		p, err := loadProfile(img)
+		if err != nil {
+			errs[i], failed = err, 1
+			continue
+		}
+		mode, err := modeOf(p)
+		if err != nil {
+			errs[i], failed = err, 1
+			continue
+		} else if opt.Mode != 0 && opt.Mode != mode {
+			log.Debug("Skip image of mode %d: %s", p.Type, img)
+			continue
+		}
+
+		names := abvNames(opt, img, p)
+		for _, name := range names {
+			if owner, ok := owners[name]; ok {
+				errs[i], failed = fmt.Errorf("abv file %s is also reversed from %s", name, owner), 1
+				break
+			}
+		}
+		if errs[i] != nil {
+			continue
+		}
+		for _, name := range names {
+			owners[name] = img
+		}
+		profiles[i] = p
+	}
+
+	jobs := opt.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if errs[i] = reverseImg(opt, imgs[i], profiles[i]); errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	// Stop at first failure unless keeping going.
+	started := make([]bool, len(imgs))
+	for i, p := range profiles {
+		if p == nil {
+			continue
+		} else if !opt.KeepGoing && atomic.LoadInt32(&failed) == 1 {
+			break
+		}
+		started[i] = true
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	// Summarize in order of images.
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	var firstErr error
+	reversed, skipped := 0, 0
+	for i, img := range imgs {
+		err := errs[i]
+		switch {
+		case err == nil && started[i]:
+			reversed++
+			continue
+		case err == nil:
+			skipped++
+			continue
+		}
+
+		if be, ok := err.(*base.BatchError); ok {
+			// Some humans of full size image have been skipped.
+			for _, f := range be.Failures {
+				batch.Failures = append(batch.Failures, base.Failure{Name: img + ": " + f.Name, Err: f.Err})
+			}
+		} else if err = batch.Fail(img, err); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	log.Info("Reversed %d image(s) in %s, %d failed, %d skipped",
+		reversed, opt.ReversePath, len(imgs)-reversed-skipped, skipped)
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return batch.Err()
+}
@@ -0,0 +1,301 @@
+package reverse
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/render"
+)
+
+// Reverse reverses image back to abv file(s) by profile saved along with it,
+// or embedded in PNG image when there is no profile directory. Image that does
+// not match its profile is refused, and mode is inferred from profile when
+// opt.Mode is 0. All images in directory are reversed in parallel when
+// opt.ReversePath is a directory. When opt.KeepGoing is true, images and humans
+// of full size image that fail are skipped and returned together as *base.BatchError.
+func Reverse(opt base.Option) error {
+	if len(opt.AbvDir) > 0 {
+		if err := os.MkdirAll(opt.AbvDir, os.ModePerm); err != nil {
+			return fmt.Errorf("fail to create abv directory: %v", err)
+		}
+	}
+
+	if base.IsDir(opt.ReversePath) {
+		return reverseDir(opt)
+	} else if !base.IsFile(opt.ReversePath) {
+		return fmt.Errorf("given image does not exist or not a file: %s", opt.ReversePath)
+	}
+
+	p, err := loadProfile(opt.ReversePath)
+	if err != nil {
+		return err
+	}
+	return reverseImg(opt, opt.ReversePath, p)
+}
+
+// loadProfile loads profile of given image from its profile directory,
+// or from image itself when there is no profile directory.
+func loadProfile(img string) (*render.Profile, error) {
+	profDir := strings.TrimSuffix(img, ".png")
+	if base.IsDir(profDir) {
+		p, err := render.LoadProfile(profDir)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load profile(%s): %v", profDir, err)
+		}
+		return p, nil
+	}
+
+	p, err := render.LoadImageProfile(img)
+	if err != nil {
+		return nil, fmt.Errorf("given image has neither profile directory(%s) nor embedded profile: %v", profDir, err)
+	}
+	return p, nil
+}
+
+// modeOf returns mode to reverse image of given profile in,
+// difference image is reversed as single image.
+func modeOf(p *render.Profile) (base.Mode, error) {
+	switch p.Type {
+	case base.SINGLE, base.DIFF:
+		return base.SINGLE, nil
+	case base.FULL_SIZE, base.TRANSPARENT:
+		return p.Type, nil
+	}
+	return 0, fmt.Errorf("image of mode %d cannot be reversed", p.Type)
+}
+
+// abvPath returns path of abv file of given human reversed from given image.
+// It is in -abv-dir when given, otherwise abv file of single image or transparent
+// layer is next to image, and humans of full size image are in work directory.
+func abvPath(opt base.Option, img string, p *render.Profile, name string) string {
+	switch {
+	case len(opt.AbvDir) > 0:
+		return path.Join(opt.AbvDir, name+".abv")
+	case p.Type == base.FULL_SIZE:
+		return name + ".abv"
+	}
+	return strings.TrimSuffix(img, ".png") + ".abv"
+}
+
+// reverseImg reverses given image by its profile.
+func reverseImg(opt base.Option, img string, p *render.Profile) error {
+	mode, err := modeOf(p)
+	if err != nil {
+		return err
+	} else if opt.Mode != 0 && opt.Mode != mode {
+		return fmt.Errorf("image of mode %d cannot be reversed in mode %d", p.Type, opt.Mode)
+	} else if err = p.Match(img); err != nil {
+		return fmt.Errorf("image(%s) does not match its profile: %v", img, err)
+	}
+
+	cm, err := p.ColorMap()
+	if err != nil {
+		return fmt.Errorf("fail to parse color map: %v", err)
+	}
+	// Old default color map has duplicate colors, only affected variants cannot be recovered.
+	if err = cm.Validate(); err != nil {
+		log.Warn("Color map is not fully reversible: %v", err)
+	}
+
+	// Decode image file.
+	fr, err := os.Open(img)
+	if err != nil {
+		return fmt.Errorf("fail to open image(%s): %v", img, err)
+	}
+	defer fr.Close()
+
+	m, _, err := image.Decode(fr)
+	if err != nil {
+		return fmt.Errorf("fail to decode image(%s): %v", img, err)
+	}
+	m = p.DataArea.Image(m)
+
+	log.Info("Start reversing image: %s", path.Base(img))
+	switch mode {
+	case base.SINGLE:
+		return reverseSingleImg(abvPath(opt, img, p, p.Name), p, cm, m)
+	case base.TRANSPARENT:
+		return reverseTransparentImg(abvPath(opt, img, p, p.Name), p, cm, m)
+	}
+
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	if err = reverseFullSizeImg(opt, img, p, cm, m, batch); err != nil {
+		return err
+	}
+	return batch.Err()
+}
+
+// tileChar returns character of tile of given color,
+// it returns false when color is not in color map.
+func tileChar(cm *base.ColorMap, c color.Color) (byte, bool) {
+	idx := cm.Index(c)
+	switch {
+	case idx == base.VAR_UNRECOGNIZE:
+		return '-', true
+	case idx == base.VAR_POUND:
+		return '#', true
+	case idx < 0 || idx >= len(abv.EncodeStd):
+		return 0, false
+	}
+	return abv.EncodeStd[idx], true
+}
+
+// writeAbv saves bands of human of given name to abv file.
+func writeAbv(name, human string, bands []*abv.Band) error {
+	fw, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("fail to create abv file(%s): %v", name, err)
+	}
+	defer fw.Close()
+
+	w := abv.NewWriter(fw, "\""+human+"\"")
+	for _, b := range bands {
+		w.WriteBand(b)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("fail to save abv file: %v", err)
+	}
+	return nil
+}
+
+// decodeSingle accepts data area of single image and its profile,
+// and returns bands of human in image.
+func decodeSingle(ap *render.Profile, cm *base.ColorMap, m image.Image) ([]*abv.Band, error) {
+	bounds := m.Bounds()
+	bands := make([]*abv.Band, 0, bounds.Dy()/ap.SlotPixel)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += ap.SlotPixel {
+		bandIdx := (y-bounds.Min.Y)/ap.SlotPixel + ap.StartBand
+		if bandIdx >= len(ap.BandLen) {
+			return nil, errors.New("invalid profile information: band index out of bound")
+		}
+
+		b := &abv.Band{Index: bandIdx, Data: make([]byte, 0, ap.BandLen[bandIdx])}
+		for pos := 0; pos < ap.BandLen[bandIdx]; pos++ {
+			// Tiles out of image are lost.
+			x := bounds.Min.X + pos*ap.SlotPixel
+			if x >= bounds.Max.X {
+				break
+			}
+			char, ok := tileChar(cm, m.At(x, y))
+			if !ok {
+				return nil, fmt.Errorf("color does not recognize at (%d, %d)", x, y)
+			}
+			b.Data = append(b.Data, char)
+		}
+		bands = append(bands, b)
+	}
+	return bands, nil
+}
+
+// reverseSingleImg accepts data area of single image and its profile
+// to reverse it to abv raw data file of given name.
+func reverseSingleImg(name string, ap *render.Profile, cm *base.ColorMap, m image.Image) error {
+	bands, err := decodeSingle(ap, cm, m)
+	if err != nil {
+		return err
+	}
+	return writeAbv(name, ap.Name, bands)
+}
+
+// decodeTransparent accepts transparent layer and its profile, and returns
+// bands of human in image. Tiles without color are unrecognized.
+func decodeTransparent(p *render.Profile, cm *base.ColorMap, m image.Image) ([]*abv.Band, error) {
+	// Variant is drawn near bottom-right corner of box of every tile.
+	unit := p.SlotPixel*p.BoxNum + p.Border
+	offset := (p.BoxNum - 2) * p.SlotPixel
+	bands := make([]*abv.Band, 0, len(p.BandLen))
+	for bandIdx, bandLen := range p.BandLen {
+		if bandLen == 0 {
+			continue
+		} else if bandIdx > p.EndBand {
+			return nil, errors.New("invalid profile information: band index out of bound")
+		}
+		if p.EndPos >= 0 && bandLen > p.EndPos+1 {
+			bandLen = p.EndPos + 1
+		}
+
+		b := &abv.Band{Index: bandIdx, Data: make([]byte, bandLen)}
+		for pos := range b.Data {
+			x, y := pos*unit+offset, bandIdx*unit+offset
+			c := m.At(x, y)
+			if _, _, _, a := c.RGBA(); a == 0 {
+				b.Data[pos] = '-'
+				continue
+			}
+			char, ok := tileChar(cm, c)
+			if !ok {
+				return nil, fmt.Errorf("color does not recognize at (%d, %d)", x, y)
+			}
+			b.Data[pos] = char
+		}
+		bands = append(bands, b)
+	}
+	return bands, nil
+}
+
+// reverseTransparentImg accepts transparent layer and its profile to reverse it
+// to abv raw data file of given name.
+func reverseTransparentImg(name string, p *render.Profile, cm *base.ColorMap, m image.Image) error {
+	bands, err := decodeTransparent(p, cm, m)
+	if err != nil {
+		return err
+	}
+	return writeAbv(name, p.Name, bands)
+}
+
+// reverseFullSizeImg accepts data area of full size image and its profile
+// to reverse it to abv raw data files.
+func reverseFullSizeImg(opt base.Option, img string, fsp *render.Profile, cm *base.ColorMap,
+	m image.Image, batch *base.Batch) error {
+	offsets := fsp.BandOffsets()
+
+	// Humans are listed in order of slots.
+	for slot, h := range fsp.Humans {
+		bands, err := decodeSlot(fsp, cm, m, offsets, slot, h)
+		if err == nil {
+			err = writeAbv(abvPath(opt, img, fsp, h.Name), h.Name, bands)
+		}
+		if err != nil {
+			if err = batch.Fail(h.Name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("[%d] %s", slot, h.Name)
+	}
+	return nil
+}
+
+// decodeSlot returns bands of human in given slot of full size image.
+func decodeSlot(fsp *render.Profile, cm *base.ColorMap, m image.Image,
+	offsets []int, slot int, h render.HumanProfile) ([]*abv.Band, error) {
+	bands := make([]*abv.Band, 0, len(h.BandLen))
+	for bandIdx, bandLen := range h.BandLen {
+		if bandLen == 0 {
+			continue
+		} else if bandIdx >= len(offsets) {
+			return nil, errors.New("invalid profile information: band index out of bound")
+		}
+
+		b := &abv.Band{Index: bandIdx, Data: make([]byte, bandLen)}
+		for pos := range b.Data {
+			x, y := render.FullSizeTileXY(fsp.MaxCol, fsp.SlotPixel, fsp.BoxNum, fsp.Border,
+				slot, offsets[bandIdx], pos)
+			char, ok := tileChar(cm, m.At(x, y))
+			if !ok {
+				return nil, fmt.Errorf("color does not recognize at (%d, %d)", x, y)
+			}
+			b.Data[pos] = char
+		}
+		bands = append(bands, b)
+	}
+	return bands, nil
+}
@@ -0,0 +1,81 @@
+package reverse
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/render"
+)
+
+func Test_ReverseDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base.ParseColorSpec("")
+	name := path.Join(dir, "hu1.abv")
+	if err = ioutil.WriteFile(name, []byte("hu1 0 .DE# 1 E-"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gen := func(mode base.Mode) error {
+		return render.Generate(base.Option{
+			Mode:      mode,
+			ImgDir:    path.Join(dir, "imgs"),
+			AbvPath:   name,
+			Range:     &base.Range{EndBandIdx: 1, EndPosIdx: 3},
+			MaxColIdx: 3999,
+			BoxNum:    13,
+			SlotPixel: 1,
+			Border:    2,
+			Format:    render.FORMAT_PNG,
+		})
+	}
+	want, err := abv.Parse(name, false, &base.Range{EndBandIdx: -1, EndPosIdx: -1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Reverse images of inferred modes in directory", t, func() {
+		So(gen(base.SINGLE), ShouldBeNil)
+		So(gen(base.TRANSPARENT), ShouldBeNil)
+
+		for _, mode := range []base.Mode{base.SINGLE, base.TRANSPARENT} {
+			abvDir := path.Join(dir, "abv", base.ToStr(int(mode)))
+			So(Reverse(base.Option{
+				Mode:        mode,
+				ReversePath: path.Join(dir, "imgs"),
+				AbvDir:      abvDir,
+				Jobs:        2,
+			}), ShouldBeNil)
+
+			h, err := abv.Parse(path.Join(abvDir, "hu1.abv"), false,
+				&base.Range{EndBandIdx: -1, EndPosIdx: -1}, nil)
+			So(err, ShouldBeNil)
+			So(h.BandLength, ShouldResemble, want.BandLength)
+			So(len(h.Blocks[0]), ShouldEqual, len(want.Blocks[0]))
+			for pos, b := range want.Blocks[0] {
+				So(h.Blocks[0][pos].Variant, ShouldEqual, b.Variant)
+			}
+		}
+	})
+
+	Convey("Images that reverse to the same abv file fail", t, func() {
+		err := Reverse(base.Option{
+			ReversePath: path.Join(dir, "imgs"),
+			AbvDir:      path.Join(dir, "abv", "all"),
+			KeepGoing:   true,
+		})
+		So(err, ShouldNotBeNil)
+		be, ok := err.(*base.BatchError)
+		So(ok, ShouldBeTrue)
+		So(len(be.Failures), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,203 @@
+package reverse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"path"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/render"
+)
+
+// VerifyModes are modes that images can be reversed back to humans in.
+var VerifyModes = []base.Mode{base.SINGLE, base.FULL_SIZE, base.TRANSPARENT}
+
+// decode reverses data area of image of given profile back to human,
+// full size image is supposed to have only one human.
+func decode(p *render.Profile, m image.Image) (*abv.Human, error) {
+	cm, err := p.ColorMap()
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse color map: %v", err)
+	}
+	m = p.DataArea.Image(m)
+
+	var bands []*abv.Band
+	name := p.Name
+	switch p.Type {
+	case base.SINGLE:
+		bands, err = decodeSingle(p, cm, m)
+	case base.TRANSPARENT:
+		bands, err = decodeTransparent(p, cm, m)
+	case base.FULL_SIZE:
+		if len(p.Humans) != 1 {
+			return nil, fmt.Errorf("expect 1 human in full size image but got %d", len(p.Humans))
+		}
+		name = p.Humans[0].Name
+		bands, err = decodeSlot(p, cm, m, p.BandOffsets(), 0, p.Humans[0])
+	default:
+		return nil, fmt.Errorf("image of mode %d cannot be reversed", p.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse bands as what reverse saves to abv file.
+	buf := new(bytes.Buffer)
+	w := abv.NewWriter(buf, "\""+name+"\"")
+	for _, b := range bands {
+		w.WriteBand(b)
+	}
+	w.Close()
+	h, err := abv.ParseReader(buf, false, &base.Range{EndBandIdx: -1, EndPosIdx: -1})
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse reversed abv data: %v", err)
+	}
+	h.Name = name
+	return h, nil
+}
+
+// tileOf returns character of tile of human at given band and position.
+func tileOf(h *abv.Human, band, pos int) byte {
+	b, ok := h.Blocks[band][pos]
+	switch {
+	case !ok:
+		return '-'
+	case b.Variant == abv.TILE_POUND:
+		return '#'
+	case int(b.Variant) < len(abv.EncodeStd):
+		return abv.EncodeStd[b.Variant]
+	}
+	return '?'
+}
+
+// diffTiles returns problems of tiles and band lengths of human
+// that are not the same after reversed.
+func diffTiles(h, reversed *abv.Human) []*abv.Problem {
+	maxBand := h.MaxBand
+	if reversed.MaxBand > maxBand {
+		maxBand = reversed.MaxBand
+	}
+
+	var ps []*abv.Problem
+	for i := 0; i <= maxBand; i++ {
+		want, got := h.BandLength[i], reversed.BandLength[i]
+		if want != got {
+			ps = append(ps, &abv.Problem{Band: i, Col: -1,
+				Desc: fmt.Sprintf("%d tile(s) are reversed as %d", want, got)})
+		}
+		if got > want {
+			got = want
+		}
+		for j := 0; j < got; j++ {
+			if want, got := tileOf(h, i, j), tileOf(reversed, i, j); want != got {
+				ps = append(ps, &abv.Problem{Band: i, Col: j,
+					Desc: fmt.Sprintf("tile '%c' is reversed as '%c'", want, got)})
+			}
+		}
+	}
+	return ps
+}
+
+// RoundTrip renders given human by renderer in memory, reverses image back
+// and returns problems of tiles that are lost in image. Human has to be named,
+// because name is recorded in profile.
+func RoundTrip(r *render.Renderer, h *abv.Human) ([]*abv.Problem, error) {
+	m, p, err := r.RenderProfile(h)
+	if err != nil {
+		return nil, fmt.Errorf("fail to render: %v", err)
+	} else if err = p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile: %v", err)
+	}
+
+	reversed, err := decode(p, m)
+	if err != nil {
+		return nil, fmt.Errorf("fail to reverse: %v", err)
+	}
+	return diffTiles(h, reversed), nil
+}
+
+// Verify renders each abv file in memory in given mode, or in all of VerifyModes
+// when opt.Mode is 0, reverses image back and compares tile by tile. It fails when
+// any tile is lost in image. When opt.KeepGoing is true, abv files that fail to read
+// are skipped and returned together as *base.BatchError.
+func Verify(opt base.Option) error {
+	modes := VerifyModes
+	if opt.Mode != 0 {
+		modes = []base.Mode{opt.Mode}
+	}
+	if abv.IsCohortFile(opt.AbvPath) {
+		return errors.New("cohort file is not supported")
+	}
+
+	renderers := make([]*render.Renderer, len(modes))
+	for i, mode := range modes {
+		if mode != base.SINGLE && mode != base.FULL_SIZE && mode != base.TRANSPARENT {
+			return fmt.Errorf("image of mode %d cannot be reversed to humans", mode)
+		}
+		var err error
+		renderers[i], err = render.NewRenderer(render.Config{
+			Mode:      mode,
+			SlotPixel: opt.SlotPixel,
+			BoxNum:    opt.BoxNum,
+			Border:    opt.Border,
+			MaxColIdx: opt.MaxColIdx,
+			Colors:    base.Colors,
+			Range:     *opt.Range,
+			Annotate:  opt.Annotate && mode != base.TRANSPARENT,
+		})
+		if err != nil {
+			return fmt.Errorf("mode %d: %v", mode, err)
+		}
+	}
+
+	names, err := base.GetFileListBySuffix(opt.AbvPath, ".abv")
+	if err != nil {
+		return fmt.Errorf("fail to get abv list: %v", err)
+	}
+
+	batch := &base.Batch{KeepGoing: opt.KeepGoing}
+	lossy := 0
+	for i, name := range names {
+		h, err := abv.Parse(name, false, opt.Range, nil)
+		if err != nil {
+			if err = batch.Fail(name, fmt.Errorf("fail to parse abv file: %v", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		h.Name = path.Base(name)
+
+		lost := 0
+		for j, r := range renderers {
+			ps, err := RoundTrip(r, h)
+			if err != nil {
+				return fmt.Errorf("%s: mode %d: %v", name, modes[j], err)
+			}
+			for k, p := range ps {
+				if opt.MaxProblems > 0 && k == opt.MaxProblems {
+					log.Error("%s: mode %d: %d more problem(s) omitted", name, modes[j], len(ps)-k)
+					break
+				}
+				log.Error("%s: mode %d: %v", name, modes[j], p)
+			}
+			lost += len(ps)
+		}
+
+		if lost > 0 {
+			lossy++
+			log.Error("[%d] %s: %d problem(s)", i, name, lost)
+			continue
+		}
+		log.Info("[%d] %s: OK", i, name)
+	}
+
+	if lossy > 0 {
+		return fmt.Errorf("%d of %d abv file(s) are not reversible", lossy, len(names))
+	}
+	log.Info("%d abv file(s) are reversible in mode %v", len(names)-len(batch.Failures), modes)
+	return batch.Err()
+}
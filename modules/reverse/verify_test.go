@@ -0,0 +1,170 @@
+package reverse
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/abv/abvtest"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/base"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/render"
+)
+
+// synthHumans returns generator of given number of synthetic humans
+// of random bands and tiles of all variants.
+func synthHumans(rnd *rand.Rand, humans int) *abvtest.Generator {
+	g, err := abvtest.New(abvtest.Config{
+		Humans:     humans,
+		Bands:      1 + rnd.Intn(6),
+		BandSize:   20,
+		LenJitter:  1,
+		Variants:   len(abv.EncodeStd),
+		Skew:       1.1,
+		Divergence: 0.5,
+		NoCallRate: 0.1,
+		PoundRate:  0.05,
+		Seed:       rnd.Int63(),
+		Prefix:     "hu",
+	})
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// synthConfig returns random layout of given mode.
+func synthConfig(rnd *rand.Rand, mode base.Mode) render.Config {
+	cfg := render.Config{
+		Mode:      mode,
+		SlotPixel: 1 + rnd.Intn(3),
+		BoxNum:    13 + rnd.Intn(3),
+		Border:    1 + rnd.Intn(3),
+		MaxColIdx: 1 + rnd.Intn(20),
+		Range:     base.Range{EndBandIdx: -1, EndPosIdx: -1},
+		Annotate:  mode != base.TRANSPARENT && rnd.Intn(2) == 0,
+	}
+	if rnd.Intn(2) == 0 {
+		cfg.EndPosIdx = rnd.Intn(50)
+	}
+	if mode == base.SINGLE && rnd.Intn(2) == 0 {
+		cfg.StartBandIdx = rnd.Intn(3)
+		cfg.EndBandIdx = cfg.StartBandIdx + rnd.Intn(6)
+	}
+	return cfg
+}
+
+func Test_RoundTrip(t *testing.T) {
+	base.ParseColorSpec("")
+	rnd := rand.New(rand.NewSource(1))
+
+	Convey("Synthetic humans survive round trip in every mode", t, func() {
+		for i := 0; i < 300; i++ {
+			cfg := synthConfig(rnd, VerifyModes[i%len(VerifyModes)])
+			r, err := render.NewRenderer(cfg)
+			So(err, ShouldBeNil)
+
+			g := synthHumans(rnd, 1)
+			h, err := abv.ParseReader(g.Reader(0), false, &cfg.Range)
+			So(err, ShouldBeNil)
+			h.Name = g.Name(0) + ".abv"
+
+			ps, err := RoundTrip(r, h)
+			So(err, ShouldBeNil)
+			if len(ps) > 0 {
+				t.Logf("%s in %+v: %v", g.Data(0), cfg, ps[0])
+			}
+			So(ps, ShouldBeEmpty)
+		}
+	})
+
+	Convey("Variants beyond color map survive by overflow policy", t, func() {
+		cm, err := base.ParseColorMap("#000000\n#ff0000\n")
+		So(err, ShouldBeNil)
+		roundTrip := func(policy string) ([]*abv.Problem, error) {
+			cm, err := cm.WithOverflow(policy)
+			So(err, ShouldBeNil)
+			r, err := render.NewRenderer(render.Config{
+				Mode:      base.SINGLE,
+				SlotPixel: 1,
+				Colors:    cm,
+				Range:     base.Range{EndBandIdx: -1, EndPosIdx: -1},
+			})
+			So(err, ShouldBeNil)
+
+			h, err := abv.ParseReader(bytes.NewBufferString("hu1 0 .DF 1 G"), false, &r.Range)
+			So(err, ShouldBeNil)
+			h.Name = "hu1"
+			return RoundTrip(r, h)
+		}
+
+		for _, policy := range []string{base.OVERFLOW_EXTEND, base.OVERFLOW_ALPHA} {
+			ps, err := roundTrip(policy)
+			So(err, ShouldBeNil)
+			So(ps, ShouldBeEmpty)
+		}
+
+		_, err = roundTrip(base.OVERFLOW_ERROR)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "band 0, position 2: variant 3 is beyond 2 color(s) of color map")
+
+		// Variants are drawn in color of the last one by images of older versions.
+		ps, err := roundTrip(base.OVERFLOW_CLAMP)
+		So(err, ShouldBeNil)
+		So(len(ps), ShouldEqual, 2)
+		So(ps[0].Error(), ShouldEqual, "band 0, column 2: tile 'F' is reversed as 'D'")
+		So(ps[1].Error(), ShouldEqual, "band 1, column 0: tile 'G' is reversed as 'D'")
+	})
+}
+
+func Test_Verify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base.ParseColorSpec("")
+	if _, err = synthHumans(rand.New(rand.NewSource(2)), 3).WriteFiles(dir, "text", false); err != nil {
+		t.Fatal(err)
+	}
+	opt := base.Option{
+		AbvPath:   dir,
+		Range:     &base.Range{EndBandIdx: 9, EndPosIdx: 49},
+		MaxColIdx: 9,
+		BoxNum:    13,
+		SlotPixel: 2,
+		Border:    1,
+		// Keep log of lost tiles short.
+		MaxProblems: 1,
+	}
+
+	Convey("Verify abv files in all modes", t, func() {
+		So(Verify(opt), ShouldBeNil)
+
+		Convey("Extend short color map", func() {
+			base.Colors, err = base.ParseColorMap("#000000\n#ff0000\n")
+			So(err, ShouldBeNil)
+			defer base.ParseColorSpec("")
+			So(Verify(opt), ShouldBeNil)
+		})
+
+		Convey("Fail when tiles are lost", func() {
+			cm, err := base.ParseColorMap("#000000\n#ff0000\n")
+			So(err, ShouldBeNil)
+			base.Colors, err = cm.WithOverflow(base.OVERFLOW_CLAMP)
+			So(err, ShouldBeNil)
+			defer base.ParseColorSpec("")
+			So(Verify(opt), ShouldNotBeNil)
+		})
+
+		Convey("Refuse modes that cannot be reversed to humans", func() {
+			opt.Mode = base.DIFF
+			So(Verify(opt), ShouldNotBeNil)
+		})
+	})
+}
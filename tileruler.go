@@ -7,6 +7,7 @@ import (
 
 	"github.com/curoverse/lightning/experimental/tileruler/cmd"
 	"github.com/curoverse/lightning/experimental/tileruler/modules/cli"
+	"github.com/curoverse/lightning/experimental/tileruler/modules/log"
 )
 
 const (
@@ -26,13 +27,26 @@ func main() {
 	app.Commands = []cli.Command{
 		cmd.CmdGen,
 		cmd.CmdReverse,
+		cmd.CmdVerify,
 		cmd.CmdCompare,
 		cmd.CmdStat,
 		cmd.CmdPlot,
 		cmd.CmdAbv,
+		cmd.CmdQc,
+		cmd.CmdValidate,
+		cmd.CmdIndex,
+		cmd.CmdConvert,
+		cmd.CmdMerge,
+		cmd.CmdConsensus,
+		cmd.CmdSynth,
 	}
 	app.Flags = append(app.Flags, []cli.Flag{
 		cli.BoolFlag{"noterm, n", "disable color output"},
 	}...)
-	app.Run(os.Args)
+	app.Flags = append(app.Flags, cmd.ProfileFlags...)
+	app.Before = cmd.StartProfiles
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal("%v", err)
+	}
+	cmd.StopProfiles()
 }